@@ -1,6 +1,7 @@
 package seth
 
 import (
+	"bytes"
 	"strings"
 )
 
@@ -38,3 +39,26 @@ func (d *ABIDescriptor) Signature() string {
 	}
 	return d.Name + "(" + strings.Join(args, ",") + ")"
 }
+
+// Selector returns the function selector of d,
+// which is the first 4 bytes of the hash of its
+// signature.
+func (d *ABIDescriptor) Selector() []byte {
+	h := HashString(d.Signature())
+	return h[:4]
+}
+
+// FindSelector finds the function with the given
+// selector, which is the first 4 bytes of its call data.
+func (c *CompiledContract) FindSelector(sel []byte) *ABIDescriptor {
+	if len(sel) < 4 {
+		return nil
+	}
+	for i := range c.ABI {
+		d := &c.ABI[i]
+		if d.Type == "function" && bytes.Equal(d.Selector(), sel[:4]) {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package seth
+
+import (
+	"errors"
+	"sync"
+)
+
+// BackfillOptions are the options for Backfill.
+// Zero values select the defaults.
+type BackfillOptions struct {
+	// Window is the initial number of blocks
+	// per query. The default is 2000.
+	Window int64
+
+	// MinWindow and MaxWindow bound the window size.
+	// The defaults are 1 and 100000, respectively.
+	MinWindow, MaxWindow int64
+
+	// Sparse is the number of logs below which a query result
+	// is considered sparse, causing the window to grow.
+	// The default is 1000.
+	Sparse int
+
+	// Concurrency is the maximum number of
+	// queries in flight. The default is 4.
+	Concurrency int
+
+	// Progress, if non-nil, is called after the logs in each
+	// window have been delivered with the number of the last
+	// block in the window and the number of blocks remaining.
+	Progress func(block, remaining int64)
+}
+
+var defaultBackfill BackfillOptions
+
+func (o *BackfillOptions) window() int64 {
+	w := o.Window
+	if w <= 0 {
+		w = 2000
+	}
+	if max := o.maxwindow(); w > max {
+		w = max
+	}
+	return w
+}
+
+func (o *BackfillOptions) minwindow() int64 {
+	if o.MinWindow > 0 {
+		return o.MinWindow
+	}
+	return 1
+}
+
+func (o *BackfillOptions) maxwindow() int64 {
+	if o.MaxWindow > 0 {
+		return o.MaxWindow
+	}
+	return 100000
+}
+
+func (o *BackfillOptions) sparse() int {
+	if o.Sparse > 0 {
+		return o.Sparse
+	}
+	return 1000
+}
+
+func (o *BackfillOptions) concurrency() int {
+	if o.Concurrency > 0 {
+		return o.Concurrency
+	}
+	return 4
+}
+
+type bfwindow struct {
+	from, to int64
+	logs     []Log
+	err      error
+	done     chan struct{}
+}
+
+type backfill struct {
+	c     *Client
+	opts  *BackfillOptions
+	query FilterQuery
+
+	lock sync.Mutex
+	size int64 // current window size
+	ceil int64 // smallest window known to exceed limits, or 0
+}
+
+func (b *backfill) window() int64 {
+	b.lock.Lock()
+	w := b.size
+	b.lock.Unlock()
+	return w
+}
+
+// observe adjusts the window size after a
+// successful query of 'blocks' blocks
+func (b *backfill) observe(blocks int64, logs int) {
+	b.lock.Lock()
+	if blocks >= b.size && logs < b.opts.sparse() {
+		n := b.size * 2
+		if max := b.opts.maxwindow(); n > max {
+			n = max
+		}
+		if b.ceil == 0 || n < b.ceil {
+			b.size = n
+		}
+	}
+	b.lock.Unlock()
+}
+
+// shrink adjusts the window size after a query
+// of 'blocks' blocks exceeded the server's limits
+func (b *backfill) shrink(blocks int64) {
+	b.lock.Lock()
+	if b.ceil == 0 || blocks < b.ceil {
+		b.ceil = blocks
+	}
+	if n := blocks / 2; n < b.size {
+		b.size = n
+	}
+	if min := b.opts.minwindow(); b.size < min {
+		b.size = min
+	}
+	b.lock.Unlock()
+}
+
+// get fetches the logs in [from, to], splitting
+// the range in half when it exceeds server limits
+func (b *backfill) get(from, to int64) ([]Log, error) {
+	q := b.query
+	q.FromBlock, q.ToBlock = from, to
+	logs, err := b.c.Logs(&q)
+	if err == nil {
+		b.observe(to-from+1, len(logs))
+		return logs, nil
+	}
+	if from == to || !errors.Is(err, ErrLimitExceeded) {
+		return nil, err
+	}
+	b.shrink(to - from + 1)
+	mid := from + (to-from)/2
+	first, err := b.get(from, mid)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := b.get(mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, rest...), nil
+}
+
+func (b *backfill) fetch(w *bfwindow) {
+	w.logs, w.err = b.get(w.from, w.to)
+	close(w.done)
+}
+
+// Backfill calls fn on every log that matches q, in canonical
+// (block and log index) order. The block range of q is split into
+// windows that are queried concurrently using eth_getLogs. When the
+// server rejects a query because its result or block range is too
+// large (see ErrLimitExceeded), the window shrinks, and when results
+// are sparse, the window grows.
+//
+// q.FromBlock and q.ToBlock must not be Pending; if q.ToBlock is Latest,
+// it is resolved to the current block number before the backfill begins.
+// If opts is nil, the default options are used. If fn returns an error,
+// Backfill stops and returns that error.
+func (c *Client) Backfill(q *FilterQuery, opts *BackfillOptions, fn func(l *Log) error) error {
+	if opts == nil {
+		opts = &defaultBackfill
+	}
+	if q.BlockHash != nil || q.FromBlock == Pending || q.ToBlock == Pending {
+		return errors.New("seth: Backfill needs a range of mined blocks")
+	}
+	from, to := q.FromBlock, q.ToBlock
+	if from == Latest || to == Latest {
+		n, err := c.BlockNumber()
+		if err != nil {
+			return err
+		}
+		if from == Latest {
+			from = n
+		}
+		if to == Latest {
+			to = n
+		}
+	}
+
+	b := &backfill{c: c, opts: opts, query: *q, size: opts.window()}
+	// 'sem' bounds the number of queries in flight, and 'order'
+	// bounds the number of windows buffered for delivery;
+	// each window's size is chosen once a query slot is free
+	// so that it reflects the results of earlier queries
+	sem := make(chan struct{}, opts.concurrency())
+	order := make(chan *bfwindow, opts.concurrency())
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(order)
+		for start := from; start <= to; {
+			select {
+			case sem <- struct{}{}:
+			case <-stop:
+				return
+			}
+			end := start + b.window() - 1
+			if end > to {
+				end = to
+			}
+			w := &bfwindow{from: start, to: end, done: make(chan struct{})}
+			select {
+			case order <- w:
+			case <-stop:
+				return
+			}
+			go func() {
+				b.fetch(w)
+				<-sem
+			}()
+			start = end + 1
+		}
+	}()
+	for w := range order {
+		<-w.done
+		if w.err != nil {
+			return w.err
+		}
+		for i := range w.logs {
+			if err := fn(&w.logs[i]); err != nil {
+				return err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(w.to, to-w.to)
+		}
+	}
+	return nil
+}
+
+var errFilterClosed = errors.New("seth: filter closed")
+
+// BackfillFilter returns a Filter that yields the logs matching q
+// using Backfill. The filter is not installed on the server, and it
+// is closed once every log in the range has been delivered.
+func (c *Client) BackfillFilter(q *FilterQuery, opts *BackfillOptions) *Filter {
+	f := &Filter{c: c, out: make(chan *Log, 20), exit: make(chan struct{}, 1), local: true}
+	qc := *q
+	go func() {
+		err := c.Backfill(&qc, opts, func(l *Log) error {
+			select {
+			case f.out <- l:
+				return nil
+			case <-f.exit:
+				return errFilterClosed
+			}
+		})
+		if err != nil && err != errFilterClosed {
+			f.seterr(err)
+		}
+		close(f.out)
+	}()
+	return f
+}
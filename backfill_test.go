@@ -0,0 +1,144 @@
+package seth
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// logRange returns a transport that serves one log per
+// block up to 'height', and rejects queries that span
+// more than 'limit' blocks
+func logRange(height, limit int64, mu *sync.Mutex, sizes *[]int64) Transport {
+	return tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		if req.Method == "eth_blockNumber" {
+			res.Result = itox(height)
+			return nil
+		}
+		var q struct {
+			FromBlock Uint64 `json:"fromBlock"`
+			ToBlock   Uint64 `json:"toBlock"`
+		}
+		json.Unmarshal(req.Params[0], &q)
+		n := int64(q.ToBlock) - int64(q.FromBlock) + 1
+		mu.Lock()
+		*sizes = append(*sizes, n)
+		mu.Unlock()
+		if n > limit {
+			res.Error = RPCError{Code: -32005, Message: "query returned more than 10000 results"}
+			return nil
+		}
+		logs := make([]Log, 0, n)
+		for i := q.FromBlock; i <= q.ToBlock; i++ {
+			num := i
+			logs = append(logs, Log{BlockNumber: &num})
+		}
+		res.Result, _ = json.Marshal(logs)
+		return nil
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int64
+	c := NewClientTransport(logRange(4999, 100, &mu, &sizes))
+
+	var got []int64
+	var progress [][2]int64
+	err := c.Backfill(&FilterQuery{FromBlock: 0, ToBlock: Latest}, &BackfillOptions{
+		Window:      400,
+		Sparse:      1000,
+		Concurrency: 3,
+		Progress: func(block, remaining int64) {
+			progress = append(progress, [2]int64{block, remaining})
+		},
+	}, func(l *Log) error {
+		got = append(got, int64(*l.BlockNumber))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5000 {
+		t.Fatalf("got %d logs; want 5000", len(got))
+	}
+	for i := range got {
+		if got[i] != int64(i) {
+			t.Fatalf("log %d is from block %d", i, got[i])
+		}
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != [2]int64{4999, 0} {
+		t.Errorf("unexpected progress %v", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i][0] <= progress[i-1][0] || progress[i][0]+progress[i][1] != 4999 {
+			t.Errorf("unexpected progress %v", progress)
+		}
+	}
+	// the window should have shrunk to fit within the limit
+	for _, n := range sizes[len(sizes)-5:] {
+		if n > 100 {
+			t.Errorf("window did not shrink: %v", sizes)
+			break
+		}
+	}
+}
+
+func TestBackfillGrow(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int64
+	c := NewClientTransport(logRange(10000, 10000, &mu, &sizes))
+	n := 0
+	err := c.Backfill(&FilterQuery{FromBlock: 0, ToBlock: 9999}, &BackfillOptions{
+		Window:      10,
+		MaxWindow:   1000,
+		Concurrency: 1,
+	}, func(l *Log) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10000 {
+		t.Fatalf("got %d logs; want 10000", n)
+	}
+	if sizes[0] != 10 || sizes[len(sizes)-2] != 1000 {
+		t.Errorf("window did not grow: %v", sizes)
+	}
+	if len(sizes) > 20 {
+		t.Errorf("too many queries: %v", sizes)
+	}
+}
+
+func TestBackfillFilter(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int64
+	c := NewClientTransport(logRange(999, 50, &mu, &sizes))
+	f := c.BackfillFilter(&FilterQuery{FromBlock: 500, ToBlock: 699}, nil)
+	next := int64(500)
+	for l := range f.Out() {
+		if int64(*l.BlockNumber) != next {
+			t.Fatalf("got block %d; want %d", *l.BlockNumber, next)
+		}
+		next++
+	}
+	if f.Err() != nil {
+		t.Fatal(f.Err())
+	}
+	if next != 700 {
+		t.Fatalf("stopped at block %d", next)
+	}
+	f.Close()
+
+	// closing early stops the backfill
+	f = c.BackfillFilter(&FilterQuery{FromBlock: 0, ToBlock: 999}, nil)
+	<-f.Out()
+	f.Close()
+	for range f.Out() {
+	}
+	if f.Err() != nil {
+		t.Fatal(f.Err())
+	}
+}
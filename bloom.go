@@ -0,0 +1,234 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/philhofer/seth/keccak"
+)
+
+// Bloom is the 2048-bit bloom filter of the logs in a
+// block or receipt. The addresses and topics of every log
+// are added to the filter, so a negative Test means that
+// no log in the block involves that address or topic.
+type Bloom [256]byte
+
+// bloombits returns the three bits set by data
+func bloombits(data []byte) [3]uint {
+	h := keccak.Sum256(data)
+	var out [3]uint
+	for i := range out {
+		out[i] = (uint(h[2*i])<<8 | uint(h[2*i+1])) & 2047
+	}
+	return out
+}
+
+// Add adds data to the filter.
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range bloombits(data) {
+		b[255-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// TestBytes returns whether data may have been added to the filter.
+func (b *Bloom) TestBytes(data []byte) bool {
+	for _, bit := range bloombits(data) {
+		if b[255-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Test returns whether a log produced
+// by addr may be included in the filter.
+func (b *Bloom) Test(addr *Address) bool { return b.TestBytes(addr[:]) }
+
+// TestTopic returns whether a log with the topic
+// h may be included in the filter.
+func (b *Bloom) TestTopic(h *Hash) bool { return b.TestBytes(h[:]) }
+
+// AddLog adds the address and topics of l to the filter.
+func (b *Bloom) AddLog(l *Log) {
+	b.Add(l.Address[:])
+	for i := range l.Topics {
+		b.Add(l.Topics[i])
+	}
+}
+
+// Match returns whether the filter may include
+// a log that matches q. The block range of q is ignored.
+func (b *Bloom) Match(q *FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		ok := false
+		for i := range q.Addresses {
+			if b.Test(&q.Addresses[i]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, set := range q.Topics {
+		if len(set) == 0 {
+			continue
+		}
+		ok := false
+		for i := range set {
+			if b.TestTopic(&set[i]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the filter as a hex string.
+func (b *Bloom) String() string { return string(hexstring(b[:], false)) }
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bloom) MarshalText() ([]byte, error) {
+	return hexstring(b[:], false), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Bloom) UnmarshalText(text []byte) error {
+	return hexdecode(b[:], text)
+}
+
+// LogsBloom returns the bloom filter of a list of logs.
+func LogsBloom(logs []Log) Bloom {
+	var b Bloom
+	for i := range logs {
+		b.AddLog(&logs[i])
+	}
+	return b
+}
+
+// LogsBloom returns the bloom filter of the logs in
+// the block, or false if the block has no bloom filter
+// (because it is pending or was fetched from a node
+// that omits it).
+func (b *Block) LogsBloom() (*Bloom, bool) {
+	if len(b.Bloom) != len(Bloom{}) {
+		return nil, false
+	}
+	out := new(Bloom)
+	copy(out[:], b.Bloom)
+	return out, true
+}
+
+// Matches returns whether l matches the addresses
+// and topics of q. The block range of q is ignored.
+// A log with fewer topics than q never matches.
+func (q *FilterQuery) Matches(l *Log) bool {
+	if len(q.Addresses) > 0 {
+		ok := false
+		for i := range q.Addresses {
+			if q.Addresses[i] == l.Address {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	// like a node, require a topic for every position
+	// in the query, even the positions that match anything
+	if len(l.Topics) < len(q.Topics) {
+		return false
+	}
+	for i, set := range q.Topics {
+		if len(set) == 0 {
+			continue
+		}
+		ok := false
+		for j := range set {
+			if bytes.Equal(set[j][:], l.Topics[i]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanReceipts calls fn on the receipt of every transaction in
+// the (inclusive) range of blocks [start, end] that produced a log
+// matching q. The receipts of a block are only fetched if the bloom
+// filter of the block indicates that it may contain a matching log,
+// so sparse queries over long ranges are much cheaper than fetching
+// every receipt. The block range of q is ignored. If fn returns an
+// error, ScanReceipts stops and returns that error.
+func (c *Client) ScanReceipts(q *FilterQuery, start, end int64, fn func(r *Receipt) error) error {
+	for n := start; n <= end; n++ {
+		b, err := c.GetBlock(n, false)
+		if err != nil {
+			return err
+		}
+		if len(b.Transactions) == 0 {
+			continue
+		}
+		if bloom, ok := b.LogsBloom(); ok && !bloom.Match(q) {
+			continue
+		}
+		rxs, err := c.blockReceipts(n, b)
+		if err != nil {
+			return err
+		}
+		for i := range rxs {
+			for j := range rxs[i].Logs {
+				if q.Matches(&rxs[i].Logs[j]) {
+					if err := fn(&rxs[i]); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// blockReceipts gets the receipts of a block, falling back
+// to fetching them one at a time when the node does not
+// support eth_getBlockReceipts
+func (c *Client) blockReceipts(n int64, b *Block) ([]Receipt, error) {
+	rxs, err := c.GetBlockReceipts(n)
+	if err == nil {
+		return rxs, nil
+	}
+	if rpc, ok := err.(*RPCError); !ok || rpc.Code != -32601 {
+		return nil, err
+	}
+	rxs = make([]Receipt, len(b.Transactions))
+	for i := range b.Transactions {
+		// transactions are either hashes or bodies
+		var h Hash
+		if err := json.Unmarshal(b.Transactions[i], &h); err != nil {
+			var tx struct {
+				Hash Hash `json:"hash"`
+			}
+			if err := json.Unmarshal(b.Transactions[i], &tx); err != nil {
+				return nil, err
+			}
+			h = tx.Hash
+		}
+		rx, err := c.GetReceipt(&h)
+		if err != nil {
+			return nil, err
+		}
+		rxs[i] = *rx
+	}
+	return rxs, nil
+}
@@ -0,0 +1,98 @@
+package seth
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	addr := Address{1, 2, 3}
+	other := Address{4, 5, 6}
+	topic := HashString("Transfer")
+	l := Log{Address: addr, Topics: []Data{topic[:]}}
+
+	var b Bloom
+	b.AddLog(&l)
+	if !b.Test(&addr) || !b.TestTopic(&topic) {
+		t.Fatal("bloom is missing an added value")
+	}
+	if b.Test(&other) {
+		t.Error("unexpected positive for", other.String())
+	}
+	cases := []struct {
+		q    FilterQuery
+		want bool
+	}{
+		{FilterQuery{}, true},
+		{FilterQuery{Addresses: []Address{other, addr}}, true},
+		{FilterQuery{Addresses: []Address{other}}, false},
+		{FilterQuery{Topics: [][]Hash{{topic}}}, true},
+		{FilterQuery{Topics: [][]Hash{nil, {topic}}}, true}, // positions are not recorded
+		{FilterQuery{Topics: [][]Hash{{HashString("Approval")}}}, false},
+	}
+	for i := range cases {
+		if got := b.Match(&cases[i].q); got != cases[i].want {
+			t.Errorf("case %d: Match = %v", i, got)
+		}
+		// Matches is exact, so it agrees except for topic positions
+		if got := cases[i].q.Matches(&l); got != cases[i].want && i != 4 {
+			t.Errorf("case %d: Matches = %v", i, got)
+		}
+	}
+
+	buf, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b2 Bloom
+	if err := json.Unmarshal(buf, &b2); err != nil {
+		t.Fatal(err)
+	}
+	if b2 != b {
+		t.Fatal("bloom did not round-trip")
+	}
+}
+
+func TestScanReceipts(t *testing.T) {
+	tok := Address{0xaa}
+	var fetched []int64
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		var n Uint64
+		json.Unmarshal(req.Params[0], &n)
+		var logs []Log
+		if n%3 == 0 {
+			logs = []Log{{Address: tok, Topics: []Data{ERC20Transfer[:], make(Data, 32), make(Data, 32)}}}
+		}
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			b := LogsBloom(logs)
+			res.Result, _ = json.Marshal(map[string]interface{}{
+				"number":       n,
+				"logsBloom":    b,
+				"transactions": []Hash{HashString(fmt.Sprint(n))},
+			})
+		case "eth_getBlockReceipts":
+			fetched = append(fetched, int64(n))
+			res.Result, _ = json.Marshal([]Receipt{{BlockNumber: n, Logs: logs}})
+		default:
+			return fmt.Errorf("unexpected method %s", req.Method)
+		}
+		return nil
+	}))
+	var found []int64
+	err := c.ScanReceipts(TransferQuery(nil, nil, &tok), 1, 10, func(r *Receipt) error {
+		found = append(found, int64(r.BlockNumber))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(found) != "[3 6 9]" {
+		t.Errorf("found receipts in blocks %v", found)
+	}
+	if len(fetched) != 3 {
+		t.Errorf("fetched receipts for blocks %v", fetched)
+	}
+}
@@ -0,0 +1,405 @@
+package seth
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// CacheStore is a persistent store for
+// results cached by a CachingTransport.
+type CacheStore interface {
+	// Get returns the value stored under key, if any.
+	Get(key string) ([]byte, bool)
+	// Put stores a value under key.
+	Put(key string, value []byte) error
+}
+
+// DirStore is a CacheStore that keeps
+// each entry in its own file in a directory.
+// The directory is created if it doesn't exist.
+type DirStore string
+
+func (d DirStore) path(key string) string {
+	h := HashString(key)
+	name := hex.EncodeToString(h[:])
+	return filepath.Join(string(d), name[:2], name[2:])
+}
+
+// Get implements CacheStore.Get
+func (d DirStore) Get(key string) ([]byte, bool) {
+	buf, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	// entries are stored as (key, value) so
+	// that a corrupt or mismatched entry is ignored
+	k, rest, err := msgp.ReadStringBytes(buf)
+	if err != nil || k != key {
+		return nil, false
+	}
+	v, _, err := msgp.ReadBytesBytes(rest, nil)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// Put implements CacheStore.Put
+func (d DirStore) Put(key string, value []byte) error {
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return err
+	}
+	buf := msgp.AppendString(nil, key)
+	buf = msgp.AppendBytes(buf, value)
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// CachingTransport is a Transport that caches the results
+// of requests for chain data that cannot change: blocks and
+// transactions by hash, the chain ID, and any data that is
+// addressed by a block number at least Confirmations blocks
+// behind the head of the chain. Requests for anything else
+// (including any request that names the "latest" or "pending"
+// block) are always passed through to the underlying Transport.
+//
+// Results are kept in an in-memory LRU cache, and optionally
+// in a persistent Store. The zero value of a CachingTransport
+// (with a non-nil Transport) is ready to use.
+type CachingTransport struct {
+	Transport
+
+	// Size is the number of results kept in memory.
+	// If it is zero, 1024 results are kept.
+	Size int
+
+	// Store, if non-nil, is used as a second-level cache.
+	Store CacheStore
+
+	// StoreError, if non-nil, is called when Store fails
+	// to save a result. If it is nil, the error is logged.
+	// Either way, the request itself still succeeds.
+	StoreError func(key string, err error)
+
+	// Confirmations is the number of blocks after which
+	// data addressed by block number is considered to be
+	// immutable. If it is zero, 12 is used.
+	Confirmations int64
+
+	hits, misses int64
+
+	lock   sync.Mutex // guards below
+	lru    list.List  // of *cacheent
+	table  map[string]*list.Element
+	head   int64
+	headAt time.Time
+}
+
+type cacheent struct {
+	key   string
+	value json.RawMessage
+}
+
+func (c *CachingTransport) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return 1024
+}
+
+func (c *CachingTransport) depth() int64 {
+	if c.Confirmations > 0 {
+		return c.Confirmations
+	}
+	return 12
+}
+
+// Stats returns the number of cache hits and misses.
+func (c *CachingTransport) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+}
+
+func (c *CachingTransport) get(key string) (json.RawMessage, bool) {
+	c.lock.Lock()
+	if e, ok := c.table[key]; ok {
+		c.lru.MoveToFront(e)
+		v := e.Value.(*cacheent).value
+		c.lock.Unlock()
+		return v, true
+	}
+	c.lock.Unlock()
+	if c.Store == nil {
+		return nil, false
+	}
+	v, ok := c.Store.Get(key)
+	if ok {
+		c.insert(key, v)
+	}
+	return v, ok
+}
+
+func (c *CachingTransport) insert(key string, value json.RawMessage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.table == nil {
+		c.table = make(map[string]*list.Element)
+	}
+	if e, ok := c.table[key]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.table[key] = c.lru.PushFront(&cacheent{key: key, value: value})
+	for c.lru.Len() > c.size() {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.table, e.Value.(*cacheent).key)
+	}
+}
+
+func (c *CachingTransport) put(key string, value json.RawMessage) {
+	c.insert(key, value)
+	if c.Store == nil {
+		return
+	}
+	if err := c.Store.Put(key, value); err != nil {
+		if c.StoreError != nil {
+			c.StoreError(key, err)
+		} else {
+			log.Printf("seth: caching %q: %s", key, err)
+		}
+	}
+}
+
+// cachekey produces the cache key for a request,
+// which is independent of the request ID and whitespace
+func cachekey(req *RPCRequest) (string, bool) {
+	var buf bytes.Buffer
+	buf.WriteString(req.Method)
+	for i := range req.Params {
+		buf.WriteByte(' ')
+		if err := json.Compact(&buf, req.Params[i]); err != nil {
+			return "", false
+		}
+	}
+	return buf.String(), true
+}
+
+// blockspec interprets a block parameter, returning the
+// block number it refers to and whether or not the parameter
+// refers to a specific block. Block hashes (EIP-1898) are
+// reported as block 0, since they never change.
+func blockspec(param json.RawMessage) (int64, bool) {
+	if len(param) > 0 && param[0] == '{' {
+		var obj struct {
+			Hash   *Hash   `json:"blockHash"`
+			Number *Uint64 `json:"blockNumber"`
+		}
+		if json.Unmarshal(param, &obj) != nil {
+			return 0, false
+		}
+		if obj.Hash != nil {
+			return 0, true
+		}
+		if obj.Number != nil {
+			return int64(*obj.Number), true
+		}
+		return 0, false
+	}
+	switch {
+	case bytes.Equal(param, rawearliest):
+		return 0, true
+	case bytes.Equal(param, rawlatest), bytes.Equal(param, rawpending):
+		return 0, false
+	}
+	var n Uint64
+	if json.Unmarshal(param, &n) != nil {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+// mined returns the block number embedded in
+// a transaction or receipt result, if any
+func mined(result json.RawMessage) (int64, bool) {
+	var obj struct {
+		Number *Uint64 `json:"blockNumber"`
+	}
+	if json.Unmarshal(result, &obj) != nil || obj.Number == nil {
+		return 0, false
+	}
+	return int64(*obj.Number), true
+}
+
+// cacheblock determines whether or not a request can be
+// cached based on its parameters. If the return value 'check'
+// is true, the request can be cached if block number 'num' is
+// sufficiently deep. If the return value 'after' is true, the
+// result needs to be inspected with mined() before caching.
+func cacheblock(req *RPCRequest) (num int64, check, after, ok bool) {
+	p := req.Params
+	arg := func(i int) (int64, bool, bool, bool) {
+		if i >= len(p) {
+			return 0, false, false, false
+		}
+		n, ok := blockspec(p[i])
+		return n, n != 0, false, ok
+	}
+	switch req.Method {
+	case "eth_chainId", "net_version":
+		return 0, false, false, true
+	case "eth_getBlockByHash",
+		"eth_getBlockTransactionCountByHash",
+		"eth_getTransactionByBlockHashAndIndex",
+		"eth_getUncleByBlockHashAndIndex",
+		"eth_getUncleCountByBlockHash":
+		return 0, false, false, true
+	case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+		return 0, false, true, true
+	case "eth_getBlockByNumber",
+		"eth_getBlockTransactionCountByNumber",
+		"eth_getTransactionByBlockNumberAndIndex",
+		"eth_getUncleByBlockNumberAndIndex",
+		"eth_getUncleCountByBlockNumber",
+		"eth_getBlockReceipts":
+		return arg(0)
+	case "eth_getBalance", "eth_getCode", "eth_getTransactionCount", "eth_call":
+		return arg(1)
+	case "eth_getStorageAt", "eth_getProof":
+		return arg(2)
+	case "eth_getLogs":
+		if len(p) != 1 {
+			return 0, false, false, false
+		}
+		var q struct {
+			From json.RawMessage `json:"fromBlock"`
+			To   json.RawMessage `json:"toBlock"`
+			Hash *Hash           `json:"blockHash"`
+		}
+		if json.Unmarshal(p[0], &q) != nil {
+			return 0, false, false, false
+		}
+		if q.Hash != nil {
+			return 0, false, false, true
+		}
+		if len(q.From) == 0 || len(q.To) == 0 {
+			return 0, false, false, false
+		}
+		if _, ok := blockspec(q.From); !ok {
+			return 0, false, false, false
+		}
+		n, ok := blockspec(q.To)
+		return n, n != 0, false, ok
+	}
+	return 0, false, false, false
+}
+
+// deep returns whether or not block n is at least
+// c.Confirmations blocks behind the head of the chain
+func (c *CachingTransport) deep(n int64) bool {
+	c.lock.Lock()
+	head, at := c.head, c.headAt
+	c.lock.Unlock()
+	if n <= head-c.depth() {
+		return true
+	}
+	if time.Since(at) < time.Second {
+		return false
+	}
+	req := &RPCRequest{
+		Version: "2.0",
+		Method:  "eth_blockNumber",
+		ID:      int(atomic.AddInt64(&checkid, -1)),
+	}
+	var res RPCResponse
+	if err := c.Transport.Execute(req, &res); err != nil || res.Error.Code != 0 || res.Error.Message != "" {
+		return false
+	}
+	var num Uint64
+	if json.Unmarshal(res.Result, &num) != nil {
+		return false
+	}
+	c.sethead(int64(num))
+	return n <= int64(num)-c.depth()
+}
+
+func (c *CachingTransport) sethead(n int64) {
+	c.lock.Lock()
+	if n > c.head {
+		c.head = n
+	}
+	c.headAt = time.Now()
+	c.lock.Unlock()
+}
+
+// Execute implements Transport.
+func (c *CachingTransport) Execute(req *RPCRequest, res *RPCResponse) error {
+	num, check, after, ok := cacheblock(req)
+	var key string
+	if ok {
+		key, ok = cachekey(req)
+	}
+	if ok && (!check || c.deep(num)) {
+		if v, hit := c.get(key); hit {
+			atomic.AddInt64(&c.hits, 1)
+			*res = RPCResponse{
+				ID:      req.ID,
+				Version: req.Version,
+				Result:  append(json.RawMessage(nil), v...),
+			}
+			return nil
+		}
+		atomic.AddInt64(&c.misses, 1)
+	} else {
+		ok = false
+	}
+
+	if err := c.Transport.Execute(req, res); err != nil {
+		return err
+	}
+	if res.Error.Code != 0 || res.Error.Message != "" ||
+		len(res.Result) == 0 || bytes.Equal(res.Result, rawnull) {
+		return nil
+	}
+	if req.Method == "eth_blockNumber" {
+		var n Uint64
+		if json.Unmarshal(res.Result, &n) == nil {
+			c.sethead(int64(n))
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if after {
+		n, mined := mined(res.Result)
+		if !mined || !c.deep(n) {
+			return nil
+		}
+	}
+	c.put(key, append(json.RawMessage(nil), res.Result...))
+	return nil
+}
@@ -0,0 +1,131 @@
+package seth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCachingTransport(t *testing.T) {
+	t.Parallel()
+	calls := make(map[string]int)
+	inner := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		calls[req.Method]++
+		switch req.Method {
+		case "eth_blockNumber":
+			res.Result = itox(100)
+		case "eth_getTransactionReceipt":
+			var h Hash
+			json.Unmarshal(req.Params[0], &h)
+			// hash[0] is the block number
+			res.Result = json.RawMessage(`{"blockNumber":` + string(itox(int64(h[0]))) + `}`)
+		default:
+			res.Result = json.RawMessage(`{"number":"0x10"}`)
+		}
+		return nil
+	})
+	c := NewClientTransport(&CachingTransport{Transport: inner, Size: 2})
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetBlock(0x10, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls["eth_getBlockByNumber"]; n != 1 {
+		t.Errorf("expected 1 call for an old block; got %d", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetBlock(Latest, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetBlock(99, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls["eth_getBlockByNumber"]; n != 7 {
+		t.Errorf("expected 7 calls; got %d", n)
+	}
+
+	// a receipt in block 10 should be cached,
+	// and a receipt in block 95 should not
+	var old, young Hash
+	old[0], young[0] = 10, 95
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetReceipt(&old); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetReceipt(&young); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls["eth_getTransactionReceipt"]; n != 3 {
+		t.Errorf("expected 3 receipt calls; got %d", n)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "seth-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	inner := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		calls++
+		res.Result = json.RawMessage(`"0x1"`)
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		// each client has a fresh in-memory
+		// cache, but the same store
+		c := NewClientTransport(&CachingTransport{Transport: inner, Store: DirStore(dir)})
+		var out Uint64
+		if err := c.Do("eth_chainId", nil, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != 1 {
+			t.Errorf("got %d", out)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one call; got %d", calls)
+	}
+	if _, ok := DirStore(dir).Get("eth_chainId x"); ok {
+		t.Error("found a value for a key that was never stored")
+	}
+}
+
+func TestStoreError(t *testing.T) {
+	t.Parallel()
+	f, err := ioutil.TempFile("", "seth-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	inner := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.Result = json.RawMessage(`"0x1"`)
+		return nil
+	})
+	var failed []string
+	c := NewClientTransport(&CachingTransport{
+		Transport: inner,
+		// a store inside of a regular file can't be written
+		Store:      DirStore(filepath.Join(f.Name(), "cache")),
+		StoreError: func(key string, err error) { failed = append(failed, key) },
+	})
+	var out Uint64
+	if err := c.Do("eth_chainId", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0] != "eth_chainId" {
+		t.Errorf("unexpected store errors for %q", failed)
+	}
+}
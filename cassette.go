@@ -0,0 +1,153 @@
+package seth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrNotRecorded is returned by a Replayer
+// for requests that do not appear in its cassette.
+var ErrNotRecorded = errors.New("seth: request not recorded")
+
+// cassette files consist of one JSON-encoded
+// interaction per line
+type interaction struct {
+	Request  *RPCRequest  `json:"request"`
+	Response *RPCResponse `json:"response"`
+	Error    string       `json:"error,omitempty"` // transport error, if any
+}
+
+// Recorder is a Transport that writes every request
+// and response passing through it to a "cassette,"
+// which can be played back later with a Replayer.
+// Cassettes are written as JSON, one interaction per line.
+type Recorder struct {
+	Transport
+
+	lock sync.Mutex
+	enc  *json.Encoder
+	err  error
+}
+
+// NewRecorder constructs a Recorder that writes
+// the interactions with t to w.
+func NewRecorder(t Transport, w io.Writer) *Recorder {
+	return &Recorder{Transport: t, enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error encountered
+// while writing to the cassette, if any.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	err := r.err
+	r.lock.Unlock()
+	return err
+}
+
+// Execute implements Transport.
+func (r *Recorder) Execute(req *RPCRequest, res *RPCResponse) error {
+	err := r.Transport.Execute(req, res)
+	in := interaction{Request: req, Response: new(RPCResponse)}
+	*in.Response = *res
+	switch e := err.(type) {
+	case nil:
+	case *RPCError:
+		in.Response.Error = *e
+	default:
+		if err == ErrNotFound {
+			in.Response.Result = rawnull
+		} else {
+			in.Error = err.Error()
+		}
+	}
+	r.lock.Lock()
+	if werr := r.enc.Encode(&in); werr != nil && r.err == nil {
+		r.err = werr
+	}
+	r.lock.Unlock()
+	return err
+}
+
+// Replayer is a Transport that serves responses from a
+// cassette produced by a Recorder, without making any network
+// requests. Requests are matched on their method and parameters.
+// Identical requests are answered in the order in which they were
+// recorded, and once the recorded responses to a request have been
+// exhausted, the last one is repeated.
+type Replayer struct {
+	lock    sync.Mutex
+	entries map[string][]*interaction
+}
+
+// NewReplayer reads a cassette from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	p := &Replayer{entries: make(map[string][]*interaction)}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 64<<20)
+	line := 0
+	for s.Scan() {
+		line++
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		in := new(interaction)
+		if err := json.Unmarshal(s.Bytes(), in); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %s", line, err)
+		}
+		if in.Request == nil || in.Response == nil {
+			return nil, fmt.Errorf("cassette line %d: missing request or response", line)
+		}
+		key, ok := cachekey(in.Request)
+		if !ok {
+			return nil, fmt.Errorf("cassette line %d: malformed params", line)
+		}
+		p.entries[key] = append(p.entries[key], in)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadCassette reads a cassette from a file.
+func LoadCassette(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewReplayer(f)
+}
+
+// Execute implements Transport.
+func (p *Replayer) Execute(req *RPCRequest, res *RPCResponse) error {
+	key, ok := cachekey(req)
+	if !ok {
+		return fmt.Errorf("%w: %s (malformed params)", ErrNotRecorded, req.Method)
+	}
+	p.lock.Lock()
+	list := p.entries[key]
+	if len(list) == 0 {
+		p.lock.Unlock()
+		return fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	in := list[0]
+	if len(list) > 1 {
+		p.entries[key] = list[1:]
+	}
+	p.lock.Unlock()
+
+	if in.Error != "" {
+		return errors.New(in.Error)
+	}
+	*res = *in.Response
+	res.ID = req.ID
+	res.Result = append(json.RawMessage(nil), in.Response.Result...)
+	return nil
+}
@@ -0,0 +1,92 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+	height := int64(100)
+	live := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		switch req.Method {
+		case "eth_blockNumber":
+			height++
+			res.Result = itox(height)
+		case "eth_getTransactionReceipt":
+			return ErrNotFound
+		case "eth_getCode":
+			res.Error = RPCError{Code: -32000, Message: "header not found"}
+		default:
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+
+	var buf bytes.Buffer
+	rec := NewRecorder(live, &buf)
+	c := NewClientTransport(rec)
+	for i := 0; i < 2; i++ {
+		if _, err := c.BlockNumber(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var h Hash
+	if _, err := c.GetReceipt(&h); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound; got", err)
+	}
+	var addr Address
+	if _, err := c.GetCodeAt(&addr, 5); err == nil {
+		t.Fatal("expected an RPC error")
+	}
+	if _, err := c.GasPrice(); err == nil {
+		t.Fatal("expected a transport error")
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	play, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewClientTransport(play)
+	for _, want := range []int64{101, 102, 102} {
+		n, err := c.BlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("got block %d; wanted %d", n, want)
+		}
+	}
+	if _, err := c.GetReceipt(&h); err != ErrNotFound {
+		t.Error("expected ErrNotFound; got", err)
+	}
+	if _, err := c.GetCodeAt(&addr, 5); err == nil || err.(*RPCError).Message != "header not found" {
+		t.Error("expected recorded RPC error; got", err)
+	}
+	if _, err := c.GasPrice(); err == nil || err.Error() != "connection reset" {
+		t.Error("expected recorded transport error; got", err)
+	}
+	if _, err := c.GetCodeAt(&addr, 6); !errors.Is(err, ErrNotRecorded) {
+		t.Error("expected ErrNotRecorded; got", err)
+	}
+
+	// whitespace in params shouldn't matter
+	res := new(RPCResponse)
+	req := &RPCRequest{
+		Method: "eth_getTransactionReceipt",
+		Params: []json.RawMessage{json.RawMessage(" \"" + h.String() + "\" ")},
+		ID:     42,
+	}
+	if err := play.Execute(req, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != 42 {
+		t.Errorf("response ID %d != 42", res.ID)
+	}
+}
@@ -19,6 +19,18 @@ type pending struct {
 	notify chan struct{}
 	res    *RPCResponse
 	err    error
+	sub    chan<- json.RawMessage // for eth_subscribe requests
+}
+
+// rpcMessage is either a response or
+// a subscription notification
+type rpcMessage struct {
+	RPCResponse
+	Method string `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
 }
 
 // An RPCTrasport is a client transport for making requests over an RPC
@@ -28,14 +40,15 @@ type RPCTransport struct {
 	conn    io.ReadWriteCloser
 	enc     *json.Encoder // wraps send side of conn
 	pending map[int]*pending
-	res     RPCResponse
+	subs    map[string]chan<- json.RawMessage
+	res     rpcMessage
 	dial    func() (io.ReadWriteCloser, error)
 }
 
 func (t *RPCTransport) background(conn io.ReadWriteCloser) {
 	dec := json.NewDecoder(conn)
 	for {
-		t.res = RPCResponse{}
+		t.res = rpcMessage{}
 		err := dec.Decode(&t.res)
 		if err != nil {
 			log.Printf("seth: conn read: %s", err)
@@ -47,6 +60,10 @@ func (t *RPCTransport) background(conn io.ReadWriteCloser) {
 			t.lock.Unlock()
 			return
 		}
+		if t.res.Method == "eth_subscription" {
+			t.notify(t.res.Params.Subscription, t.res.Params.Result)
+			continue
+		}
 		t.lock.Lock()
 		p := t.pending[t.res.ID]
 		if p != nil {
@@ -63,18 +80,56 @@ func (t *RPCTransport) background(conn io.ReadWriteCloser) {
 		} else if bytes.Equal(t.res.Result, rawnull) {
 			p.err = ErrNotFound
 		} else {
-			*p.res = t.res
+			*p.res = t.res.RPCResponse
+			if p.sub != nil {
+				// register the subscription before reading
+				// any notifications that belong to it
+				var id string
+				if err := json.Unmarshal(t.res.Result, &id); err != nil {
+					p.err = err
+				} else {
+					t.lock.Lock()
+					if t.subs == nil {
+						t.subs = make(map[string]chan<- json.RawMessage)
+					}
+					t.subs[id] = p.sub
+					t.lock.Unlock()
+				}
+			}
 		}
 		close(p.notify)
 	}
 }
 
+// notify delivers a subscription notification,
+// dropping it if the receiver is not ready
+func (t *RPCTransport) notify(id string, result json.RawMessage) {
+	// the send happens under the lock so that abort
+	// cannot close the channel out from under it
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ch := t.subs[id]
+	if ch == nil {
+		return
+	}
+	// t.res is reused, so copy the result
+	select {
+	case ch <- append(json.RawMessage(nil), result...):
+	default:
+	}
+}
+
 func (t *RPCTransport) abort(err error) {
 	for id, p := range t.pending {
 		p.err = err
 		close(p.notify)
 		delete(t.pending, id)
 	}
+	// subscriptions do not survive the connection
+	for id, ch := range t.subs {
+		close(ch)
+		delete(t.subs, id)
+	}
 	t.enc = nil
 	t.conn.Close()
 	t.conn = nil
@@ -122,6 +177,28 @@ func (c *Client) Do(method string, params []json.RawMessage, result interface{})
 }
 
 func (t *RPCTransport) Execute(req *RPCRequest, res *RPCResponse) error {
+	return t.execute(req, res, nil)
+}
+
+// Subscribe implements Subscriber.
+func (t *RPCTransport) Subscribe(req *RPCRequest, out chan<- json.RawMessage) (string, error) {
+	var res RPCResponse
+	if err := t.execute(req, &res, out); err != nil {
+		return "", err
+	}
+	var id string
+	err := json.Unmarshal(res.Result, &id)
+	return id, err
+}
+
+// Unsubscribe implements Subscriber.
+func (t *RPCTransport) Unsubscribe(id string) {
+	t.lock.Lock()
+	delete(t.subs, id)
+	t.lock.Unlock()
+}
+
+func (t *RPCTransport) execute(req *RPCRequest, res *RPCResponse, sub chan<- json.RawMessage) error {
 	notify := make(chan struct{}, 1)
 	t.lock.Lock()
 	if t.enc == nil {
@@ -130,7 +207,7 @@ func (t *RPCTransport) Execute(req *RPCRequest, res *RPCResponse) error {
 			return err
 		}
 	}
-	p := &pending{notify: notify, res: res}
+	p := &pending{notify: notify, res: res, sub: sub}
 	t.pending[req.ID] = p
 	err := t.enc.Encode(req)
 	if err != nil {
@@ -41,6 +41,7 @@ var subcommands = map[string]*cmd{
 	"read":    cmdread,
 	"recover": cmdrecover,
 	"sign":    cmdsign,
+	"trace":   cmdtrace,
 }
 
 // debugf prints lines prefixed with '+ ' if
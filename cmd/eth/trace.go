@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/philhofer/seth"
+	"github.com/philhofer/seth/cc"
+)
+
+var cmdtrace = &cmd{
+	desc:  "print the call tree of a transaction",
+	usage: "eth trace [-p] <txhash>",
+	do:    trace,
+}
+
+var parity bool
+
+func init() {
+	cmdtrace.fs.Init("trace", flag.ExitOnError)
+	cmdtrace.fs.BoolVar(&parity, "p", false, "use Parity-style trace_transaction instead of debug_traceTransaction")
+}
+
+func printframe(depth int, f *seth.CallFrame) bool {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(f.Type)
+	b.WriteByte(' ')
+	b.WriteString(f.From.String())
+	b.WriteString(" -> ")
+	if f.To != nil {
+		b.WriteString(f.To.String())
+	} else {
+		b.WriteString("?")
+	}
+	if f.Value != nil && f.Value.Big().Sign() != 0 {
+		amt := cc.Amount{Currency: "ETH", Amount: *f.Value.Big()}
+		fmt.Fprintf(&b, " value=%s", amt.String())
+	}
+	if len(f.Input) >= 4 && !strings.HasPrefix(f.Type, "CREATE") {
+		fmt.Fprintf(&b, " sel=0x%x", []byte(f.Input[:4]))
+	}
+	fmt.Fprintf(&b, " gas=%d/%d", uint64(f.GasUsed), uint64(f.Gas))
+	if f.Error != "" {
+		fmt.Fprintf(&b, " error=%q", f.Error)
+	}
+	fmt.Println(b.String())
+	return true
+}
+
+func trace(fs *flag.FlagSet) {
+	args := fs.Args()
+	if len(args) != 1 {
+		fs.Usage()
+	}
+	var h seth.Hash
+	if err := h.FromString(args[0]); err != nil {
+		fatalf("bad transaction hash: %s", err)
+	}
+	c := client()
+	var root *seth.CallFrame
+	if parity {
+		debugf("using trace_transaction")
+		traces, err := c.Traces(&h)
+		if err != nil {
+			fatalf("getting traces: %s", err)
+		}
+		root, err = seth.CallTree(traces)
+		if err != nil {
+			fatal(err)
+		}
+	} else {
+		var err error
+		root, err = c.TraceTransaction(&h)
+		if err != nil {
+			fatalf("tracing transaction: %s", err)
+		}
+	}
+	root.Walk(printframe)
+}
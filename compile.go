@@ -38,7 +38,7 @@ type sourceblob struct {
 
 var defaultOutput = map[string]map[string][]string{
 	"*": map[string][]string{
-		"*": []string{"evm.bytecode", "abi"},
+		"*": []string{"evm.bytecode", "evm.deployedBytecode", "abi"},
 	},
 }
 
@@ -60,13 +60,16 @@ type sourcedesc struct {
 	ID int `json:"id"`
 }
 
+type bytecodeout struct {
+	Object    string `json:"object"`    // hex string of opcodes
+	Sourcemap string `json:"sourceMap"` // source map string
+}
+
 type contractout struct {
 	ABI []ABIDescriptor
 	EVM struct {
-		Bytecode struct {
-			Object    string `json:"object"`    // hex string of opcodes
-			Sourcemap string `json:"sourceMap"` // source map string
-		} `json:"bytecode"`
+		Bytecode         bytecodeout `json:"bytecode"`
+		DeployedBytecode bytecodeout `json:"deployedBytecode"`
 	} `json:"evm"`
 }
 
@@ -108,13 +111,22 @@ type ABIDescriptor struct {
 
 // CompiledContract represents a single solidity contract.
 type CompiledContract struct {
-	Name      string          `msg:"name"`      // Contract name
-	Code      []byte          `msg:"code"`      // Code is the EVM bytecode for a contract
-	Sourcemap string          `msg:"sourcemap"` // Sourcemap is the stringified source map for the contract
-	ABI       []ABIDescriptor `msg:"abi"`       // Raw JSON ABI
+	Name      string `msg:"name"`      // Contract name
+	Code      []byte `msg:"code"`      // Code is the EVM bytecode for a contract
+	Sourcemap string `msg:"sourcemap"` // Sourcemap is the stringified source map for the contract
+
+	// DeployedCode is the bytecode left at the contract
+	// address once Code has run, and DeployedSourcemap
+	// is its source map.
+	DeployedCode      []byte `msg:"deployedcode"`
+	DeployedSourcemap string `msg:"deployedsourcemap"`
+
+	ABI []ABIDescriptor `msg:"abi"` // Raw JSON ABI
 
-	srcmap []srcinfo
-	pos    []int // pos[pc] = opcode number
+	srcmap  []srcinfo
+	pos     []int // pos[pc] = opcode number
+	dsrcmap []srcinfo
+	dpos    []int // same as pos, but for DeployedCode
 }
 
 var metadataPrefix = []byte{0xa1, 0x65, 'b', 'z', 'z', 'r', '0', 0x58, 0x20}
@@ -156,39 +168,65 @@ func mustint(s string) int {
 }
 
 func (c *CompiledContract) pc2info(pc int) *srcinfo {
-	if pc >= len(c.pos) {
+	return lookupinfo(c.srcmap, c.pos, pc)
+}
+
+// deployedinfo is pc2info for c.DeployedCode
+func (c *CompiledContract) deployedinfo(pc int) *srcinfo {
+	if len(c.dsrcmap) == 0 {
+		c.dsrcmap = parseSourcemap(c.DeployedSourcemap)
+		c.dpos = oppos(c.DeployedCode)
+	}
+	return lookupinfo(c.dsrcmap, c.dpos, pc)
+}
+
+func lookupinfo(srcmap []srcinfo, pos []int, pc int) *srcinfo {
+	if pc < 0 || pc >= len(pos) {
 		return nil
 	}
-	n := c.pos[pc]
-	if n >= len(c.srcmap) {
+	n := pos[pc]
+	if n >= len(srcmap) {
 		return nil
 	}
-	return &c.srcmap[n]
+	return &srcmap[n]
 }
 
 func (c *CompiledContract) compilePos() {
+	c.pos = oppos(c.Code)
+}
+
+// oppos maps each pc in code to an opcode number
+func oppos(code []byte) []int {
 	opnum := 0
-	var out []int
-	for i := range c.Code {
+	out := make([]int, 0, len(code))
+	for i := 0; i < len(code); i++ {
 		width := 0
-		b := c.Code[i]
+		b := code[i]
 		out = append(out, opnum)
 		if b >= 0x60 && b < 0x80 {
-			width = int(b - 0x59)
+			width = int(b - 0x5f)
 		}
 		// for multi-byte instructions,
 		// any pc that points into the instruction
 		// gets the same opcode number
-		for j := 0; j < width; j++ {
+		for j := 0; j < width && i+1 < len(code); j++ {
 			out = append(out, opnum)
+			i++
 		}
 		opnum++
 	}
-	c.pos = out
+	return out
 }
 
 func (c *CompiledContract) compileSourcemap() {
-	ops := strings.Split(c.Sourcemap, ";")
+	c.srcmap = parseSourcemap(c.Sourcemap)
+}
+
+func parseSourcemap(sourcemap string) []srcinfo {
+	if sourcemap == "" {
+		return nil
+	}
+	ops := strings.Split(sourcemap, ";")
 	out := make([]srcinfo, len(ops))
 	for i := range out {
 		if i > 0 {
@@ -217,7 +255,7 @@ func (c *CompiledContract) compileSourcemap() {
 			}
 		}
 	}
-	c.srcmap = out
+	return out
 }
 
 //go:generate msgp
@@ -267,7 +305,11 @@ func (s *solcout) toBundle() *CompiledBundle {
 				Name:      contract,
 				Code:      h2b(out.EVM.Bytecode.Object),
 				Sourcemap: out.EVM.Bytecode.Sourcemap,
-				ABI:       out.ABI,
+
+				DeployedCode:      h2b(out.EVM.DeployedBytecode.Object),
+				DeployedSourcemap: out.EVM.DeployedBytecode.Sourcemap,
+
+				ABI: out.ABI,
 			})
 		}
 	}
@@ -284,12 +326,69 @@ func (b *CompiledBundle) SourceOf(c *CompiledContract, pc int) string {
 		c.compilePos()
 	}
 	info := c.pc2info(pc)
-	if info == nil {
+	if !b.valid(info) {
 		return ""
 	}
 	return b.Sources[info.f][info.s : info.s+info.l]
 }
 
+// valid returns whether info refers to a
+// range of source code in the bundle
+func (b *CompiledBundle) valid(info *srcinfo) bool {
+	// solc uses file -1 for code that
+	// it generates on its own
+	return info != nil && info.f >= 0 && info.f < len(b.Sources) &&
+		info.s >= 0 && info.l >= 0 && info.s+info.l <= len(b.Sources[info.f])
+}
+
+// SourceRange is the range of source code
+// that an instruction was compiled from.
+type SourceRange struct {
+	File   int // index of the file in Filenames and Sources
+	Start  int // byte offset of the range
+	Length int // length of the range in bytes
+	// Jump is 'i' for a jump into a function, 'o'
+	// for a jump out of a function, and '-' otherwise.
+	Jump byte
+}
+
+// Range returns the range of source code of the instruction
+// at pc. If deployed is true, pc is an offset into c.DeployedCode
+// rather than c.Code. Range returns false if the pc does not map
+// to any source.
+func (b *CompiledBundle) Range(c *CompiledContract, pc int, deployed bool) (SourceRange, bool) {
+	var info *srcinfo
+	if deployed {
+		info = c.deployedinfo(pc)
+	} else {
+		if len(c.srcmap) == 0 {
+			c.compileSourcemap()
+			c.compilePos()
+		}
+		info = c.pc2info(pc)
+	}
+	if !b.valid(info) || info.f >= len(b.Filenames) {
+		return SourceRange{}, false
+	}
+	r := SourceRange{File: info.f, Start: info.s, Length: info.l, Jump: info.j}
+	if r.Jump == 0 {
+		r.Jump = '-'
+	}
+	return r, true
+}
+
+// Position returns the filename and line number (starting
+// at 1) of the source of the instruction at pc, which is
+// interpreted as it is by Range. Position returns an empty
+// filename if the pc does not map to any source.
+func (b *CompiledBundle) Position(c *CompiledContract, pc int, deployed bool) (string, int) {
+	r, ok := b.Range(c, pc, deployed)
+	if !ok {
+		return "", 0
+	}
+	return b.Filenames[r.File], 1 + strings.Count(b.Sources[r.File][:r.Start], "\n")
+}
+
 func compileError(errors []solcerror) error {
 	for i := range errors {
 		if errors[i].Type != "Warning" {
@@ -318,6 +417,9 @@ func cachename(sources []Source) string {
 		io.WriteString(h0, sources[i].Filename)
 		io.WriteString(h1, sources[i].Body)
 	}
+	// bundles cached before deployed code was
+	// part of the output must be compiled again
+	io.WriteString(h1, "deployed")
 	// filename is 'name hash'-'content hash'.bundle
 	// so that we can to a quick glob search to remove
 	// any stale bundles with the same name hash
@@ -877,6 +877,16 @@ func (z *CompiledContract) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "deployedcode":
+			z.DeployedCode, err = dc.ReadBytes(z.DeployedCode)
+			if err != nil {
+				return
+			}
+		case "deployedsourcemap":
+			z.DeployedSourcemap, err = dc.ReadString()
+			if err != nil {
+				return
+			}
 		case "abi":
 			var zb0002 uint32
 			zb0002, err = dc.ReadArrayHeader()
@@ -906,9 +916,9 @@ func (z *CompiledContract) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *CompiledContract) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 4
+	// map header, size 6
 	// write "name"
-	err = en.Append(0x84, 0xa4, 0x6e, 0x61, 0x6d, 0x65)
+	err = en.Append(0x86, 0xa4, 0x6e, 0x61, 0x6d, 0x65)
 	if err != nil {
 		return err
 	}
@@ -934,6 +944,24 @@ func (z *CompiledContract) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "deployedcode"
+	err = en.Append(0xac, 0x64, 0x65, 0x70, 0x6c, 0x6f, 0x79, 0x65, 0x64, 0x63, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.DeployedCode)
+	if err != nil {
+		return
+	}
+	// write "deployedsourcemap"
+	err = en.Append(0xb1, 0x64, 0x65, 0x70, 0x6c, 0x6f, 0x79, 0x65, 0x64, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x6d, 0x61, 0x70)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.DeployedSourcemap)
+	if err != nil {
+		return
+	}
 	// write "abi"
 	err = en.Append(0xa3, 0x61, 0x62, 0x69)
 	if err != nil {
@@ -955,9 +983,9 @@ func (z *CompiledContract) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z *CompiledContract) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 4
+	// map header, size 6
 	// string "name"
-	o = append(o, 0x84, 0xa4, 0x6e, 0x61, 0x6d, 0x65)
+	o = append(o, 0x86, 0xa4, 0x6e, 0x61, 0x6d, 0x65)
 	o = msgp.AppendString(o, z.Name)
 	// string "code"
 	o = append(o, 0xa4, 0x63, 0x6f, 0x64, 0x65)
@@ -965,6 +993,12 @@ func (z *CompiledContract) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "sourcemap"
 	o = append(o, 0xa9, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x6d, 0x61, 0x70)
 	o = msgp.AppendString(o, z.Sourcemap)
+	// string "deployedcode"
+	o = append(o, 0xac, 0x64, 0x65, 0x70, 0x6c, 0x6f, 0x79, 0x65, 0x64, 0x63, 0x6f, 0x64, 0x65)
+	o = msgp.AppendBytes(o, z.DeployedCode)
+	// string "deployedsourcemap"
+	o = append(o, 0xb1, 0x64, 0x65, 0x70, 0x6c, 0x6f, 0x79, 0x65, 0x64, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x6d, 0x61, 0x70)
+	o = msgp.AppendString(o, z.DeployedSourcemap)
 	// string "abi"
 	o = append(o, 0xa3, 0x61, 0x62, 0x69)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.ABI)))
@@ -1008,6 +1042,16 @@ func (z *CompiledContract) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "deployedcode":
+			z.DeployedCode, bts, err = msgp.ReadBytesBytes(bts, z.DeployedCode)
+			if err != nil {
+				return
+			}
+		case "deployedsourcemap":
+			z.DeployedSourcemap, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
 		case "abi":
 			var zb0002 uint32
 			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
@@ -1038,7 +1082,7 @@ func (z *CompiledContract) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CompiledContract) Msgsize() (s int) {
-	s = 1 + 5 + msgp.StringPrefixSize + len(z.Name) + 5 + msgp.BytesPrefixSize + len(z.Code) + 10 + msgp.StringPrefixSize + len(z.Sourcemap) + 4 + msgp.ArrayHeaderSize
+	s = 1 + 5 + msgp.StringPrefixSize + len(z.Name) + 5 + msgp.BytesPrefixSize + len(z.Code) + 10 + msgp.StringPrefixSize + len(z.Sourcemap) + 13 + msgp.BytesPrefixSize + len(z.DeployedCode) + 18 + msgp.StringPrefixSize + len(z.DeployedSourcemap) + 4 + msgp.ArrayHeaderSize
 	for za0001 := range z.ABI {
 		s += z.ABI[za0001].Msgsize()
 	}
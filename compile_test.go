@@ -1,7 +1,9 @@
 package seth
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -70,3 +72,45 @@ func TestParseInfo(t *testing.T) {
 		t.Errorf("%v != %v", c0.srcmap, c1.srcmap)
 	}
 }
+
+func TestPosition(t *testing.T) {
+	src := "contract A {\n\tfunction f() {\n\t\trequire(false);\n\t}\n}\n"
+	stmt := strings.Index(src, "require(false)")
+	b := &CompiledBundle{
+		Filenames: []string{"a.sol"},
+		Sources:   []string{src},
+		Contracts: []CompiledContract{{
+			Name: "A",
+			// PUSH1 0 DUP1 REVERT
+			DeployedCode:      []byte{0x60, 0x00, 0x80, 0xfd},
+			DeployedSourcemap: fmt.Sprintf("0:%d:0;%d:14;;-1:0:-1", len(src), stmt),
+		}},
+	}
+	c := &b.Contracts[0]
+	for _, tc := range []struct {
+		pc   int
+		file string
+		line int
+	}{
+		{0, "a.sol", 1},
+		{1, "a.sol", 1}, // PUSH1 argument
+		{2, "a.sol", 3},
+		{3, "a.sol", 3},
+		{4, "", 0}, // past the end of the code
+	} {
+		file, line := b.Position(c, tc.pc, true)
+		if file != tc.file || line != tc.line {
+			t.Errorf("pc %d: got %s:%d, want %s:%d", tc.pc, file, line, tc.file, tc.line)
+		}
+	}
+	if r, ok := b.Range(c, 3, true); !ok || r.File != 0 || r.Start != stmt || r.Length != 14 || r.Jump != '-' {
+		t.Errorf("unexpected range %+v", r)
+	}
+	// INVALID, which the sourcemap
+	// attributes to generated code
+	c.DeployedCode = append(c.DeployedCode, 0xfe)
+	c.dsrcmap = nil
+	if file, _ := b.Position(c, 4, true); file != "" {
+		t.Errorf("generated code mapped to %s", file)
+	}
+}
@@ -0,0 +1,447 @@
+// Package deposit detects incoming payments to
+// a set of addresses.
+//
+// A Watcher credits ether sent directly to a watched
+// address by a transaction, and ERC20 tokens sent to
+// a watched address, as reported by Transfer events.
+// Ether sent by internal calls (e.g. from a contract)
+// is not detected.
+package deposit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/philhofer/seth"
+	"github.com/philhofer/seth/cc"
+)
+
+// Deposit is a payment to a watched address.
+type Deposit struct {
+	Tx        seth.Hash
+	Block     int64
+	BlockHash seth.Hash
+	TxIndex   int64
+	// LogIndex is the index of the Transfer
+	// log, or -1 if the deposit is ether.
+	LogIndex int64
+	From     seth.Address
+	To       seth.Address
+	Amount   *cc.Amount
+}
+
+// ID returns a string that uniquely identifies
+// the deposit. Since deposits may be credited
+// more than once (see Watcher), it can be used
+// to make crediting idempotent.
+func (d *Deposit) ID() string {
+	if d.LogIndex < 0 {
+		return d.Tx.String()
+	}
+	return fmt.Sprintf("%s:%d", d.Tx.String(), d.LogIndex)
+}
+
+// Watcher credits deposits to a set of addresses
+// once they have been confirmed, and records its
+// progress in a CursorStore so that it resumes
+// where it left off when it is restarted.
+//
+// Deposits are credited at least once: if the watcher
+// stops while a block is partially processed, the deposits
+// in that block are credited again when it restarts.
+// Credit should use Deposit.ID to ignore duplicates.
+type Watcher struct {
+	Client *seth.Client
+
+	// Store holds the cursor. If it is nil,
+	// the cursor is only kept in memory.
+	Store seth.CursorStore
+
+	// Credit is called on every confirmed deposit, in
+	// chain order. If it returns an error, Run stops.
+	Credit func(d *Deposit) error
+
+	// Rollback, if non-nil, is called when a chain
+	// reorganization orphans blocks that have already
+	// been credited. It should reverse every deposit
+	// after 'to', which is the newest credited block
+	// that is still canonical. Reorgs this deep are
+	// avoided by choosing enough Confirmations.
+	Rollback func(to *seth.Cursor) error
+
+	// Tokens are the tokens that are credited. If it
+	// is empty, every token known to package cc is
+	// credited, and transfers of unknown tokens are ignored.
+	Tokens []cc.Currency
+
+	// Start is the first block to scan if the store is
+	// empty. It may be seth.Latest to start at the head
+	// of the chain.
+	Start int64
+
+	// Confirmations is the number of blocks that must be
+	// mined on top of a block before its deposits are credited.
+	Confirmations int64
+
+	// Batch is the maximum number of blocks scanned
+	// before the head of the chain is checked again.
+	// The default is 100.
+	Batch int64
+
+	// History is the maximum depth of a reorg that
+	// can be rolled back. The default is 128 blocks.
+	History int
+
+	// Interval is the polling interval once the watcher
+	// has caught up. The default is one second.
+	Interval time.Duration
+
+	// OnError, if non-nil, is called with every
+	// error returned by the Client that is retried.
+	OnError func(err error)
+
+	recent []seth.Cursor // recently saved cursors, oldest first
+
+	lock  sync.Mutex
+	addrs map[seth.Address]struct{}
+}
+
+// Watch adds addresses to the set of watched addresses.
+// It is safe to call Watch while the watcher is running;
+// the new addresses are watched from the next block that
+// is scanned.
+func (w *Watcher) Watch(addrs ...seth.Address) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.addrs == nil {
+		w.addrs = make(map[seth.Address]struct{}, len(addrs))
+	}
+	for i := range addrs {
+		w.addrs[addrs[i]] = struct{}{}
+	}
+}
+
+// Unwatch removes addresses from the set of watched addresses.
+func (w *Watcher) Unwatch(addrs ...seth.Address) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for i := range addrs {
+		delete(w.addrs, addrs[i])
+	}
+}
+
+func (w *Watcher) watched(a *seth.Address) bool {
+	w.lock.Lock()
+	_, ok := w.addrs[*a]
+	w.lock.Unlock()
+	return ok
+}
+
+// watching returns whether or not
+// any addresses are being watched
+func (w *Watcher) watching() bool {
+	w.lock.Lock()
+	n := len(w.addrs)
+	w.lock.Unlock()
+	return n > 0
+}
+
+func (w *Watcher) batch() int64 {
+	if w.Batch > 0 {
+		return w.Batch
+	}
+	return 100
+}
+
+func (w *Watcher) history() int {
+	if w.History > 0 {
+		return w.History
+	}
+	return 128
+}
+
+func (w *Watcher) interval() time.Duration {
+	if w.Interval > 0 {
+		return w.Interval
+	}
+	return time.Second
+}
+
+// token returns the currency of a token contract,
+// or false if transfers of the token are not credited
+func (w *Watcher) token(addr *seth.Address) (cc.Currency, bool) {
+	if len(w.Tokens) == 0 {
+		return cc.TokenByAddress(addr)
+	}
+	for _, t := range w.Tokens {
+		if a := t.Addr(); a != nil && *a == *addr {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// query returns the query for the token transfers in a
+// block, or nil if no addresses are watched. The recipients
+// are filtered by transfer rather than by the query, since
+// nodes limit the number of topics in a query.
+func (w *Watcher) query(block *seth.Hash) *seth.FilterQuery {
+	if !w.watching() {
+		return nil
+	}
+	q := &seth.FilterQuery{
+		BlockHash: block,
+		Topics:    [][]seth.Hash{{seth.ERC20Transfer}},
+	}
+	for _, t := range w.Tokens {
+		if a := t.Addr(); a != nil {
+			q.Addresses = append(q.Addresses, *a)
+		}
+	}
+	return q
+}
+
+// Run runs the watcher until 'stop' is closed or an error
+// occurs. Errors returned by the Client are passed to OnError
+// and retried after the polling interval, except for errors
+// that can't succeed on a retry (see seth.Transient), which
+// cause Run to return. Errors returned by Credit, Rollback,
+// or the Store cause Run to return, too. A reorg deeper than
+// History causes Run to return seth.ErrReorgTooDeep.
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	if w.Credit == nil {
+		return errors.New("deposit: Watcher.Credit is nil")
+	}
+	for _, t := range w.Tokens {
+		if !t.Exists() || !t.Token() {
+			return fmt.Errorf("deposit: %s is not a token", t)
+		}
+	}
+	if w.Store == nil {
+		w.Store = new(seth.MemStore)
+	}
+	cur, err := w.Store.Load()
+	if err != nil {
+		return err
+	}
+	// keep the window of recent cursors from a previous
+	// run unless the store has moved on without it
+	if cur == nil || len(w.recent) == 0 || w.recent[len(w.recent)-1] != *cur {
+		w.recent = w.recent[:0]
+		if cur != nil {
+			w.recent = append(w.recent, *cur)
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		more, err := w.step(&cur, stop)
+		if err != nil {
+			return err
+		}
+		if more {
+			continue
+		}
+		t := time.NewTimer(w.interval())
+		select {
+		case <-stop:
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// transfer returns the deposit described by a
+// Transfer log, or false if it isn't a deposit
+func (w *Watcher) transfer(l *seth.Log) (*Deposit, bool) {
+	if len(l.Topics) != 3 || !bytes.Equal(l.Topics[0], seth.ERC20Transfer[:]) ||
+		len(l.Topics[1]) != 32 || len(l.Topics[2]) != 32 || len(l.Data) != 32 {
+		return nil, false
+	}
+	if l.BlockNumber == nil || l.BlockHash == nil || l.TxHash == nil ||
+		l.TxIndex == nil || l.LogIndex == nil {
+		return nil, false
+	}
+	d := &Deposit{
+		Tx:        *l.TxHash,
+		Block:     int64(*l.BlockNumber),
+		BlockHash: *l.BlockHash,
+		TxIndex:   int64(*l.TxIndex),
+		LogIndex:  int64(*l.LogIndex),
+	}
+	copy(d.From[:], l.Topics[1][12:])
+	copy(d.To[:], l.Topics[2][12:])
+	if !w.watched(&d.To) {
+		return nil, false
+	}
+	tok, ok := w.token(&l.Address)
+	if !ok {
+		return nil, false
+	}
+	d.Amount = &cc.Amount{Currency: tok}
+	d.Amount.Amount.SetBytes(l.Data)
+	return d, true
+}
+
+// ether returns the deposits made by the
+// value of the transactions in a block
+func (w *Watcher) ether(b *seth.Block) ([]*Deposit, error) {
+	txs, err := b.ParseTransactions()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Deposit
+	for i := range txs {
+		tx := &txs[i]
+		if tx.To == nil || tx.From == nil || tx.Value.IsZero() || !w.watched(tx.To) {
+			continue
+		}
+		// a failed transaction transfers no value
+		rx, err := w.Client.GetReceipt(&tx.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if rx.BlockHash != *b.Hash {
+			return nil, fmt.Errorf("deposit: receipt of %s is not in block %s", tx.Hash.String(), b.Hash.String())
+		}
+		if rx.Threw() {
+			continue
+		}
+		d := &Deposit{
+			Tx:        tx.Hash,
+			Block:     int64(*b.Number),
+			BlockHash: *b.Hash,
+			TxIndex:   int64(rx.Index),
+			LogIndex:  -1,
+			From:      *tx.From,
+			To:        *tx.To,
+			Amount:    &cc.Amount{Currency: cc.ETH},
+		}
+		d.Amount.Amount.Set(tx.Value.Big())
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// retry reports an error returned by the Client,
+// returning it if retrying the request is pointless
+func (w *Watcher) retry(err error) (bool, error) {
+	if !seth.Transient(err) {
+		return false, err
+	}
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+	return false, nil
+}
+
+// step credits the next batch of blocks, returning
+// whether or not there may be more blocks to scan
+func (w *Watcher) step(cur **seth.Cursor, stop <-chan struct{}) (bool, error) {
+	c := w.Client
+	head, err := c.BlockNumber()
+	if err != nil {
+		return w.retry(err)
+	}
+	safe := head - w.Confirmations
+	var next int64
+	switch {
+	case *cur != nil:
+		next = (*cur).Block + 1
+	case w.Start < 0:
+		next = safe
+	default:
+		next = w.Start
+	}
+	if next > safe {
+		return false, nil
+	}
+	to := next + w.batch() - 1
+	if to > safe {
+		to = safe
+	}
+
+	for n := next; n <= to; n++ {
+		select {
+		case <-stop:
+			return false, nil
+		default:
+		}
+		b, err := c.GetBlock(n, true)
+		if err != nil {
+			return w.retry(err)
+		} else if b.Number == nil || b.Hash == nil {
+			return false, nil
+		}
+		if *cur != nil && b.Parent != (*cur).Hash {
+			return w.reorg(cur)
+		}
+		deps, err := w.ether(b)
+		if err != nil {
+			return w.retry(err)
+		}
+		// query by block hash so that the logs
+		// are guaranteed to belong to this block
+		if q := w.query(b.Hash); q != nil {
+			logs, err := c.Logs(q)
+			if err != nil && err != seth.ErrNotFound {
+				return w.retry(err)
+			}
+			for i := range logs {
+				if d, ok := w.transfer(&logs[i]); ok {
+					deps = append(deps, d)
+				}
+			}
+		}
+		sort.Slice(deps, func(i, j int) bool {
+			if deps[i].TxIndex != deps[j].TxIndex {
+				return deps[i].TxIndex < deps[j].TxIndex
+			}
+			return deps[i].LogIndex < deps[j].LogIndex
+		})
+		for _, d := range deps {
+			if err := w.Credit(d); err != nil {
+				return false, err
+			}
+		}
+		if err := w.save(cur, n, b.Hash); err != nil {
+			return false, err
+		}
+	}
+	return to < safe, nil
+}
+
+func (w *Watcher) save(cur **seth.Cursor, block int64, hash *seth.Hash) error {
+	c := &seth.Cursor{Block: block, Hash: *hash}
+	if err := w.Store.Save(c); err != nil {
+		return err
+	}
+	*cur = c
+	w.recent = seth.Remember(w.recent, c, w.history())
+	return nil
+}
+
+// reorg finds the newest credited block that is still
+// canonical, rolls back to it, and moves the cursor there
+func (w *Watcher) reorg(cur **seth.Cursor) (bool, error) {
+	at, err := w.Client.Rewind(w.recent, w.history())
+	if err == seth.ErrReorgTooDeep {
+		return false, err
+	} else if err != nil {
+		return w.retry(err)
+	}
+	if w.Rollback != nil {
+		if err := w.Rollback(at); err != nil {
+			return false, err
+		}
+	}
+	return true, w.save(cur, at.Block, &at.Hash)
+}
@@ -0,0 +1,446 @@
+package deposit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philhofer/seth"
+	"github.com/philhofer/seth/cc"
+)
+
+var (
+	tok     = cc.NewToken("DEPOSITTEST", 2, "0x00000000000000000000000000000000000000dd")
+	unknown = seth.Address{0xde}
+)
+
+// pay describes a payment made in a block
+type pay struct {
+	to    seth.Address
+	value int64
+	token *seth.Address // nil for ether
+	fail  bool
+}
+
+type block struct {
+	hash, parent seth.Hash
+	txs          []seth.Transaction
+	logs         []seth.Log
+	failed       map[seth.Hash]bool
+}
+
+// chain is a transport that serves a chain of blocks
+// containing payments, and which can be reorganized
+type chain struct {
+	lock   sync.Mutex
+	blocks []*block             // canonical blocks by number
+	all    map[seth.Hash]*block // every block, including orphans
+	txs    map[seth.Hash]int64  // block numbers of canonical transactions
+	forks  int
+	hide   bool  // don't serve orphaned blocks by hash
+	fail   error // error returned by eth_getLogs
+}
+
+func word(dst []byte, v int64) {
+	b := big.NewInt(v).Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+func (c *chain) mine(pays ...pay) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.all == nil {
+		c.all = make(map[seth.Hash]*block)
+		c.txs = make(map[seth.Hash]int64)
+	}
+	n := len(c.blocks)
+	b := &block{
+		hash:   seth.HashString(fmt.Sprintf("%d/%d", n, c.forks)),
+		failed: make(map[seth.Hash]bool),
+	}
+	if n > 0 {
+		b.parent = c.blocks[n-1].hash
+	}
+	from := seth.Address{0xff}
+	for i, p := range pays {
+		num, idx := seth.Uint64(n), seth.Uint64(i)
+		tx := seth.Transaction{
+			Hash:        seth.HashString(fmt.Sprintf("%s/%d", b.hash.String(), i)),
+			BlockNumber: num,
+			TxIndex:     &idx,
+			From:        &from,
+		}
+		if p.token == nil {
+			to := p.to
+			tx.To = &to
+			tx.Value.SetInt64(p.value)
+		} else {
+			tx.To = p.token
+			var f, t, v seth.Hash
+			copy(f[12:], from[:])
+			copy(t[12:], p.to[:])
+			word(v[:], p.value)
+			lidx := seth.Uint64(len(b.logs))
+			h := tx.Hash
+			b.logs = append(b.logs, seth.Log{
+				Address:     *p.token,
+				Topics:      []seth.Data{seth.ERC20Transfer[:], f[:], t[:]},
+				Data:        v[:],
+				BlockNumber: &num,
+				BlockHash:   &b.hash,
+				TxHash:      &h,
+				TxIndex:     &idx,
+				LogIndex:    &lidx,
+			})
+		}
+		b.failed[tx.Hash] = p.fail
+		b.txs = append(b.txs, tx)
+		c.txs[tx.Hash] = int64(n)
+	}
+	c.blocks = append(c.blocks, b)
+	c.all[b.hash] = b
+}
+
+// reorg removes the top 'depth' blocks
+func (c *chain) reorg(depth int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	c.forks++
+}
+
+// matches returns whether or not l is produced
+// by one of addrs (if any) and matches the topics
+// of a JSON filter object
+func matches(l *seth.Log, addrs []seth.Address, topics []json.RawMessage) bool {
+	found := len(addrs) == 0
+	for i := range addrs {
+		found = found || addrs[i] == l.Address
+	}
+	if !found || len(l.Topics) < len(topics) {
+		return false
+	}
+	for i := range topics {
+		if len(topics[i]) == 0 || string(topics[i]) == "null" {
+			continue
+		}
+		var want []seth.Hash
+		if err := json.Unmarshal(topics[i], &want); err != nil {
+			want = []seth.Hash{{}}
+			json.Unmarshal(topics[i], &want[0])
+		}
+		ok := false
+		for j := range want {
+			ok = ok || bytes.Equal(want[j][:], l.Topics[i])
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *chain) Execute(req *seth.RPCRequest, res *seth.RPCResponse) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res.ID = req.ID
+	header := func(n int, b *block) map[string]interface{} {
+		return map[string]interface{}{
+			"number":       seth.Uint64(n),
+			"hash":         b.hash,
+			"parentHash":   b.parent,
+			"transactions": b.txs,
+		}
+	}
+	switch req.Method {
+	case "eth_blockNumber":
+		res.Result, _ = json.Marshal(seth.Uint64(len(c.blocks) - 1))
+	case "eth_getBlockByNumber":
+		var n seth.Uint64
+		json.Unmarshal(req.Params[0], &n)
+		if int(n) >= len(c.blocks) {
+			res.Result = json.RawMessage("null")
+			return nil
+		}
+		res.Result, _ = json.Marshal(header(int(n), c.blocks[n]))
+	case "eth_getBlockByHash":
+		var h seth.Hash
+		json.Unmarshal(req.Params[0], &h)
+		b, ok := c.all[h]
+		if ok && c.hide {
+			ok = false
+			for i := range c.blocks {
+				ok = ok || c.blocks[i] == b
+			}
+		}
+		if !ok {
+			res.Result = json.RawMessage("null")
+			return nil
+		}
+		res.Result, _ = json.Marshal(header(0, b))
+	case "eth_getLogs":
+		if c.fail != nil {
+			return c.fail
+		}
+		var q struct {
+			BlockHash seth.Hash         `json:"blockHash"`
+			Address   json.RawMessage   `json:"address"`
+			Topics    []json.RawMessage `json:"topics"`
+		}
+		json.Unmarshal(req.Params[0], &q)
+		b, ok := c.all[q.BlockHash]
+		if !ok {
+			return fmt.Errorf("unknown block %s", q.BlockHash.String())
+		}
+		var addrs []seth.Address
+		if len(q.Address) > 0 {
+			if err := json.Unmarshal(q.Address, &addrs); err != nil {
+				addrs = []seth.Address{{}}
+				json.Unmarshal(q.Address, &addrs[0])
+			}
+		}
+		logs := []seth.Log{}
+		for _, l := range b.logs {
+			if matches(&l, addrs, q.Topics) {
+				logs = append(logs, l)
+			}
+		}
+		res.Result, _ = json.Marshal(logs)
+	case "eth_getTransactionReceipt":
+		var h seth.Hash
+		json.Unmarshal(req.Params[0], &h)
+		n, ok := c.txs[h]
+		if !ok || int(n) >= len(c.blocks) {
+			res.Result = json.RawMessage("null")
+			return nil
+		}
+		b := c.blocks[n]
+		for i := range b.txs {
+			if b.txs[i].Hash != h {
+				continue
+			}
+			status := seth.Uint64(1)
+			if b.failed[h] {
+				status = 0
+			}
+			res.Result, _ = json.Marshal(map[string]interface{}{
+				"transactionHash":  h,
+				"transactionIndex": b.txs[i].TxIndex,
+				"blockHash":        b.hash,
+				"blockNumber":      seth.Uint64(n),
+				"status":           status,
+			})
+			return nil
+		}
+		res.Result = json.RawMessage("null")
+	default:
+		return fmt.Errorf("unexpected method %s", req.Method)
+	}
+	return nil
+}
+
+// stopAt is a CursorStore that closes
+// a channel when a block is saved
+type stopAt struct {
+	seth.CursorStore
+	block int64
+	stop  chan struct{}
+}
+
+func (s *stopAt) Save(c *seth.Cursor) error {
+	if err := s.CursorStore.Save(c); err != nil {
+		return err
+	}
+	if c.Block == s.block {
+		close(s.stop)
+	}
+	return nil
+}
+
+func run(t *testing.T, w *Watcher, block int64) {
+	t.Helper()
+	store := w.Store
+	if s, ok := store.(*stopAt); ok {
+		store = s.CursorStore
+	}
+	s := &stopAt{CursorStore: store, block: block, stop: make(chan struct{})}
+	w.Store = s
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(s.stop) }()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deposit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := seth.FileStore(filepath.Join(dir, "cursor"))
+
+	alice, bob, carol := seth.Address{1}, seth.Address{2}, seth.Address{3}
+	c := new(chain)
+	c.mine()
+	c.mine(pay{to: alice, value: 1e18})
+	c.mine(
+		pay{to: carol, value: 5},             // not watched
+		pay{to: alice, value: 7, fail: true}, // reverted
+		pay{to: bob, value: 500, token: tok.Addr()},
+		pay{to: carol, value: 9, token: tok.Addr()}, // not watched
+	)
+	c.mine(pay{to: alice, value: 100, token: &unknown})
+	c.mine(pay{to: bob, value: 2e18})
+	c.mine()
+
+	var got []string
+	credit := func(d *Deposit) error {
+		got = append(got, fmt.Sprintf("%d %x %s", d.Block, d.To[:1], d.Amount))
+		return nil
+	}
+	newWatcher := func() *Watcher {
+		w := &Watcher{
+			Client:        seth.NewClientTransport(c),
+			Store:         store,
+			Credit:        credit,
+			Confirmations: 2,
+			Batch:         2,
+			Interval:      time.Millisecond,
+		}
+		w.Watch(alice, bob)
+		return w
+	}
+
+	// blocks 0 through 3 have two confirmations
+	run(t, newWatcher(), 3)
+	want := []string{
+		"1 01 1.000000000000000000 ETH",
+		"2 02 5.00 DEPOSITTEST",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// a restarted watcher picks up at block 4
+	c.mine()
+	c.mine()
+	run(t, newWatcher(), 5)
+	want = append(want, "4 02 2.000000000000000000 ETH")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatcherRollback(t *testing.T) {
+	alice := seth.Address{1}
+	c := new(chain)
+	c.mine()
+	c.mine(pay{to: alice, value: 1, token: tok.Addr()})
+	c.mine(pay{to: alice, value: 2, token: tok.Addr()})
+	c.mine(pay{to: alice, value: 3, token: tok.Addr()})
+
+	var got []string
+	var rollbacks []int64
+	w := &Watcher{
+		Client: seth.NewClientTransport(c),
+		Store:  new(seth.MemStore),
+		Tokens: []cc.Currency{tok},
+		Credit: func(d *Deposit) error {
+			got = append(got, fmt.Sprintf("%d %s", d.Block, d.Amount))
+			return nil
+		},
+		Rollback: func(to *seth.Cursor) error {
+			rollbacks = append(rollbacks, to.Block)
+			// blocks 1 and up each have one deposit
+			got = got[:to.Block]
+			return nil
+		},
+		Interval: time.Millisecond,
+	}
+	w.Watch(alice)
+	run(t, w, 3)
+
+	// replace blocks 2 and 3
+	c.reorg(2)
+	c.mine(pay{to: alice, value: 4, token: tok.Addr()})
+	c.mine()
+	c.mine(pay{to: alice, value: 5, token: tok.Addr()})
+	run(t, w, 4)
+	if len(rollbacks) != 1 || rollbacks[0] != 1 {
+		t.Fatalf("unexpected rollbacks %v", rollbacks)
+	}
+	want := []string{"1 0.01 DEPOSITTEST", "2 0.04 DEPOSITTEST", "4 0.05 DEPOSITTEST"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatcherHiddenOrphans(t *testing.T) {
+	alice := seth.Address{1}
+	c := &chain{hide: true}
+	c.mine()
+	c.mine(pay{to: alice, value: 1, token: tok.Addr()})
+	c.mine(pay{to: alice, value: 2, token: tok.Addr()})
+
+	var rollbacks []int64
+	w := &Watcher{
+		Client:   seth.NewClientTransport(c),
+		Store:    new(seth.MemStore),
+		Credit:   func(d *Deposit) error { return nil },
+		Rollback: func(to *seth.Cursor) error { rollbacks = append(rollbacks, to.Block); return nil },
+		Interval: time.Millisecond,
+	}
+	w.Watch(alice)
+	run(t, w, 2)
+
+	// the orphaned block 2 can't be fetched by hash,
+	// so the watcher falls back to the block before it
+	c.reorg(1)
+	c.mine()
+	c.mine()
+	run(t, w, 3)
+	if len(rollbacks) != 1 || rollbacks[0] != 1 {
+		t.Fatalf("unexpected rollbacks %v", rollbacks)
+	}
+}
+
+func TestWatcherErrors(t *testing.T) {
+	alice := seth.Address{1}
+	c := new(chain)
+	c.mine(pay{to: alice, value: 1, token: tok.Addr()})
+	c.fail = fmt.Errorf("connection reset")
+
+	var retried []error
+	w := &Watcher{
+		Client:   seth.NewClientTransport(c),
+		Credit:   func(d *Deposit) error { return nil },
+		Interval: time.Millisecond,
+		OnError: func(err error) {
+			retried = append(retried, err)
+			if len(retried) == 2 {
+				c.fail = &seth.RPCError{Code: -32602, Message: "invalid params"}
+			}
+		},
+	}
+	w.Watch(alice)
+	err := w.Run(nil)
+	if re, ok := err.(*seth.RPCError); !ok || re.Code != -32602 {
+		t.Fatal("expected an invalid params error; got", err)
+	}
+	if len(retried) != 2 {
+		t.Fatalf("retried %v", retried)
+	}
+}
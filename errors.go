@@ -0,0 +1,195 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Classified RPC errors. An *RPCError returned by the
+// server can be compared against these with errors.Is, e.g.
+//
+//	if errors.Is(err, seth.ErrNonceTooLow) {
+//		// pick a new nonce
+//	}
+var (
+	ErrNonceTooLow            = errors.New("seth: nonce too low")
+	ErrNonceTooHigh           = errors.New("seth: nonce too high")
+	ErrReplacementUnderpriced = errors.New("seth: replacement transaction underpriced")
+	ErrUnderpriced            = errors.New("seth: transaction underpriced")
+	ErrInsufficientFunds      = errors.New("seth: insufficient funds")
+	ErrIntrinsicGas           = errors.New("seth: intrinsic gas too low")
+	ErrGasLimit               = errors.New("seth: exceeds block gas limit")
+	ErrAlreadyKnown           = errors.New("seth: transaction already known")
+	ErrTxPoolFull             = errors.New("seth: transaction pool full")
+	ErrExecutionReverted      = errors.New("seth: execution reverted")
+	ErrLimitExceeded          = errors.New("seth: query limit exceeded")
+)
+
+// errclasses maps (lower-case) substrings of error messages
+// produced by geth, erigon, and nethermind to sentinel errors.
+// Order matters: the first match wins.
+var errclasses = []struct {
+	substr string
+	err    error
+}{
+	{"nonce too low", ErrNonceTooLow},
+	{"oldnonce", ErrNonceTooLow},
+	{"nonce too high", ErrNonceTooHigh},
+	{"noncegap", ErrNonceTooHigh},
+	{"replacement transaction underpriced", ErrReplacementUnderpriced},
+	{"replacementnotallowed", ErrReplacementUnderpriced},
+	{"transaction underpriced", ErrUnderpriced},
+	{"less than block base fee", ErrUnderpriced},
+	{"feetoolow", ErrUnderpriced},
+	{"insufficient funds", ErrInsufficientFunds},
+	{"insufficientfunds", ErrInsufficientFunds},
+	{"intrinsic gas too low", ErrIntrinsicGas},
+	{"exceeds block gas limit", ErrGasLimit},
+	{"gaslimitexceeded", ErrGasLimit},
+	{"already known", ErrAlreadyKnown},
+	{"known transaction", ErrAlreadyKnown},
+	{"alreadyknown", ErrAlreadyKnown},
+	{"already imported", ErrAlreadyKnown},
+	{"txpool is full", ErrTxPoolFull},
+	{"query returned more than", ErrLimitExceeded},
+	{"response size exceeded", ErrLimitExceeded},
+	{"exceed maximum block range", ErrLimitExceeded},
+	{"block range is too wide", ErrLimitExceeded},
+	{"block range too large", ErrLimitExceeded},
+	{"block range is too large", ErrLimitExceeded},
+	{"too many results", ErrLimitExceeded},
+	{"execution reverted", ErrExecutionReverted},
+	{"transaction reverted", ErrExecutionReverted},
+}
+
+// Class returns the sentinel error that describes e,
+// or nil if the error is not recognized.
+func (e *RPCError) Class() error {
+	// geth and erigon use code 3 for reverts that carry data
+	if e.Code == 3 {
+		return ErrExecutionReverted
+	}
+	msg := strings.ToLower(e.Message)
+	for i := range errclasses {
+		if strings.Contains(msg, errclasses[i].substr) {
+			return errclasses[i].err
+		}
+	}
+	// infura uses -32005 both for query limits and for
+	// rate limits, so the message has to be checked as well
+	if e.Code == -32005 && strings.Contains(msg, "limit exceeded") && !strings.Contains(msg, "rate") {
+		return ErrLimitExceeded
+	}
+	// nethermind reports reverts as "VM execution error."
+	// with the payload in the data
+	if bytes.HasPrefix(e.Data, []byte(`"Reverted`)) {
+		return ErrExecutionReverted
+	}
+	return nil
+}
+
+// Is implements the interface used by errors.Is,
+// so that an *RPCError matches its Class.
+func (e *RPCError) Is(target error) bool {
+	c := e.Class()
+	return c != nil && c == target
+}
+
+// Transient returns whether or not a request that failed
+// with err may succeed if it is retried. Errors reported by
+// the server for requests that it can never serve (unknown
+// methods, invalid parameters, and queries that exceed its
+// limits) are not transient; everything else is.
+func Transient(err error) bool {
+	var re *RPCError
+	if !errors.As(err, &re) {
+		return true
+	}
+	switch re.Code {
+	case -32601, -32602:
+		return false
+	}
+	return re.Class() != ErrLimitExceeded
+}
+
+// RevertData returns the revert payload carried by
+// the error, if any. Nodes place the payload either
+// directly in the error data as a hex string, in a
+// "Reverted 0x..." string (nethermind), or in a
+// nested object with a "data" field.
+func (e *RPCError) RevertData() ([]byte, bool) {
+	if len(e.Data) == 0 || bytes.Equal(e.Data, rawnull) {
+		return nil, false
+	}
+	var s string
+	if json.Unmarshal(e.Data, &s) != nil {
+		var obj struct {
+			Data string `json:"data"`
+		}
+		if json.Unmarshal(e.Data, &obj) != nil {
+			return nil, false
+		}
+		s = obj.Data
+	}
+	s = strings.TrimPrefix(s, "Reverted ")
+	if !strings.HasPrefix(s, "0x") {
+		return nil, false
+	}
+	buf, err := hexparse([]byte(s))
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// RevertReason returns the decoded revert reason
+// carried by the error, if any. See DecodeRevert.
+func (e *RPCError) RevertReason() (string, bool) {
+	data, ok := e.RevertData()
+	if !ok {
+		return "", false
+	}
+	return DecodeRevert(data)
+}
+
+var (
+	revertError = [4]byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	revertPanic = [4]byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// DecodeRevert decodes a revert payload produced by
+// Solidity's require() or revert() (an ABI-encoded
+// Error(string)) or by a failed assertion or arithmetic
+// check (Panic(uint256)). Panics are returned as
+// "panic: 0x<code>".
+func DecodeRevert(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	body := data[4:]
+	switch {
+	case bytes.Equal(data[:4], revertError[:]):
+		if len(body) < 64 {
+			return "", false
+		}
+		off := new(big.Int).SetBytes(body[:32])
+		if !off.IsInt64() || off.Int64() > int64(len(body)-32) {
+			return "", false
+		}
+		start := int(off.Int64())
+		size := new(big.Int).SetBytes(body[start : start+32])
+		if !size.IsInt64() || size.Int64() > int64(len(body)-start-32) {
+			return "", false
+		}
+		return string(body[start+32 : start+32+int(size.Int64())]), true
+	case bytes.Equal(data[:4], revertPanic[:]):
+		if len(body) < 32 {
+			return "", false
+		}
+		return "panic: 0x" + new(big.Int).SetBytes(body[:32]).Text(16), true
+	}
+	return "", false
+}
@@ -0,0 +1,149 @@
+package seth
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		err  RPCError
+		want error
+	}{
+		{RPCError{Code: -32000, Message: "nonce too low"}, ErrNonceTooLow},
+		{RPCError{Code: -32010, Message: "OldNonce"}, ErrNonceTooLow},
+		{RPCError{Code: -32000, Message: "replacement transaction underpriced"}, ErrReplacementUnderpriced},
+		{RPCError{Code: -32000, Message: "transaction underpriced"}, ErrUnderpriced},
+		{RPCError{Code: -32000, Message: "insufficient funds for gas * price + value"}, ErrInsufficientFunds},
+		{RPCError{Code: -32000, Message: "already known"}, ErrAlreadyKnown},
+		{RPCError{Code: -32010, Message: "AlreadyKnown"}, ErrAlreadyKnown},
+		{RPCError{Code: 3, Message: "execution reverted: nope"}, ErrExecutionReverted},
+		{RPCError{Code: -32015, Message: "VM execution error.", Data: json.RawMessage(`"Reverted 0x"`)}, ErrExecutionReverted},
+		{RPCError{Code: -32005, Message: "query returned more than 10000 results"}, ErrLimitExceeded},
+		{RPCError{Code: -32000, Message: "exceed maximum block range: 5000"}, ErrLimitExceeded},
+		{RPCError{Code: -32000, Message: "block range is too wide"}, ErrLimitExceeded},
+		{RPCError{Code: -32005, Message: "Limit exceeded"}, ErrLimitExceeded},
+		{RPCError{Code: -32005, Message: "project ID request rate limit exceeded"}, nil},
+		{RPCError{Code: 429, Message: "rate limit exceeded"}, nil},
+		{RPCError{Code: -32000, Message: "gas limit exceeded"}, nil},
+		{RPCError{Code: -32601, Message: "the method eth_foo does not exist"}, nil},
+		{RPCError{Code: -32000, Message: "invalid block range params"}, nil},
+		{RPCError{Code: -32000, Message: "contract creation code storage out of gas (reverted state)"}, nil},
+	}
+	for i := range cases {
+		if got := cases[i].err.Class(); got != cases[i].want {
+			t.Errorf("%q: got %v; wanted %v", cases[i].err.Message, got, cases[i].want)
+		}
+	}
+
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.Error = RPCError{Code: -32000, Message: "nonce too low"}
+		return nil
+	}))
+	_, err := c.RawCall([]byte{0x80})
+	if !errors.Is(err, ErrNonceTooLow) || errors.Is(err, ErrNonceTooHigh) {
+		t.Errorf("errors.Is failed for %v", err)
+	}
+}
+
+func TestRevertReason(t *testing.T) {
+	t.Parallel()
+	// revert("no")
+	const data = "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"6e6f000000000000000000000000000000000000000000000000000000000000"
+	for _, raw := range []string{
+		`"` + data + `"`,
+		`"Reverted ` + data + `"`,
+		`{"data":"` + data + `"}`,
+	} {
+		e := &RPCError{Code: 3, Message: "execution reverted: no", Data: json.RawMessage(raw)}
+		reason, ok := e.RevertReason()
+		if !ok || reason != "no" {
+			t.Errorf("%s: got %q %v", raw, reason, ok)
+		}
+	}
+	panicdata, _ := hexparse([]byte("0x4e487b71" +
+		"0000000000000000000000000000000000000000000000000000000000000011"))
+	if reason, ok := DecodeRevert(panicdata); !ok || reason != "panic: 0x11" {
+		t.Errorf("got %q %v", reason, ok)
+	}
+	if _, ok := DecodeRevert([]byte{0x08, 0xc3, 0x79, 0xa0, 0xff}); ok {
+		t.Error("decoded a truncated payload")
+	}
+}
+
+func TestSenderNonceRetry(t *testing.T) {
+	t.Parallel()
+	key := GenPrivateKey()
+	sends := 0
+	known := false
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		switch req.Method {
+		case "eth_getTransactionCount":
+			res.Result = itox(4)
+		case "eth_sendRawTransaction":
+			sends++
+			var raw Data
+			json.Unmarshal(req.Params[0], &raw)
+			switch {
+			case sends <= 2:
+				res.Error = RPCError{Code: -32000, Message: "nonce too low"}
+			case known:
+				res.Error = RPCError{Code: -32000, Message: "already known"}
+			default:
+				h := HashBytes(raw)
+				res.Result = json.RawMessage(`"` + h.String() + `"`)
+			}
+		default:
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		return nil
+	}))
+	var signed []Hash
+	s := NewSender(c, key.Address())
+	s.Signer = func(h *Hash) (*Signature, error) {
+		signed = append(signed, *h)
+		return key.Sign(h), nil
+	}
+	opts := CallOpts{To: key.Address(), Gas: NewInt(21000)}
+	h, err := s.Call(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed) != 3 {
+		t.Fatalf("expected 3 signatures; got %d", len(signed))
+	}
+	for i, n := range []Uint64{4, 5, 6} {
+		tx := opts.Transaction()
+		tx.Nonce = n
+		if *tx.HashToSign() != signed[i] {
+			t.Errorf("attempt %d did not use nonce %d", i, n)
+		}
+	}
+
+	// re-sending the same transaction should
+	// produce the same hash, not an error
+	known = true
+	n := Uint64(6)
+	opts.Nonce = &n
+	h2, err := s.Call(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2 != h {
+		t.Errorf("hash %s != %s", h2.String(), h.String())
+	}
+
+	// explicit nonces are never changed
+	sends = 0
+	if _, err := s.Call(&opts); !errors.Is(err, ErrNonceTooLow) {
+		t.Error("expected ErrNonceTooLow; got", err)
+	}
+	if sends != 1 {
+		t.Errorf("explicit nonce sent %d times", sends)
+	}
+}
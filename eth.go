@@ -0,0 +1,180 @@
+package seth
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// ChainID returns the chain ID used for
+// transaction signing (EIP-155).
+func (c *Client) ChainID() (int64, error) {
+	var id Uint64
+	if err := c.Do("eth_chainId", nil, &id); err != nil {
+		return 0, err
+	}
+	return int64(id), nil
+}
+
+// NetVersion returns the network ID of the node.
+func (c *Client) NetVersion() (string, error) {
+	var version string
+	if err := c.Do("net_version", nil, &version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// ClientVersion returns the client software version of the node.
+func (c *Client) ClientVersion() (string, error) {
+	var version string
+	if err := c.Do("web3_clientVersion", nil, &version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+func txsflag(txs bool) json.RawMessage {
+	if txs {
+		return rawtrue
+	}
+	return rawfalse
+}
+
+// GetBlockByHash gets a block by its hash. If 'txs' is true,
+// the block includes all the transactions in the block; otherwise
+// it only includes the transaction hashes.
+func (c *Client) GetBlockByHash(h *Hash, txs bool) (*Block, error) {
+	buf, _ := json.Marshal(h)
+	out := new(Block)
+	err := c.Do("eth_getBlockByHash", []json.RawMessage{buf, txsflag(txs)}, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetTransactionByIndex gets the transaction at
+// the given index within the given block.
+func (c *Client) GetTransactionByIndex(blocknum int64, index int) (*Transaction, error) {
+	params := []json.RawMessage{itobs(blocknum), itox(int64(index))}
+	o := new(Transaction)
+	err := c.Do("eth_getTransactionByBlockNumberAndIndex", params, o)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetBlockTransactionCount gets the number of
+// transactions in the given block.
+func (c *Client) GetBlockTransactionCount(blocknum int64) (int, error) {
+	var n Uint64
+	err := c.Do("eth_getBlockTransactionCountByNumber", []json.RawMessage{itobs(blocknum)}, &n)
+	return int(n), err
+}
+
+// GetUncle gets the uncle at the given index within
+// the block with the given hash. Uncles never include
+// transactions.
+func (c *Client) GetUncle(h *Hash, index int) (*Block, error) {
+	buf, _ := json.Marshal(h)
+	out := new(Block)
+	err := c.Do("eth_getUncleByBlockHashAndIndex", []json.RawMessage{buf, itox(int64(index))}, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetLogs returns the logs that match the given topics and address
+// in the given (inclusive) range of blocks, without installing a filter.
+// The arguments are interpreted as in FilterTopics, except that 'start'
+// and 'end' are block specifiers, so Latest, Pending and Earliest
+// may be used.
+func (c *Client) GetLogs(topics []*Hash, addr *Address, start, end int64) ([]Log, error) {
+	return c.Logs(query(topics, addr, start, end))
+}
+
+// FeeHistory is the result of eth_feeHistory.
+type FeeHistory struct {
+	OldestBlock  Uint64    `json:"oldestBlock"`
+	BaseFee      []Int     `json:"baseFeePerGas"` // base fee per block, plus the next block
+	GasUsedRatio []float64 `json:"gasUsedRatio"`
+	Reward       [][]Int   `json:"reward"` // priority fees at the requested percentiles, per block
+}
+
+// FeeHistory returns the fee history of the 'blocks' blocks
+// ending at block 'newest'. The priority fees paid at each of the
+// given percentiles (from 0 to 100, increasing) are included in
+// the Reward field of the result.
+func (c *Client) FeeHistory(blocks int, newest int64, percentiles []float64) (*FeeHistory, error) {
+	pbuf := []byte{'['}
+	for i := range percentiles {
+		if i != 0 {
+			pbuf = append(pbuf, ',')
+		}
+		pbuf = strconv.AppendFloat(pbuf, percentiles[i], 'f', -1, 64)
+	}
+	pbuf = append(pbuf, ']')
+	params := []json.RawMessage{itox(int64(blocks)), itobs(newest), pbuf}
+	out := new(FeeHistory)
+	if err := c.Do("eth_feeHistory", params, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MaxPriorityFeePerGas gets the node's suggested
+// priority fee (tip) for dynamic-fee transactions, in wei.
+func (c *Client) MaxPriorityFeePerGas() (int64, error) {
+	var wei Uint64
+	if err := c.Do("eth_maxPriorityFeePerGas", nil, &wei); err != nil {
+		return 0, err
+	}
+	return int64(wei), nil
+}
+
+// StorageProof is a Merkle proof of a storage slot.
+type StorageProof struct {
+	Key   Data   `json:"key"`
+	Value Int    `json:"value"`
+	Proof []Data `json:"proof"`
+}
+
+// AccountProof is the result of eth_getProof (EIP-1186).
+type AccountProof struct {
+	Address      Address        `json:"address"`
+	AccountProof []Data         `json:"accountProof"`
+	Balance      Int            `json:"balance"`
+	CodeHash     Hash           `json:"codeHash"`
+	Nonce        Uint64         `json:"nonce"`
+	StorageHash  Hash           `json:"storageHash"`
+	StorageProof []StorageProof `json:"storageProof"`
+}
+
+// GetProof gets a Merkle proof of the given account
+// and storage slots at the given block.
+func (c *Client) GetProof(addr *Address, keys []Hash, blocknum int64) (*AccountProof, error) {
+	abuf, _ := json.Marshal(addr)
+	if keys == nil {
+		keys = []Hash{}
+	}
+	kbuf, _ := json.Marshal(keys)
+	out := new(AccountProof)
+	err := c.Do("eth_getProof", []json.RawMessage{abuf, kbuf, itobs(blocknum)}, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBlockReceipts gets the receipts
+// of every transaction in a block.
+func (c *Client) GetBlockReceipts(blocknum int64) ([]Receipt, error) {
+	var out []Receipt
+	err := c.Do("eth_getBlockReceipts", []json.RawMessage{itobs(blocknum)}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestClientMethods(t *testing.T) {
+	t.Parallel()
+	var h Hash
+	h[31] = 1
+	hstr := `"` + h.String() + `"`
+	var addr Address
+	addr[19] = 2
+
+	type exchange struct {
+		params string // compact JSON array
+		result string
+	}
+	calls := map[string]exchange{
+		"eth_chainId":        {`[]`, `"0x1"`},
+		"net_version":        {`[]`, `"1"`},
+		"web3_clientVersion": {`[]`, `"Geth/v1.9.2"`},
+		"eth_getBlockByHash": {`[` + hstr + `,false]`, `{"number":"0x10","hash":` + hstr + `}`},
+		"eth_getTransactionByBlockNumberAndIndex": {`["0x10","0x2"]`, `{"hash":` + hstr + `}`},
+		"eth_getBlockTransactionCountByNumber":    {`["latest"]`, `"0x7"`},
+		"eth_getUncleByBlockHashAndIndex":         {`[` + hstr + `,"0x0"]`, `{"number":"0xf"}`},
+		"eth_getLogs": {
+			`[{"fromBlock":"0x1","toBlock":"latest","address":"` + addr.String() + `","topics":[null,` + hstr + `]}]`,
+			`[{"address":"` + addr.String() + `","data":"0x","topics":[]}]`,
+		},
+		"eth_feeHistory": {
+			`["0x2","latest",[25,75.5]]`,
+			`{"oldestBlock":"0xf","baseFeePerGas":["0x1","0x2","0x3"],"gasUsedRatio":[0.5,1],"reward":[["0x1","0x2"],["0x3","0x4"]]}`,
+		},
+		"eth_maxPriorityFeePerGas": {`[]`, `"0x3b9aca00"`},
+		"eth_getProof": {
+			`["` + addr.String() + `",[` + hstr + `],"0x10"]`,
+			`{"address":"` + addr.String() + `","accountProof":["0x01"],"balance":"0x5","codeHash":` + hstr + `,"nonce":"0x1","storageHash":` + hstr + `,"storageProof":[{"key":"0x01","value":"0x9","proof":["0x02"]}]}`,
+		},
+		"eth_getBlockReceipts": {`["0x10"]`, `[{"blockNumber":"0x10","status":"0x1"}]`},
+	}
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		ex, ok := calls[req.Method]
+		if !ok {
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i := range req.Params {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			json.Compact(&buf, req.Params[i])
+		}
+		buf.WriteByte(']')
+		if buf.String() != ex.params {
+			t.Errorf("%s: params %s != %s", req.Method, buf.String(), ex.params)
+		}
+		res.ID = req.ID
+		res.Result = json.RawMessage(ex.result)
+		return nil
+	}))
+
+	if id, err := c.ChainID(); err != nil || id != 1 {
+		t.Error("ChainID:", id, err)
+	}
+	if v, err := c.NetVersion(); err != nil || v != "1" {
+		t.Error("NetVersion:", v, err)
+	}
+	if v, err := c.ClientVersion(); err != nil || v != "Geth/v1.9.2" {
+		t.Error("ClientVersion:", v, err)
+	}
+	if b, err := c.GetBlockByHash(&h, false); err != nil || *b.Number != 0x10 || *b.Hash != h {
+		t.Error("GetBlockByHash:", b, err)
+	}
+	if tx, err := c.GetTransactionByIndex(0x10, 2); err != nil || tx.Hash != h {
+		t.Error("GetTransactionByIndex:", tx, err)
+	}
+	if n, err := c.GetBlockTransactionCount(Latest); err != nil || n != 7 {
+		t.Error("GetBlockTransactionCount:", n, err)
+	}
+	if b, err := c.GetUncle(&h, 0); err != nil || *b.Number != 0xf {
+		t.Error("GetUncle:", b, err)
+	}
+	if logs, err := c.GetLogs([]*Hash{nil, &h}, &addr, 1, Latest); err != nil || len(logs) != 1 || logs[0].Address != addr {
+		t.Error("GetLogs:", logs, err)
+	}
+	fh, err := c.FeeHistory(2, Latest, []float64{25, 75.5})
+	if err != nil || fh.OldestBlock != 0xf || len(fh.BaseFee) != 3 || len(fh.Reward) != 2 || fh.Reward[1][1].Int64() != 4 {
+		t.Error("FeeHistory:", fh, err)
+	}
+	if tip, err := c.MaxPriorityFeePerGas(); err != nil || tip != 1e9 {
+		t.Error("MaxPriorityFeePerGas:", tip, err)
+	}
+	p, err := c.GetProof(&addr, []Hash{h}, 0x10)
+	if err != nil || p.Balance.Int64() != 5 || len(p.StorageProof) != 1 || p.StorageProof[0].Value.Int64() != 9 {
+		t.Error("GetProof:", p, err)
+	}
+	if rs, err := c.GetBlockReceipts(0x10); err != nil || len(rs) != 1 || rs[0].BlockNumber != 0x10 {
+		t.Error("GetBlockReceipts:", rs, err)
+	}
+}
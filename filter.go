@@ -3,7 +3,6 @@ package seth
 import (
 	"encoding/json"
 	"log"
-	"math"
 	"math/big"
 	"strconv"
 	"sync"
@@ -21,6 +20,7 @@ type Filter struct {
 	err    error
 	closed bool
 	poll   bool // continue polling after first fetch
+	local  bool // not installed on the server (see BackfillFilter)
 }
 
 // Out returns the channel of output logs.
@@ -53,16 +53,90 @@ func (f *Filter) Close() {
 	if !f.closed {
 		close(f.exit)
 		f.closed = true
-		f.c.deleteFilter(f.id)
+		if !f.local {
+			f.c.deleteFilter(f.id)
+		}
 	}
 	f.lock.Unlock()
 }
 
-type newFilterReq struct {
+// FilterQuery describes a set of logs.
+//
+// A log matches the query if it was produced by one of Addresses
+// (or by any contract if Addresses is empty), and if, for each
+// position i in Topics, topic i of the log is one of the hashes
+// in Topics[i]. An empty (or nil) entry in Topics matches any topic.
+// For example,
+//
+//	Topics: [][]Hash{{ERC20Transfer, ERC20Approve}, nil, {to}}
+//
+// matches transfers and approvals to the address 'to'.
+type FilterQuery struct {
+	FromBlock int64 // first block; a block number or Latest, Pending, or Earliest
+	ToBlock   int64 // last block (inclusive); see FromBlock
+	Addresses []Address
+	Topics    [][]Hash
+
+	// BlockHash, if non-nil, restricts the query to
+	// a single block, and FromBlock and ToBlock are ignored.
+	// It cannot be used with NewFilter.
+	BlockHash *Hash
+}
+
+type filterQuery struct {
 	FromBlock json.RawMessage `json:"fromBlock,omitempty"`
 	ToBlock   json.RawMessage `json:"toBlock,omitempty"`
-	Address   *Address        `json:"address,omitempty"`
-	Topics    []*Hash         `json:"topics,omitempty"`
+	BlockHash *Hash           `json:"blockHash,omitempty"`
+	Address   interface{}     `json:"address,omitempty"`
+	Topics    []interface{}   `json:"topics,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+// The query is encoded as the filter object expected by
+// eth_newFilter and eth_getLogs. Lists with exactly one
+// entry are encoded as a single value, since some nodes
+// do not accept arrays in every position.
+func (q *FilterQuery) MarshalJSON() ([]byte, error) {
+	out := filterQuery{BlockHash: q.BlockHash}
+	if q.BlockHash == nil {
+		out.FromBlock = itobs(q.FromBlock)
+		out.ToBlock = itobs(q.ToBlock)
+	}
+	switch len(q.Addresses) {
+	case 0:
+	case 1:
+		out.Address = &q.Addresses[0]
+	default:
+		out.Address = q.Addresses
+	}
+	for i := range q.Topics {
+		switch len(q.Topics[i]) {
+		case 0:
+			out.Topics = append(out.Topics, nil)
+		case 1:
+			out.Topics = append(out.Topics, &q.Topics[i][0])
+		default:
+			out.Topics = append(out.Topics, q.Topics[i])
+		}
+	}
+	return json.Marshal(&out)
+}
+
+// query converts the arguments to FilterTopics into a FilterQuery
+func query(topics []*Hash, addr *Address, start, end int64) *FilterQuery {
+	q := &FilterQuery{FromBlock: start, ToBlock: end}
+	if addr != nil {
+		q.Addresses = []Address{*addr}
+	}
+	if len(topics) > 0 {
+		q.Topics = make([][]Hash, len(topics))
+		for i := range topics {
+			if topics[i] != nil {
+				q.Topics[i] = []Hash{*topics[i]}
+			}
+		}
+	}
+	return q
 }
 
 func frecv(f *Filter) {
@@ -135,24 +209,21 @@ func itox(i int64) json.RawMessage {
 // If 'start' and 'end' are non-negative, then they specify the range of blocks in which to
 // search. Otherwise, the filter starts at the latest block.
 func (c *Client) FilterTopics(topics []*Hash, addr *Address, start, end int64) (*Filter, error) {
-	_ = math.MaxInt64
-	req := &newFilterReq{
-		Address: addr,
-		Topics:  topics,
-	}
-	poll := false
 	if start < 0 {
-		poll = true
-		req.FromBlock = rawlatest
-	} else {
-		req.FromBlock = itox(start)
+		start = Latest
 	}
 	if end < 0 {
-		req.ToBlock = rawlatest
-	} else {
-		req.ToBlock = itox(end)
+		end = Latest
 	}
-	buf, err := json.Marshal(req)
+	return c.NewFilter(query(topics, addr, start, end))
+}
+
+// NewFilter creates a log filter from a query. If q.FromBlock is
+// Latest or Pending, the filter continues to yield new logs as they
+// are produced until it is closed. Otherwise, the filter yields the
+// logs in the given range of blocks and then closes.
+func (c *Client) NewFilter(q *FilterQuery) (*Filter, error) {
+	buf, err := json.Marshal(q)
 	if err != nil {
 		return nil, err
 	}
@@ -162,17 +233,28 @@ func (c *Client) FilterTopics(topics []*Hash, addr *Address, start, end int64) (
 		return nil, err
 	}
 	id := (*big.Int)(&out).Int64()
+	poll := q.FromBlock < 0
 	f := &Filter{c: c, out: make(chan *Log, 20), exit: make(chan struct{}, 1), id: id, poll: poll}
 	go frecv(f)
 	return f, nil
 }
 
-// TokenTransfers returns a filter that searches for token transfers
-// matching the given arguments. If any of the argments are nil, the
-// filter matches that argument as a wildcard. In other words,
-// if from, to, and tok are all nil, this filter finds all token
-// transfers in the given block range.
-func (c *Client) TokenTransfers(from *Address, to *Address, tok *Address, start, end int64) (*Filter, error) {
+// Logs returns the logs that match a query
+// using eth_getLogs, without installing a filter.
+func (c *Client) Logs(q *FilterQuery) ([]Log, error) {
+	buf, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	var out []Log
+	err = c.Do("eth_getLogs", []json.RawMessage{buf}, &out)
+	return out, err
+}
+
+// TransferQuery returns a query that matches token transfers
+// from 'from' to 'to' of the token 'tok'. Nil arguments match
+// any address. The block range of the query is left empty.
+func TransferQuery(from, to, tok *Address) *FilterQuery {
 	var hashes [3]Hash
 	var arg0 [3]*Hash
 	hashes[0] = ERC20Transfer
@@ -185,5 +267,41 @@ func (c *Client) TokenTransfers(from *Address, to *Address, tok *Address, start,
 		copy(hashes[2][12:], to[:])
 		arg0[2] = &hashes[2]
 	}
-	return c.FilterTopics(arg0[:], tok, start, end)
+	return query(arg0[:], tok, 0, 0)
+}
+
+// TokenTransfers returns a filter that searches for token transfers
+// matching the given arguments. If any of the argments are nil, the
+// filter matches that argument as a wildcard. In other words,
+// if from, to, and tok are all nil, this filter finds all token
+// transfers in the given block range. Ranges that are too wide for
+// a single query are searched using BackfillFilter.
+//
+// For long-running processing of transfers, see Indexer.
+//
+// The filter also matches ERC721 transfers, which share the
+// ERC20 event signature; Receipt.ParseTransfer rejects them,
+// and ERC721Transfers searches for them specifically.
+func (c *Client) TokenTransfers(from *Address, to *Address, tok *Address, start, end int64) (*Filter, error) {
+	return c.transfers(TransferQuery(from, to, tok), start, end)
+}
+
+// transfers returns a filter for the transfers matching q
+// in the given block range
+func (c *Client) transfers(q *FilterQuery, start, end int64) (*Filter, error) {
+	if start >= 0 && (end < 0 || end-start >= defaultBackfill.window()) {
+		q.FromBlock, q.ToBlock = start, end
+		if end < 0 {
+			q.ToBlock = Latest
+		}
+		return c.BackfillFilter(q, nil), nil
+	}
+	if start < 0 {
+		start = Latest
+	}
+	if end < 0 {
+		end = Latest
+	}
+	q.FromBlock, q.ToBlock = start, end
+	return c.NewFilter(q)
 }
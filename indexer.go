@@ -0,0 +1,453 @@
+package seth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// Cursor identifies the last block fully processed by an Indexer.
+type Cursor struct {
+	Block int64 `json:"block"`
+	Hash  Hash  `json:"hash"`
+}
+
+// CursorStore persists the cursor of an Indexer.
+type CursorStore interface {
+	// Load returns the saved cursor,
+	// or nil if no cursor has been saved.
+	Load() (*Cursor, error)
+	// Save saves the cursor.
+	Save(c *Cursor) error
+}
+
+// FileStore is a CursorStore that keeps
+// the cursor in a file as JSON.
+type FileStore string
+
+// Load implements CursorStore.Load.
+func (f FileStore) Load() (*Cursor, error) {
+	buf, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	c := new(Cursor)
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save implements CursorStore.Save.
+// The file is replaced atomically, so a crash
+// never leaves a partially-written cursor.
+func (f FileStore) Save(c *Cursor) error {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := string(f) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
+
+// MemStore is a CursorStore that
+// only keeps the cursor in memory.
+type MemStore struct{ c *Cursor }
+
+// Load implements CursorStore.Load.
+func (m *MemStore) Load() (*Cursor, error) { return m.c, nil }
+
+// Save implements CursorStore.Save.
+func (m *MemStore) Save(c *Cursor) error {
+	cp := *c
+	m.c = &cp
+	return nil
+}
+
+type indexsub struct {
+	query   FilterQuery
+	handler func(l *Log) error
+}
+
+// Indexer delivers the logs that match a set of subscriptions
+// to their handlers in chain order, and records its progress
+// in a CursorStore so that it resumes where it left off when
+// it is restarted.
+//
+// Logs are delivered at least once: if the indexer stops while
+// a block is partially processed, the handlers see the logs in
+// that block again when it restarts. The cursor is saved after
+// every block that contains logs, and after every batch.
+//
+// Every block that produced logs is checked against the
+// canonical chain before its logs are delivered. Blocks
+// without logs are not checked individually, so if the node
+// briefly switches to a different fork while the logs in a
+// batch are being fetched, logs that only exist on that fork
+// may be missed. (Reorgs that are still in effect once the
+// logs have been fetched are detected and rolled back.)
+type Indexer struct {
+	Client *Client
+
+	// Store holds the cursor. If it is nil,
+	// the cursor is only kept in memory.
+	Store CursorStore
+
+	// Rollback, if non-nil, is called when a chain
+	// reorganization orphans blocks that have already
+	// been processed. It should undo the effects of every
+	// block after 'to', which is the newest processed block
+	// that is still canonical. If Rollback is nil, the indexer
+	// rewinds to 'to' without notifying the handlers.
+	Rollback func(to *Cursor) error
+
+	// Start is the first block to index if the store is
+	// empty. It may be Latest to start at the head of the chain.
+	Start int64
+
+	// Confirmations is the number of blocks that must be
+	// mined on top of a block before it is indexed.
+	Confirmations int64
+
+	// Batch is the maximum number of blocks
+	// indexed at once. The default is 1000.
+	Batch int64
+
+	// History is the maximum depth of a reorg that
+	// can be rolled back. The default is 128 blocks.
+	History int
+
+	// Interval is the polling interval once the indexer
+	// has caught up. The default is one second.
+	Interval time.Duration
+
+	// Backfill are the options used to query
+	// logs. If nil, the defaults are used.
+	Backfill *BackfillOptions
+
+	// OnError, if non-nil, is called with every
+	// error returned by the Client that is retried.
+	OnError func(err error)
+
+	subs   []indexsub
+	recent []Cursor // recently saved cursors, oldest first
+}
+
+// Subscribe adds a subscription to the indexer. The handler
+// is called on every log that matches the addresses and topics
+// in q; the block range in q is ignored. Subscribe must not
+// be called once the indexer is running.
+func (ix *Indexer) Subscribe(q *FilterQuery, handler func(l *Log) error) {
+	s := indexsub{query: *q, handler: handler}
+	s.query.BlockHash = nil
+	ix.subs = append(ix.subs, s)
+}
+
+func (ix *Indexer) batch() int64 {
+	if ix.Batch > 0 {
+		return ix.Batch
+	}
+	return 1000
+}
+
+func (ix *Indexer) history() int {
+	if ix.History > 0 {
+		return ix.History
+	}
+	return 128
+}
+
+func (ix *Indexer) interval() time.Duration {
+	if ix.Interval > 0 {
+		return ix.Interval
+	}
+	return time.Second
+}
+
+// Run runs the indexer until 'stop' is closed or an error
+// occurs. Errors returned by the Client are passed to OnError
+// and retried after the polling interval, except for errors
+// that can't succeed on a retry (such as a query that exceeds
+// the node's limits for a single block), which cause Run to
+// return. Errors returned by the handlers, Rollback, or the
+// Store cause Run to return, too. A reorg deeper than History
+// causes Run to return ErrReorgTooDeep.
+func (ix *Indexer) Run(stop <-chan struct{}) error {
+	if ix.Store == nil {
+		ix.Store = new(MemStore)
+	}
+	cur, err := ix.Store.Load()
+	if err != nil {
+		return err
+	}
+	// keep the window of recent cursors from a previous
+	// run unless the store has moved on without it
+	if cur == nil || len(ix.recent) == 0 || ix.recent[len(ix.recent)-1] != *cur {
+		ix.recent = ix.recent[:0]
+		if cur != nil {
+			ix.recent = append(ix.recent, *cur)
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		more, err := ix.step(&cur)
+		if err != nil {
+			return err
+		}
+		if more {
+			continue
+		}
+		t := time.NewTimer(ix.interval())
+		select {
+		case <-stop:
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// retry reports an error returned by the Client,
+// returning it if retrying the request is pointless
+func (ix *Indexer) retry(err error) (bool, error) {
+	if !Transient(err) {
+		return false, err
+	}
+	if ix.OnError != nil {
+		ix.OnError(err)
+	}
+	return false, nil
+}
+
+type indexlog struct {
+	log     *Log
+	handler func(l *Log) error
+}
+
+// step indexes the next batch of blocks, returning
+// whether or not there may be more blocks to index
+func (ix *Indexer) step(cur **Cursor) (bool, error) {
+	c := ix.Client
+	head, err := c.BlockNumber()
+	if err != nil {
+		return ix.retry(err)
+	}
+	safe := head - ix.Confirmations
+	var next int64
+	switch {
+	case *cur != nil:
+		next = (*cur).Block + 1
+	case ix.Start < 0:
+		next = safe
+	default:
+		next = ix.Start
+	}
+	if next > safe {
+		return false, nil
+	}
+	to := next + ix.batch() - 1
+	if to > safe {
+		to = safe
+	}
+
+	first, err := c.GetBlock(next, false)
+	if err != nil {
+		return ix.retry(err)
+	} else if first.Hash == nil {
+		return false, nil
+	}
+	if *cur != nil && first.Parent != (*cur).Hash {
+		return ix.reorg(cur)
+	}
+	last := first
+	if to != next {
+		last, err = c.GetBlock(to, false)
+		if err != nil {
+			return ix.retry(err)
+		} else if last.Hash == nil {
+			return false, nil
+		}
+	}
+
+	var logs []indexlog
+	for i := range ix.subs {
+		s := &ix.subs[i]
+		q := s.query
+		q.FromBlock, q.ToBlock = next, to
+		err := c.Backfill(&q, ix.Backfill, func(l *Log) error {
+			logs = append(logs, indexlog{log: l, handler: s.handler})
+			return nil
+		})
+		if err != nil {
+			return ix.retry(err)
+		}
+	}
+	for i := range logs {
+		l := logs[i].log
+		if l.BlockNumber == nil || l.BlockHash == nil || l.LogIndex == nil {
+			return false, nil
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		a, b := logs[i].log, logs[j].log
+		if *a.BlockNumber != *b.BlockNumber {
+			return *a.BlockNumber < *b.BlockNumber
+		}
+		return *a.LogIndex < *b.LogIndex
+	})
+	// if any block that produced logs is no longer
+	// canonical, the logs may have come from an
+	// orphaned block; try again later
+	for i := range logs {
+		l := logs[i].log
+		if i > 0 && *l.BlockNumber == *logs[i-1].log.BlockNumber {
+			continue
+		}
+		var hash *Hash
+		switch n := int64(*l.BlockNumber); n {
+		case next:
+			hash = first.Hash
+		case to:
+			hash = last.Hash
+		default:
+			b, err := c.GetBlock(n, false)
+			if err != nil {
+				return ix.retry(err)
+			} else if b.Hash == nil {
+				return false, nil
+			}
+			hash = b.Hash
+		}
+		if *l.BlockHash != *hash {
+			return false, nil
+		}
+	}
+
+	for i := range logs {
+		l := logs[i].log
+		if i > 0 && *l.BlockNumber != *logs[i-1].log.BlockNumber {
+			prev := logs[i-1].log
+			if err := ix.save(cur, int64(*prev.BlockNumber), prev.BlockHash); err != nil {
+				return false, err
+			}
+		}
+		if err := logs[i].handler(l); err != nil {
+			return false, err
+		}
+	}
+	if err := ix.save(cur, to, last.Hash); err != nil {
+		return false, err
+	}
+	return to < safe, nil
+}
+
+func (ix *Indexer) save(cur **Cursor, block int64, hash *Hash) error {
+	c := &Cursor{Block: block, Hash: *hash}
+	if err := ix.Store.Save(c); err != nil {
+		return err
+	}
+	*cur = c
+	ix.recent = Remember(ix.recent, c, ix.history())
+	return nil
+}
+
+// reorg finds the newest processed block that is still
+// canonical, rolls back to it, and moves the cursor there
+func (ix *Indexer) reorg(cur **Cursor) (bool, error) {
+	at, err := ix.Client.Rewind(ix.recent, ix.history())
+	if err == ErrReorgTooDeep {
+		return false, err
+	} else if err != nil {
+		return ix.retry(err)
+	}
+	if ix.Rollback != nil {
+		if err := ix.Rollback(at); err != nil {
+			return false, err
+		}
+	}
+	return true, ix.save(cur, at.Block, &at.Hash)
+}
+
+// Remember adds c to a window of recently processed
+// cursors (ordered oldest first) for use with Rewind,
+// dropping any cursors at or after c.Block and keeping
+// at most 'size' cursors.
+func Remember(recent []Cursor, c *Cursor, size int) []Cursor {
+	i := len(recent)
+	for i > 0 && recent[i-1].Block >= c.Block {
+		i--
+	}
+	recent = append(recent[:i], *c)
+	if len(recent) > size {
+		recent = append(recent[:0], recent[len(recent)-size:]...)
+	}
+	return recent
+}
+
+// Rewind returns the newest block in 'recent' (a window of
+// processed cursors, oldest first, ending with the current
+// cursor; see Remember) that is still part of the canonical
+// chain. It walks back through the orphaned ancestors of the
+// current cursor, and falls back to the older cursors in
+// 'recent' if the node doesn't serve the orphaned blocks.
+//
+// If a block that is 'history' or more blocks behind the
+// current cursor has been orphaned, Rewind returns
+// ErrReorgTooDeep. If the orphaned blocks can't be fetched
+// and 'recent' holds no older cursor, Rewind returns
+// ErrNotFound, and the caller should try again later.
+// Any other error is returned by the Client and may be transient.
+//
+// Indexer uses Rewind to handle reorgs; it is exported
+// for programs that keep track of a Cursor themselves.
+func (c *Client) Rewind(recent []Cursor, history int) (*Cursor, error) {
+	if len(recent) == 0 {
+		return nil, ErrNotFound
+	}
+	at := recent[len(recent)-1]
+	top := at.Block
+	for {
+		b, err := c.GetBlock(at.Block, false)
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		if err == nil && b.Hash != nil && *b.Hash == at.Hash {
+			return &at, nil
+		}
+		// 'at' has been orphaned, so the fork
+		// point is at least this deep
+		if top-at.Block >= int64(history) || at.Block == 0 {
+			return nil, ErrReorgTooDeep
+		}
+		// walk back through the orphaned chain
+		o, err := c.GetBlockByHash(&at.Hash, false)
+		if err == nil {
+			at.Block--
+			at.Hash = o.Parent
+			continue
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+		// the node doesn't serve the orphaned
+		// block; try the next older cursor
+		for len(recent) > 0 && recent[len(recent)-1].Block >= at.Block {
+			recent = recent[:len(recent)-1]
+		}
+		if len(recent) == 0 {
+			return nil, ErrNotFound
+		}
+		at = recent[len(recent)-1]
+	}
+}
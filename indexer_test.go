@@ -0,0 +1,273 @@
+package seth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexerResume(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileStore(filepath.Join(dir, "cursor"))
+
+	chain := new(fakeChain)
+	chain.extend(10)
+	c := NewClientTransport(chain)
+
+	var seen []int64
+	crash := errors.New("crash")
+	ix := &Indexer{Client: c, Store: store, Batch: 4, Interval: time.Millisecond}
+	ix.Subscribe(&FilterQuery{}, func(l *Log) error {
+		if *l.BlockNumber == 5 {
+			return crash
+		}
+		seen = append(seen, int64(*l.BlockNumber))
+		return nil
+	})
+	if err := ix.Run(nil); err != crash {
+		t.Fatal("expected a crash; got", err)
+	}
+	cur, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur == nil || cur.Block != 4 || cur.Hash != chain.hashes[4] {
+		t.Fatalf("unexpected cursor %+v", cur)
+	}
+
+	// a new indexer picks up at block 5
+	stop := make(chan struct{})
+	ix = &Indexer{Client: c, Store: store, Batch: 4, Interval: time.Millisecond}
+	ix.Subscribe(&FilterQuery{}, func(l *Log) error {
+		seen = append(seen, int64(*l.BlockNumber))
+		if *l.BlockNumber == 9 {
+			close(stop)
+		}
+		return nil
+	})
+	if err := ix.Run(stop); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("unexpected blocks %v", seen)
+	}
+	for i := range seen {
+		if seen[i] != int64(i) {
+			t.Fatalf("unexpected blocks %v", seen)
+		}
+	}
+}
+
+func TestIndexerRollback(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(10)
+	logs := make(chan int64, 20)
+	rollbacks := make(chan Cursor, 1)
+	ix := &Indexer{
+		Client:   NewClientTransport(chain),
+		Interval: time.Millisecond,
+		Rollback: func(to *Cursor) error {
+			rollbacks <- *to
+			return nil
+		},
+	}
+	ix.Subscribe(&FilterQuery{}, func(l *Log) error {
+		logs <- int64(*l.BlockNumber)
+		return nil
+	})
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- ix.Run(stop) }()
+	defer func() {
+		close(stop)
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	next := func() int64 {
+		t.Helper()
+		select {
+		case n := <-logs:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+		panic("unreachable")
+	}
+	for i := int64(0); i < 10; i++ {
+		if n := next(); n != i {
+			t.Fatalf("got block %d; want %d", n, i)
+		}
+	}
+
+	// replace blocks 7, 8, and 9 with four new blocks
+	chain.reorg(3, 4)
+	select {
+	case to := <-rollbacks:
+		if to.Block != 6 || to.Hash != chain.hashes[6] {
+			t.Fatalf("unexpected rollback to %+v", to)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	for i := int64(7); i < 11; i++ {
+		if n := next(); n != i {
+			t.Fatalf("got block %d; want %d", n, i)
+		}
+	}
+}
+
+func TestIndexerOrphanedLogs(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(5)
+	calls := 0
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if err := chain.Execute(req, res); err != nil || req.Method != "eth_getLogs" {
+			return err
+		}
+		calls++
+		var logs []Log
+		if err := json.Unmarshal(res.Result, &logs); err != nil {
+			return err
+		}
+		switch calls {
+		case 1:
+			// a log from an orphaned block in the middle of the batch
+			orphan := HashString("orphan")
+			logs[2].BlockHash = &orphan
+		case 2:
+			// an incomplete log
+			logs[3].LogIndex = nil
+		}
+		res.Result, _ = json.Marshal(logs)
+		return nil
+	}))
+
+	var seen []int64
+	ix := &Indexer{Client: c, Store: new(MemStore)}
+	ix.Subscribe(&FilterQuery{}, func(l *Log) error {
+		seen = append(seen, int64(*l.BlockNumber))
+		return nil
+	})
+	var cur *Cursor
+	for i := 0; i < 2; i++ {
+		if _, err := ix.step(&cur); err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != 0 || cur != nil {
+			t.Fatalf("step %d: delivered %v with cursor %+v", i, seen, cur)
+		}
+	}
+	if _, err := ix.step(&cur); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 5 || cur == nil || cur.Block != 4 {
+		t.Fatalf("delivered %v with cursor %+v", seen, cur)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(10)
+	// a node that only serves canonical blocks by hash
+	hide := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if req.Method == "eth_getBlockByHash" {
+			var h Hash
+			json.Unmarshal(req.Params[0], &h)
+			chain.lock.Lock()
+			defer chain.lock.Unlock()
+			for i := range chain.hashes {
+				if chain.hashes[i] == h {
+					res.Result, _ = json.Marshal(map[string]interface{}{"hash": h, "parentHash": chain.parents[h]})
+					return nil
+				}
+			}
+			res.Result = rawnull
+			return nil
+		}
+		return chain.Execute(req, res)
+	}))
+	var recent []Cursor
+	for i := range chain.hashes {
+		recent = Remember(recent, &Cursor{Block: int64(i), Hash: chain.hashes[i]}, 5)
+	}
+	if len(recent) != 5 || recent[0].Block != 5 || recent[4].Block != 9 {
+		t.Fatalf("unexpected window %+v", recent)
+	}
+
+	chain.reorg(2, 2)
+	at, err := hide.Rewind(recent, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Block != 7 || at.Hash != chain.hashes[7] {
+		t.Fatalf("rewound to %+v", at)
+	}
+	// without older cursors, the orphan is needed
+	if _, err := hide.Rewind(recent[4:], 5); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound; got", err)
+	}
+	// ... and it can be found by walking back
+	at, err = NewClientTransport(chain).Rewind(recent[4:], 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Block != 7 || at.Hash != chain.hashes[7] {
+		t.Fatalf("rewound to %+v", at)
+	}
+
+	// a reorg of 'history' blocks can be handled,
+	// but one more block is too many
+	if _, err := hide.Rewind(recent, 1); err != ErrReorgTooDeep {
+		t.Fatal("expected ErrReorgTooDeep; got", err)
+	}
+	if _, err := hide.Rewind(recent, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexerErrors(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(1)
+	fail := 2
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if req.Method == "eth_getLogs" {
+			if fail > 0 {
+				fail--
+				return errors.New("connection reset")
+			}
+			res.ID = req.ID
+			res.Error = RPCError{Code: -32005, Message: "query returned more than 10000 results"}
+			return nil
+		}
+		return chain.Execute(req, res)
+	}))
+	var retried []error
+	ix := &Indexer{
+		Client:   c,
+		Interval: time.Millisecond,
+		OnError:  func(err error) { retried = append(retried, err) },
+	}
+	ix.Subscribe(&FilterQuery{}, func(l *Log) error { return nil })
+	err := ix.Run(nil)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatal("expected ErrLimitExceeded; got", err)
+	}
+	if len(retried) != 2 {
+		t.Fatalf("retried %v", retried)
+	}
+}
@@ -0,0 +1,401 @@
+// Package ledger maintains historical ERC20 token
+// balances by replaying transfer events.
+//
+// Since balances are computed from logs, a Ledger
+// can answer "what was the balance of this account
+// at block N" for any replayed block without access
+// to an archive node.
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/philhofer/seth"
+	"github.com/philhofer/seth/cc"
+)
+
+// ErrNotContiguous is returned by Replay when the
+// range of blocks does not immediately follow the
+// blocks that have already been replayed.
+var ErrNotContiguous = errors.New("ledger: replayed ranges must be contiguous")
+
+type key struct {
+	token, addr seth.Address
+}
+
+// entry is the balance as of the end of a block
+type entry struct {
+	block int64
+	bal   big.Int
+}
+
+// Ledger tracks the balances of a set of
+// addresses in a set of tokens.
+type Ledger struct {
+	c      *seth.Client
+	tokens map[seth.Address]cc.Currency
+	addrs  map[seth.Address]bool // nil means every address
+	hist   map[key][]entry
+	height int64 // last replayed block, or -1
+	opened int64 // block passed to Open, or -1
+}
+
+// New creates a Ledger that tracks the balances of the
+// given addresses in each of the given tokens. If addrs is
+// empty, the balance of every address that appears in a
+// transfer is tracked (except the zero address). Every
+// currency must be a token (see cc.Currency.Token).
+func New(c *seth.Client, tokens []cc.Currency, addrs []seth.Address) (*Ledger, error) {
+	l := &Ledger{
+		c:      c,
+		tokens: make(map[seth.Address]cc.Currency, len(tokens)),
+		hist:   make(map[key][]entry),
+		height: -1,
+		opened: -1,
+	}
+	for _, t := range tokens {
+		if !t.Exists() || !t.Token() {
+			return nil, fmt.Errorf("ledger: %s is not a token", t)
+		}
+		l.tokens[*t.Addr()] = t
+	}
+	if len(addrs) > 0 {
+		l.addrs = make(map[seth.Address]bool, len(addrs))
+		for i := range addrs {
+			l.addrs[addrs[i]] = true
+		}
+	}
+	return l, nil
+}
+
+// Height returns the last block that has been
+// replayed, or -1 if nothing has been replayed.
+func (l *Ledger) Height() int64 { return l.height }
+
+func (l *Ledger) tracked(a *seth.Address) bool {
+	if l.addrs == nil {
+		return !a.Zero()
+	}
+	return l.addrs[*a]
+}
+
+func (l *Ledger) amount(token *seth.Address, n *big.Int) *cc.Amount {
+	a := &cc.Amount{Currency: l.tokens[*token]}
+	a.Amount.Set(n)
+	return a
+}
+
+func (l *Ledger) currency(c cc.Currency) (*seth.Address, error) {
+	if !c.Exists() || !c.Token() || l.tokens[*c.Addr()] != c {
+		return nil, fmt.Errorf("ledger: %s is not tracked", c)
+	}
+	return c.Addr(), nil
+}
+
+// balanceOf calls token.balanceOf(addr) at the given block
+func (l *Ledger) balanceOf(token, addr *seth.Address, block int64) (*big.Int, error) {
+	opts := seth.CallOpts{To: token}
+	opts.EncodeCall("balanceOf(address)", addr)
+	var out seth.Data
+	if err := l.c.ConstCallAt(&opts, &out, block); err != nil {
+		return nil, err
+	}
+	if len(out) != 32 {
+		return nil, fmt.Errorf("ledger: %s.balanceOf returned %d bytes", token.String(), len(out))
+	}
+	return new(big.Int).SetBytes(out), nil
+}
+
+// Open sets the opening balances of the tracked addresses
+// to their on-chain balances at the given block, so that
+// replaying can begin at block+1 rather than at the creation
+// of each token. The node must have the state of the given
+// block. Open requires an explicit set of addresses, and it
+// must be called before Replay.
+func (l *Ledger) Open(block int64) error {
+	if l.addrs == nil {
+		return errors.New("ledger: Open requires a set of addresses")
+	}
+	if l.height >= 0 {
+		return errors.New("ledger: Open called after Replay")
+	}
+	for token := range l.tokens {
+		for addr := range l.addrs {
+			token, addr := token, addr
+			bal, err := l.balanceOf(&token, &addr, block)
+			if err != nil {
+				return err
+			}
+			e := entry{block: block}
+			e.bal.Set(bal)
+			l.hist[key{token, addr}] = []entry{e}
+		}
+	}
+	l.height = block
+	l.opened = block
+	return nil
+}
+
+// known returns an error if the balances at the
+// given block precede the opening balances
+func (l *Ledger) known(block int64) error {
+	if block < l.opened {
+		return fmt.Errorf("ledger: block %d precedes the opening block %d", block, l.opened)
+	}
+	return nil
+}
+
+type transfer struct {
+	block, tx, index int64
+	hash             seth.Hash
+	token, from, to  seth.Address
+	value            big.Int
+}
+
+func parse(lg *seth.Log) (*transfer, bool) {
+	if len(lg.Topics) != 3 || !bytes.Equal(lg.Topics[0], seth.ERC20Transfer[:]) ||
+		len(lg.Topics[1]) != 32 || len(lg.Topics[2]) != 32 || len(lg.Data) != 32 {
+		return nil, false
+	}
+	if lg.BlockNumber == nil || lg.TxIndex == nil || lg.LogIndex == nil || lg.TxHash == nil {
+		return nil, false
+	}
+	t := &transfer{
+		block: int64(*lg.BlockNumber),
+		tx:    int64(*lg.TxIndex),
+		index: int64(*lg.LogIndex),
+		hash:  *lg.TxHash,
+		token: lg.Address,
+	}
+	copy(t.from[:], lg.Topics[1][12:])
+	copy(t.to[:], lg.Topics[2][12:])
+	t.value.SetBytes(lg.Data)
+	return t, true
+}
+
+// fetch appends the transfers matching q in the
+// range [start, end] to ts, except for those that
+// 'skip' returns true for
+func (l *Ledger) fetch(q *seth.FilterQuery, start, end int64, skip func(t *transfer) bool, ts *[]*transfer) error {
+	q.FromBlock, q.ToBlock = start, end
+	return l.c.Backfill(q, nil, func(lg *seth.Log) error {
+		t, ok := parse(lg)
+		if ok && t.block >= start && t.block <= end && (skip == nil || !skip(t)) {
+			*ts = append(*ts, t)
+		}
+		return nil
+	})
+}
+
+// Replay applies every transfer of the tracked tokens
+// in the (inclusive) range of blocks [start, end]. Ranges
+// must be replayed in order: after the first call to Replay
+// (or Open), start must be one more than Height.
+func (l *Ledger) Replay(start, end int64) error {
+	if l.height >= 0 && start != l.height+1 {
+		return ErrNotContiguous
+	}
+	if end < start {
+		return fmt.Errorf("ledger: bad block range [%d, %d]", start, end)
+	}
+	tokens := make([]seth.Address, 0, len(l.tokens))
+	for token := range l.tokens {
+		tokens = append(tokens, token)
+	}
+	var ts []*transfer
+	if l.addrs == nil {
+		q := &seth.FilterQuery{
+			Addresses: tokens,
+			Topics:    [][]seth.Hash{{seth.ERC20Transfer}},
+		}
+		if err := l.fetch(q, start, end, nil, &ts); err != nil {
+			return err
+		}
+	} else {
+		addrs := make([]seth.Hash, 0, len(l.addrs))
+		for addr := range l.addrs {
+			var h seth.Hash
+			copy(h[12:], addr[:])
+			addrs = append(addrs, h)
+		}
+		// topics are ANDed across positions, so transfers
+		// from and to the tracked addresses are separate
+		// queries; transfers between two tracked addresses
+		// are taken from the first one
+		from := &seth.FilterQuery{
+			Addresses: tokens,
+			Topics:    [][]seth.Hash{{seth.ERC20Transfer}, addrs},
+		}
+		if err := l.fetch(from, start, end, nil, &ts); err != nil {
+			return err
+		}
+		to := &seth.FilterQuery{
+			Addresses: tokens,
+			Topics:    [][]seth.Hash{{seth.ERC20Transfer}, nil, addrs},
+		}
+		skip := func(t *transfer) bool { return l.tracked(&t.from) }
+		if err := l.fetch(to, start, end, skip, &ts); err != nil {
+			return err
+		}
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		a, b := ts[i], ts[j]
+		if a.block != b.block {
+			return a.block < b.block
+		}
+		if a.tx != b.tx {
+			return a.tx < b.tx
+		}
+		return a.index < b.index
+	})
+	for _, t := range ts {
+		if l.tracked(&t.from) {
+			l.apply(key{t.token, t.from}, t.block, new(big.Int).Neg(&t.value))
+		}
+		if l.tracked(&t.to) {
+			l.apply(key{t.token, t.to}, t.block, &t.value)
+		}
+	}
+	l.height = end
+	return nil
+}
+
+func (l *Ledger) apply(k key, block int64, delta *big.Int) {
+	h := l.hist[k]
+	if len(h) == 0 || h[len(h)-1].block != block {
+		e := entry{block: block}
+		if len(h) > 0 {
+			e.bal.Set(&h[len(h)-1].bal)
+		}
+		h = append(h, e)
+	}
+	last := &h[len(h)-1]
+	last.bal.Add(&last.bal, delta)
+	l.hist[k] = h
+}
+
+func (l *Ledger) at(k key, block int64) *big.Int {
+	h := l.hist[k]
+	i := sort.Search(len(h), func(i int) bool { return h[i].block > block })
+	if i == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(&h[i-1].bal)
+}
+
+// BalanceAt returns the balance of addr in the given token as
+// of the end of the given block. Blocks after Height are
+// treated as Height, and blocks before the block passed
+// to Open are rejected.
+func (l *Ledger) BalanceAt(token cc.Currency, addr *seth.Address, block int64) (*cc.Amount, error) {
+	t, err := l.currency(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.known(block); err != nil {
+		return nil, err
+	}
+	return l.amount(t, l.at(key{*t, *addr}, block)), nil
+}
+
+// Balance returns the balance of addr in the
+// given token as of the end of block Height.
+func (l *Ledger) Balance(token cc.Currency, addr *seth.Address) (*cc.Amount, error) {
+	return l.BalanceAt(token, addr, l.height)
+}
+
+// Balance is the balance of one address in one token.
+type Balance struct {
+	Addr   seth.Address
+	Amount *cc.Amount
+}
+
+// Snapshot returns the non-zero balances of every
+// tracked address as of the end of the given block,
+// ordered by currency and then by address. Blocks
+// before the block passed to Open are rejected.
+func (l *Ledger) Snapshot(block int64) ([]Balance, error) {
+	if err := l.known(block); err != nil {
+		return nil, err
+	}
+	var out []Balance
+	for k := range l.hist {
+		bal := l.at(k, block)
+		if bal.Sign() == 0 {
+			continue
+		}
+		out = append(out, Balance{Addr: k.addr, Amount: l.amount(&k.token, bal)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Amount.Currency != b.Amount.Currency {
+			return a.Amount.Currency < b.Amount.Currency
+		}
+		return bytes.Compare(a.Addr[:], b.Addr[:]) < 0
+	})
+	return out, nil
+}
+
+// Mismatch is a discrepancy between the
+// ledger and the on-chain balance of an address.
+type Mismatch struct {
+	Addr   seth.Address
+	Ledger *cc.Amount // balance computed from transfers
+	Chain  *cc.Amount // balance reported by balanceOf
+}
+
+// Diff returns Chain - Ledger.
+func (m *Mismatch) Diff() *cc.Amount {
+	return m.Chain.Copy().Sub(m.Ledger)
+}
+
+// Reconcile compares the ledger balances at the given block
+// with the balances reported by each token's balanceOf method,
+// and returns the addresses whose balances differ. Tokens that
+// charge fees on transfer or rebase balances produce mismatches,
+// since their balances do not follow from their Transfer events.
+// The node must have the state of the given block, and it
+// must not precede the block passed to Open.
+func (l *Ledger) Reconcile(block int64) ([]Mismatch, error) {
+	if err := l.known(block); err != nil {
+		return nil, err
+	}
+	keys := make([]key, 0, len(l.hist))
+	for k := range l.hist {
+		keys = append(keys, k)
+	}
+	for token := range l.tokens {
+		for addr := range l.addrs {
+			if _, ok := l.hist[key{token, addr}]; !ok {
+				keys = append(keys, key{token, addr})
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].token[:], keys[j].token[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(keys[i].addr[:], keys[j].addr[:]) < 0
+	})
+	var out []Mismatch
+	for _, k := range keys {
+		k := k
+		chain, err := l.balanceOf(&k.token, &k.addr, block)
+		if err != nil {
+			return nil, err
+		}
+		mine := l.at(k, block)
+		if chain.Cmp(mine) != 0 {
+			out = append(out, Mismatch{
+				Addr:   k.addr,
+				Ledger: l.amount(&k.token, mine),
+				Chain:  l.amount(&k.token, chain),
+			})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,255 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/philhofer/seth"
+	"github.com/philhofer/seth/cc"
+)
+
+var tok = cc.NewToken("LEDGERTEST", 2, "0x00000000000000000000000000000000000000ee")
+
+// chain is a transport that serves a list of transfer logs
+// through filters and eth_getLogs, and serves balanceOf
+// from a fixed table of balances
+type chain struct {
+	lock     sync.Mutex
+	logs     []seth.Log
+	filters  map[int64]json.RawMessage
+	balances map[seth.Address]int64
+}
+
+func word(dst []byte, v int64) {
+	b := big.NewInt(v).Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+func (c *chain) transfer(block, tx int, from, to seth.Address, value int64) {
+	n, txi, idx := seth.Uint64(block), seth.Uint64(tx), seth.Uint64(len(c.logs))
+	h := seth.HashString(fmt.Sprint(block, tx))
+	var f, t, v seth.Hash
+	copy(f[12:], from[:])
+	copy(t[12:], to[:])
+	word(v[:], value)
+	c.logs = append(c.logs, seth.Log{
+		BlockNumber: &n,
+		TxIndex:     &txi,
+		LogIndex:    &idx,
+		TxHash:      &h,
+		Address:     *tok.Addr(),
+		Topics:      []seth.Data{seth.ERC20Transfer[:], f[:], t[:]},
+		Data:        v[:],
+	})
+}
+
+// hashes decodes a filter position, which is
+// null, a single value, or a list of values
+func hashes(raw json.RawMessage) []seth.Hash {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var one seth.Hash
+	if json.Unmarshal(raw, &one) == nil {
+		return []seth.Hash{one}
+	}
+	var list []seth.Hash
+	json.Unmarshal(raw, &list)
+	return list
+}
+
+// matches returns whether 'want' is empty or contains 'b'
+func matches(want []seth.Hash, b []byte) bool {
+	for i := range want {
+		if bytes.Equal(want[i][:], b) {
+			return true
+		}
+	}
+	return len(want) == 0
+}
+
+func (c *chain) query(raw json.RawMessage) []seth.Log {
+	var q struct {
+		FromBlock seth.Uint64       `json:"fromBlock"`
+		ToBlock   seth.Uint64       `json:"toBlock"`
+		Address   json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+	}
+	json.Unmarshal(raw, &q)
+	var addrs []seth.Address
+	if len(q.Address) > 0 {
+		var one seth.Address
+		if json.Unmarshal(q.Address, &one) == nil {
+			addrs = []seth.Address{one}
+		} else {
+			json.Unmarshal(q.Address, &addrs)
+		}
+	}
+	out := []seth.Log{}
+outer:
+	for _, l := range c.logs {
+		if *l.BlockNumber < q.FromBlock || *l.BlockNumber > q.ToBlock {
+			continue
+		}
+		found := len(addrs) == 0
+		for i := range addrs {
+			found = found || l.Address == addrs[i]
+		}
+		if !found || len(l.Topics) < len(q.Topics) {
+			continue
+		}
+		for i := range q.Topics {
+			if !matches(hashes(q.Topics[i]), l.Topics[i]) {
+				continue outer
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func (c *chain) Execute(req *seth.RPCRequest, res *seth.RPCResponse) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res.ID = req.ID
+	switch req.Method {
+	case "eth_newFilter":
+		id := int64(len(c.filters) + 1)
+		c.filters[id] = req.Params[0]
+		res.Result, _ = json.Marshal(seth.Uint64(id))
+	case "eth_getFilterLogs":
+		var id seth.Uint64
+		json.Unmarshal(req.Params[0], &id)
+		res.Result, _ = json.Marshal(c.query(c.filters[int64(id)]))
+	case "eth_getLogs":
+		res.Result, _ = json.Marshal(c.query(req.Params[0]))
+	case "eth_uninstallFilter":
+		res.Result = json.RawMessage("true")
+	case "eth_call":
+		var opts struct {
+			Data seth.Data `json:"data"`
+		}
+		json.Unmarshal(req.Params[0], &opts)
+		var who seth.Address
+		copy(who[:], opts.Data[16:])
+		var out seth.Hash
+		word(out[:], c.balances[who])
+		res.Result, _ = json.Marshal(out)
+	default:
+		return fmt.Errorf("unexpected method %s", req.Method)
+	}
+	return nil
+}
+
+func TestLedger(t *testing.T) {
+	var mint, alice, bob, carol seth.Address
+	alice[0], bob[0], carol[0] = 1, 2, 3
+	c := &chain{filters: make(map[int64]json.RawMessage)}
+	c.transfer(10, 0, mint, alice, 1000)
+	c.transfer(12, 0, alice, bob, 300)
+	c.transfer(12, 1, bob, carol, 100)
+	c.transfer(15, 0, alice, alice, 50) // to self
+	c.transfer(20, 3, bob, alice, 200)
+
+	l, err := New(seth.NewClientTransport(c), []cc.Currency{tok}, []seth.Address{alice, bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Replay(0, 14); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Replay(16, 3000); err != ErrNotContiguous {
+		t.Fatal("expected ErrNotContiguous; got", err)
+	}
+	if err := l.Replay(15, 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	balance := func(addr seth.Address, block int64) string {
+		a, err := l.BalanceAt(tok, &addr, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.String()
+	}
+	cases := []struct {
+		addr  seth.Address
+		block int64
+		want  string
+	}{
+		{alice, 9, "0.00 LEDGERTEST"},
+		{alice, 10, "10.00 LEDGERTEST"},
+		{alice, 12, "7.00 LEDGERTEST"},
+		{bob, 12, "2.00 LEDGERTEST"},
+		{alice, 15, "7.00 LEDGERTEST"},
+		{alice, 20, "9.00 LEDGERTEST"},
+		{bob, 30, "0.00 LEDGERTEST"},
+		{carol, 30, "0.00 LEDGERTEST"}, // not tracked
+	}
+	for _, c := range cases {
+		if got := balance(c.addr, c.block); got != c.want {
+			t.Errorf("balance of %x at %d: got %s, want %s", c.addr[:1], c.block, got, c.want)
+		}
+	}
+	snap, err := l.Snapshot(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap) != 2 || snap[0].Addr != alice || snap[1].Addr != bob {
+		t.Errorf("unexpected snapshot %v", snap)
+	}
+
+	// alice's balance shrank without a transfer
+	c.balances = map[seth.Address]int64{alice: 890}
+	ms, err := l.Reconcile(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Addr != alice || ms[0].Diff().String() != "-0.10 LEDGERTEST" {
+		t.Fatalf("unexpected mismatches %+v", ms)
+	}
+}
+
+func TestLedgerOpen(t *testing.T) {
+	t.Parallel()
+	var mint, alice, bob seth.Address
+	alice[0], bob[0] = 1, 2
+	c := &chain{filters: make(map[int64]json.RawMessage)}
+	c.transfer(10, 0, mint, alice, 1000)
+	c.transfer(12, 0, alice, bob, 300)
+	c.balances = map[seth.Address]int64{alice: 1000}
+
+	l, err := New(seth.NewClientTransport(c), []cc.Currency{tok}, []seth.Address{alice, bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Open(11); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Replay(12, 20); err != nil {
+		t.Fatal(err)
+	}
+	for block, want := range map[int64]string{11: "10.00 LEDGERTEST", 12: "7.00 LEDGERTEST"} {
+		a, err := l.BalanceAt(tok, &alice, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.String() != want {
+			t.Errorf("balance at %d: got %s, want %s", block, a, want)
+		}
+	}
+	// nothing is known about the balances before block 11
+	if _, err := l.BalanceAt(tok, &alice, 10); err == nil {
+		t.Error("expected an error for a block before Open")
+	}
+	if _, err := l.Snapshot(10); err == nil {
+		t.Error("expected an error for a block before Open")
+	}
+	if _, err := l.Reconcile(10); err == nil {
+		t.Error("expected an error for a block before Open")
+	}
+}
@@ -0,0 +1,359 @@
+package seth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call describes a single completed RPC call.
+type Call struct {
+	Method  string
+	Latency time.Duration
+	ReqSize int   // size of the request parameters, in bytes
+	ResSize int   // size of the result, in bytes
+	Code    int   // RPC error code, or zero
+	Err     error // transport or RPC error, if any (but not ErrNotFound)
+}
+
+// Collector receives measurements from a MeteredTransport.
+// Collectors must be safe to call from multiple goroutines.
+type Collector interface {
+	Observe(c *Call)
+}
+
+// Limit is a token-bucket rate limit.
+type Limit struct {
+	Rate  float64 // requests per second
+	Burst int     // maximum burst size; at least 1
+}
+
+// MethodClass is the default classification of
+// methods for the purposes of rate limiting. It
+// returns one of "write", "filter", "logs", "call",
+// "trace", or "read".
+func MethodClass(method string) string {
+	switch {
+	case write(method):
+		return "write"
+	case sticky(method):
+		return "filter"
+	case method == "eth_getLogs":
+		return "logs"
+	case method == "eth_call" || method == "eth_estimateGas":
+		return "call"
+	case strings.HasPrefix(method, "debug_") || strings.HasPrefix(method, "trace_"):
+		return "trace"
+	}
+	return "read"
+}
+
+// MeteredTransport is a Transport middleware that
+// measures requests, calls hooks before and after each
+// request, and enforces per-class rate limits.
+type MeteredTransport struct {
+	Transport
+
+	// Collector, if non-nil, receives
+	// a measurement of every call.
+	Collector Collector
+
+	// Before, if non-nil, is called
+	// before each request is sent.
+	Before func(req *RPCRequest)
+
+	// After, if non-nil, is called after each
+	// request completes with the response and
+	// error returned by the underlying Transport.
+	After func(req *RPCRequest, res *RPCResponse, err error, latency time.Duration)
+
+	// Limits maps method classes to rate limits.
+	// The special class "*" applies to every request
+	// in addition to its own class. Requests that exceed
+	// their limit block until they are allowed to proceed.
+	Limits map[string]Limit
+
+	// Class maps methods to classes. If it
+	// is nil, MethodClass is used.
+	Class func(method string) string
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	lock   sync.Mutex
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket, returning
+// how long the caller must wait before proceeding
+func (b *bucket) take(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	burst := float64(b.limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 || b.limit.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+func (m *MeteredTransport) bucket(class string) *bucket {
+	l, ok := m.Limits[class]
+	if !ok {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.buckets == nil {
+		m.buckets = make(map[string]*bucket)
+	}
+	b := m.buckets[class]
+	if b == nil {
+		b = &bucket{limit: l}
+		m.buckets[class] = b
+	}
+	return b
+}
+
+func (m *MeteredTransport) wait(method string) {
+	if len(m.Limits) == 0 {
+		return
+	}
+	class := m.Class
+	if class == nil {
+		class = MethodClass
+	}
+	var d time.Duration
+	now := time.Now()
+	for _, c := range []string{"*", class(method)} {
+		if b := m.bucket(c); b != nil {
+			if w := b.take(now); w > d {
+				d = w
+			}
+		}
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Execute implements Transport.
+func (m *MeteredTransport) Execute(req *RPCRequest, res *RPCResponse) error {
+	m.wait(req.Method)
+	if m.Before != nil {
+		m.Before(req)
+	}
+	start := time.Now()
+	err := m.Transport.Execute(req, res)
+	latency := time.Since(start)
+	if m.After != nil {
+		m.After(req, res, err, latency)
+	}
+	if m.Collector != nil {
+		c := &Call{
+			Method:  req.Method,
+			Latency: latency,
+			ResSize: len(res.Result),
+		}
+		for i := range req.Params {
+			c.ReqSize += len(req.Params[i])
+		}
+		switch e := err.(type) {
+		case nil:
+			if res.Error.Code != 0 || res.Error.Message != "" {
+				re := res.Error
+				c.Code, c.Err = re.Code, &re
+			}
+		case *RPCError:
+			c.Code, c.Err = e.Code, e
+		default:
+			if err != ErrNotFound {
+				c.Err = err
+			}
+		}
+		m.Collector.Observe(c)
+	}
+	return err
+}
+
+// DefaultBuckets are the default latency
+// histogram bucket bounds, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram is a cumulative histogram
+// in the style of a Prometheus histogram.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // upper bounds of each bucket
+	Counts []int64   `json:"counts"` // Counts[i] = observations <= Bounds[i]
+	Count  int64     `json:"count"`  // total observations
+	Sum    float64   `json:"sum"`    // sum of observations
+}
+
+func (h *Histogram) observe(v float64) {
+	for i := range h.Bounds {
+		if v <= h.Bounds[i] {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// MethodStats are the statistics
+// collected by Metrics for one method.
+type MethodStats struct {
+	Calls    int64         `json:"calls"`
+	Errors   map[int]int64 `json:"errors"`   // RPC errors by code
+	Failures int64         `json:"failures"` // transport errors
+	ReqBytes int64         `json:"request_bytes"`
+	ResBytes int64         `json:"response_bytes"`
+	Latency  Histogram     `json:"latency"` // seconds
+}
+
+// Metrics is a Collector that keeps per-method statistics.
+// Metrics implements expvar.Var, so it can be published with
+//
+//	expvar.Publish("rpc", m)
+//
+// and it can also write the Prometheus text exposition format
+// via WritePrometheus.
+type Metrics struct {
+	// Buckets are the latency histogram bounds, in seconds.
+	// If it is nil, DefaultBuckets is used. It must not be
+	// modified after the first call to Observe.
+	Buckets []float64
+
+	lock    sync.Mutex
+	methods map[string]*MethodStats
+}
+
+// Observe implements Collector.
+func (m *Metrics) Observe(c *Call) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.methods == nil {
+		m.methods = make(map[string]*MethodStats)
+	}
+	s := m.methods[c.Method]
+	if s == nil {
+		bounds := m.Buckets
+		if bounds == nil {
+			bounds = DefaultBuckets
+		}
+		s = &MethodStats{
+			Errors:  make(map[int]int64),
+			Latency: Histogram{Bounds: bounds, Counts: make([]int64, len(bounds))},
+		}
+		m.methods[c.Method] = s
+	}
+	s.Calls++
+	if c.Code != 0 {
+		s.Errors[c.Code]++
+	} else if c.Err != nil {
+		s.Failures++
+	}
+	s.ReqBytes += int64(c.ReqSize)
+	s.ResBytes += int64(c.ResSize)
+	s.Latency.observe(c.Latency.Seconds())
+}
+
+// Snapshot returns a copy of the current statistics.
+func (m *Metrics) Snapshot() map[string]MethodStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := make(map[string]MethodStats, len(m.methods))
+	for k, s := range m.methods {
+		c := *s
+		c.Errors = make(map[int]int64, len(s.Errors))
+		for code, n := range s.Errors {
+			c.Errors[code] = n
+		}
+		c.Latency.Counts = append([]int64(nil), s.Latency.Counts...)
+		out[k] = c
+	}
+	return out
+}
+
+// String implements expvar.Var.
+func (m *Metrics) String() string {
+	buf, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(buf)
+}
+
+func pfloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text
+// exposition format, using 'prefix' as the metric name prefix.
+func (m *Metrics) WritePrometheus(w io.Writer, prefix string) error {
+	snap := m.Snapshot()
+	names := make([]string, 0, len(snap))
+	for k := range snap {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TYPE %s_requests_total counter\n", prefix)
+	for _, n := range names {
+		fmt.Fprintf(&b, "%s_requests_total{method=%q} %d\n", prefix, n, snap[n].Calls)
+	}
+	fmt.Fprintf(&b, "# TYPE %s_errors_total counter\n", prefix)
+	for _, n := range names {
+		s := snap[n]
+		codes := make([]int, 0, len(s.Errors))
+		for c := range s.Errors {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+		for _, c := range codes {
+			fmt.Fprintf(&b, "%s_errors_total{method=%q,code=\"%d\"} %d\n", prefix, n, c, s.Errors[c])
+		}
+		fmt.Fprintf(&b, "%s_errors_total{method=%q,code=\"transport\"} %d\n", prefix, n, s.Failures)
+	}
+	for _, kind := range []string{"request", "response"} {
+		fmt.Fprintf(&b, "# TYPE %s_%s_bytes_total counter\n", prefix, kind)
+		for _, n := range names {
+			v := snap[n].ReqBytes
+			if kind == "response" {
+				v = snap[n].ResBytes
+			}
+			fmt.Fprintf(&b, "%s_%s_bytes_total{method=%q} %d\n", prefix, kind, n, v)
+		}
+	}
+	fmt.Fprintf(&b, "# TYPE %s_latency_seconds histogram\n", prefix)
+	for _, n := range names {
+		h := snap[n].Latency
+		for i := range h.Bounds {
+			fmt.Fprintf(&b, "%s_latency_seconds_bucket{method=%q,le=\"%s\"} %d\n", prefix, n, pfloat(h.Bounds[i]), h.Counts[i])
+		}
+		fmt.Fprintf(&b, "%s_latency_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", prefix, n, h.Count)
+		fmt.Fprintf(&b, "%s_latency_seconds_sum{method=%q} %s\n", prefix, n, pfloat(h.Sum))
+		fmt.Fprintf(&b, "%s_latency_seconds_count{method=%q} %d\n", prefix, n, h.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,112 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeteredTransport(t *testing.T) {
+	t.Parallel()
+	inner := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		switch req.Method {
+		case "eth_blockNumber":
+			res.Result = itox(100)
+		case "eth_getCode":
+			res.Error = RPCError{Code: -32000, Message: "header not found"}
+		case "eth_getTransactionReceipt":
+			return ErrNotFound
+		default:
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	var m Metrics
+	var before, after []string
+	mt := &MeteredTransport{
+		Transport: inner,
+		Collector: &m,
+		Before:    func(req *RPCRequest) { before = append(before, req.Method) },
+		After: func(req *RPCRequest, res *RPCResponse, err error, d time.Duration) {
+			after = append(after, req.Method)
+		},
+	}
+	c := NewClientTransport(mt)
+	for i := 0; i < 3; i++ {
+		if _, err := c.BlockNumber(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var addr Address
+	c.GetCodeAt(&addr, 5)
+	var h Hash
+	c.GetReceipt(&h)
+	c.GasPrice()
+
+	if len(before) != 6 || len(after) != 6 {
+		t.Errorf("hooks called %d and %d times", len(before), len(after))
+	}
+	snap := m.Snapshot()
+	if s := snap["eth_blockNumber"]; s.Calls != 3 || s.Latency.Count != 3 || s.ResBytes != 3*int64(len(itox(100))) {
+		t.Errorf("bad eth_blockNumber stats: %+v", s)
+	}
+	if s := snap["eth_getCode"]; s.Errors[-32000] != 1 || s.Failures != 0 || s.ReqBytes == 0 {
+		t.Errorf("bad eth_getCode stats: %+v", s)
+	}
+	if s := snap["eth_getTransactionReceipt"]; len(s.Errors) != 0 || s.Failures != 0 {
+		t.Errorf("not found counted as an error: %+v", s)
+	}
+	if s := snap["eth_gasPrice"]; s.Failures != 1 {
+		t.Errorf("bad eth_gasPrice stats: %+v", s)
+	}
+
+	var out map[string]MethodStats
+	if err := json.Unmarshal([]byte(m.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["eth_blockNumber"].Calls != 3 {
+		t.Error("bad expvar output:", m.String())
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf, "rpc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`rpc_requests_total{method="eth_blockNumber"} 3`,
+		`rpc_errors_total{method="eth_getCode",code="-32000"} 1`,
+		`rpc_errors_total{method="eth_gasPrice",code="transport"} 1`,
+		`rpc_latency_seconds_count{method="eth_blockNumber"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("output missing %q", line)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	inner := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.Result = itox(1)
+		return nil
+	})
+	mt := &MeteredTransport{
+		Transport: inner,
+		Limits:    map[string]Limit{"write": {Rate: 20, Burst: 2}},
+	}
+	c := NewClientTransport(mt)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		var out json.RawMessage
+		if err := c.Do("eth_sendRawTransaction", nil, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// two requests burst; the next two wait 50ms each
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("rate-limited writes took only %s", d)
+	}
+}
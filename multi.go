@@ -0,0 +1,412 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoQuorum is returned by a MultiTransport in Quorum
+// mode when too few endpoints agree on a response.
+var ErrNoQuorum = errors.New("seth: no quorum")
+
+// ErrNoEndpoints is returned by a MultiTransport
+// that has no endpoints configured.
+var ErrNoEndpoints = errors.New("seth: no endpoints")
+
+// MultiMode determines how a MultiTransport
+// dispatches requests to its endpoints.
+type MultiMode int
+
+const (
+	// Failover sends each request to the highest-priority
+	// healthy endpoint, and moves on to the next endpoint
+	// if the request fails for any reason other than an
+	// error returned by the RPC server itself.
+	Failover MultiMode = iota
+
+	// Quorum sends read requests to several healthy endpoints
+	// concurrently and requires some number of them to return
+	// identical results. Writes and filter requests are handled
+	// as in Failover mode.
+	Quorum
+
+	// Broadcast behaves like Failover, except that raw
+	// transactions are sent to every endpoint concurrently.
+	Broadcast
+)
+
+// MultiTransport is a Transport that wraps several
+// underlying transports (presumably talking to different
+// nodes or providers) and dispatches requests to them
+// according to its Mode.
+//
+// Endpoints are health-checked with eth_blockNumber at most
+// once per CheckInterval; requests are dispatched according
+// to the results of the most recent check while the next
+// one runs in the background. An endpoint that fails the check,
+// or that trails the highest block number seen by more than
+// MaxLag blocks, is skipped until it passes a later check
+// (unless every endpoint is unhealthy, in which case all of
+// them are tried in priority order).
+//
+// Filters are stateful on the node that created them, so
+// filter requests always go to the highest-priority healthy
+// endpoint. If that endpoint changes, existing filters
+// will stop working.
+type MultiTransport struct {
+	// Endpoints is the list of underlying
+	// transports, in priority order.
+	Endpoints []Transport
+
+	// Mode determines how requests are dispatched.
+	Mode MultiMode
+
+	// MaxLag is the number of blocks an endpoint may trail
+	// the most up-to-date endpoint and still be considered
+	// healthy. If MaxLag is zero, endpoints may not lag at all.
+	MaxLag int64
+
+	// CheckInterval is the minimum interval between health
+	// checks. If it is zero, 15 seconds is used.
+	CheckInterval time.Duration
+
+	// CheckTimeout is the amount of time an endpoint has
+	// to answer a health check before it is considered
+	// unhealthy. If it is zero, 5 seconds is used.
+	CheckTimeout time.Duration
+
+	// Fanout is the number of healthy endpoints to which
+	// a request is sent in Quorum mode. If it is zero,
+	// every healthy endpoint is used.
+	Fanout int
+
+	// Agree is the number of identical responses required
+	// in Quorum mode. If it is zero, a simple majority
+	// of the endpoints that were queried is required.
+	Agree int
+
+	lock     sync.Mutex // guards below
+	checked  time.Time
+	checking bool // a health check is in progress
+	healthy  []bool
+	heights  []int64
+}
+
+// health check requests use negative IDs so that they
+// never collide with the IDs handed out by a Client
+var checkid int64
+
+func (m *MultiTransport) interval() time.Duration {
+	if m.CheckInterval > 0 {
+		return m.CheckInterval
+	}
+	return 15 * time.Second
+}
+
+func (m *MultiTransport) timeout() time.Duration {
+	if m.CheckTimeout > 0 {
+		return m.CheckTimeout
+	}
+	return 5 * time.Second
+}
+
+// ping returns the block number reported by endpoint i,
+// giving up after the check timeout has elapsed
+func (m *MultiTransport) ping(i int) (int64, bool) {
+	type result struct {
+		num int64
+		ok  bool
+	}
+	// buffered so that an endpoint that answers
+	// after the timeout doesn't leak a goroutine
+	done := make(chan result, 1)
+	go func() {
+		req := &RPCRequest{
+			Version: "2.0",
+			Method:  "eth_blockNumber",
+			ID:      int(atomic.AddInt64(&checkid, -1)),
+		}
+		var res RPCResponse
+		if err := m.Endpoints[i].Execute(req, &res); err != nil || res.Error.Code != 0 || res.Error.Message != "" {
+			done <- result{}
+			return
+		}
+		var num Uint64
+		if err := json.Unmarshal(res.Result, &num); err != nil {
+			done <- result{}
+			return
+		}
+		done <- result{int64(num), true}
+	}()
+	t := time.NewTimer(m.timeout())
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.num, r.ok
+	case <-t.C:
+		return 0, false
+	}
+}
+
+// check updates the health of every endpoint.
+// The caller must not hold m.lock, since the
+// health checks themselves may take a while.
+func (m *MultiTransport) check() {
+	n := len(m.Endpoints)
+	heights := make([]int64, n)
+	ok := make([]bool, n)
+	var wg sync.WaitGroup
+	for i := range m.Endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			heights[i], ok[i] = m.ping(i)
+		}(i)
+	}
+	wg.Wait()
+
+	var max int64
+	for i := range heights {
+		if ok[i] && heights[i] > max {
+			max = heights[i]
+		}
+	}
+	for i := range ok {
+		if ok[i] && max-heights[i] > m.MaxLag {
+			ok[i] = false
+		}
+	}
+	m.lock.Lock()
+	m.healthy, m.heights = ok, heights
+	m.checked = time.Now()
+	m.checking = false
+	m.lock.Unlock()
+}
+
+// order returns the endpoint indices in the order in which they
+// should be tried, along with the number of healthy endpoints
+// (which always come first).
+//
+// The ordering is based on the most recent health check.
+// Stale results are refreshed in the background; only
+// the very first request waits for a health check.
+func (m *MultiTransport) order() ([]int, int) {
+	m.lock.Lock()
+	if len(m.healthy) != len(m.Endpoints) {
+		m.checking = true
+		m.lock.Unlock()
+		m.check()
+		m.lock.Lock()
+	} else if !m.checking && time.Since(m.checked) >= m.interval() {
+		m.checking = true
+		go m.check()
+	}
+	defer m.lock.Unlock()
+	out := make([]int, 0, len(m.Endpoints))
+	for i := range m.healthy {
+		if m.healthy[i] {
+			out = append(out, i)
+		}
+	}
+	good := len(out)
+	for i := range m.healthy {
+		if !m.healthy[i] {
+			out = append(out, i)
+		}
+	}
+	return out, good
+}
+
+// down marks an endpoint as unhealthy until the next health check.
+func (m *MultiTransport) down(i int) {
+	m.lock.Lock()
+	if i < len(m.healthy) {
+		m.healthy[i] = false
+	}
+	m.lock.Unlock()
+}
+
+// Heights returns the block number reported by each
+// endpoint during the most recent health check, or -1
+// for endpoints that are currently considered unhealthy.
+func (m *MultiTransport) Heights() []int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := make([]int64, len(m.Endpoints))
+	for i := range out {
+		if i < len(m.healthy) && m.healthy[i] {
+			out[i] = m.heights[i]
+		} else {
+			out[i] = -1
+		}
+	}
+	return out
+}
+
+// answered returns whether or not err indicates that
+// the endpoint actually processed the request
+// (as opposed to a connection or transport failure).
+func answered(err error) bool {
+	if err == nil || err == ErrNotFound {
+		return true
+	}
+	_, ok := err.(*RPCError)
+	return ok
+}
+
+// stateful methods must always go to the same node
+func sticky(method string) bool {
+	switch method {
+	case "eth_newFilter",
+		"eth_newBlockFilter",
+		"eth_newPendingTransactionFilter",
+		"eth_getFilterChanges",
+		"eth_getFilterLogs",
+		"eth_uninstallFilter":
+		return true
+	}
+	return false
+}
+
+// writes are never subject to a quorum
+func write(method string) bool {
+	switch method {
+	case "eth_sendTransaction",
+		"eth_sendRawTransaction",
+		"eth_sign",
+		"eth_submitWork",
+		"eth_submitHashrate",
+		"personal_unlockAccount":
+		return true
+	}
+	return false
+}
+
+// Execute implements Transport.
+func (m *MultiTransport) Execute(req *RPCRequest, res *RPCResponse) error {
+	if len(m.Endpoints) == 0 {
+		return ErrNoEndpoints
+	}
+	order, good := m.order()
+	switch {
+	case m.Mode == Broadcast && req.Method == "eth_sendRawTransaction":
+		return m.broadcast(req, res, order)
+	case m.Mode == Quorum && !sticky(req.Method) && !write(req.Method):
+		if good == 0 {
+			return ErrNoQuorum
+		}
+		return m.quorum(req, res, order[:good])
+	default:
+		return m.failover(req, res, order)
+	}
+}
+
+func (m *MultiTransport) failover(req *RPCRequest, res *RPCResponse, order []int) error {
+	var err error
+	for _, i := range order {
+		*res = RPCResponse{}
+		err = m.Endpoints[i].Execute(req, res)
+		if answered(err) {
+			return err
+		}
+		m.down(i)
+	}
+	return err
+}
+
+type multiresult struct {
+	res RPCResponse
+	err error
+}
+
+// fanout executes a request on each of the given endpoints
+// concurrently and returns the results in the same order.
+func (m *MultiTransport) fanout(req *RPCRequest, order []int) []multiresult {
+	out := make([]multiresult, len(order))
+	var wg sync.WaitGroup
+	for j, i := range order {
+		wg.Add(1)
+		go func(j, i int) {
+			defer wg.Done()
+			out[j].err = m.Endpoints[i].Execute(req, &out[j].res)
+			if !answered(out[j].err) {
+				m.down(i)
+			}
+		}(j, i)
+	}
+	wg.Wait()
+	return out
+}
+
+func (m *MultiTransport) broadcast(req *RPCRequest, res *RPCResponse, order []int) error {
+	results := m.fanout(req, order)
+	// prefer any success; otherwise, prefer
+	// an answer from the node with the highest priority
+	for i := range results {
+		r := &results[i]
+		if r.err == nil && r.res.Error.Code == 0 && r.res.Error.Message == "" {
+			*res = r.res
+			return nil
+		}
+	}
+	for i := range results {
+		if answered(results[i].err) {
+			*res = results[i].res
+			return results[i].err
+		}
+	}
+	return results[0].err
+}
+
+// key returns a string that is identical for identical
+// responses, or the empty string if r is not a valid response
+func (r *multiresult) key() string {
+	switch e := r.err.(type) {
+	case nil:
+	case *RPCError:
+		return "error " + strconv.Itoa(e.Code) + " " + e.Message
+	default:
+		if r.err == ErrNotFound {
+			return "null"
+		}
+		return ""
+	}
+	if r.res.Error.Code != 0 || r.res.Error.Message != "" {
+		return "error " + strconv.Itoa(r.res.Error.Code) + " " + r.res.Error.Message
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, r.res.Result); err != nil {
+		return ""
+	}
+	return "result " + buf.String()
+}
+
+func (m *MultiTransport) quorum(req *RPCRequest, res *RPCResponse, healthy []int) error {
+	n := m.Fanout
+	if n <= 0 || n > len(healthy) {
+		n = len(healthy)
+	}
+	need := m.Agree
+	if need <= 0 {
+		need = n/2 + 1
+	}
+	results := m.fanout(req, healthy[:n])
+	counts := make(map[string]int, n)
+	for i := range results {
+		k := results[i].key()
+		if k == "" {
+			continue
+		}
+		counts[k]++
+		if counts[k] >= need {
+			*res = results[i].res
+			return results[i].err
+		}
+	}
+	return ErrNoQuorum
+}
@@ -0,0 +1,195 @@
+package seth
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tportFunc is a Transport implemented by a function.
+type tportFunc func(req *RPCRequest, res *RPCResponse) error
+
+func (f tportFunc) Execute(req *RPCRequest, res *RPCResponse) error { return f(req, res) }
+
+// fakeNode returns a transport that reports the given block
+// number and answers every other request with 'result'
+func fakeNode(height int64, result string, calls *int64) Transport {
+	return tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		if req.Method == "eth_blockNumber" {
+			res.Result = itox(height)
+			return nil
+		}
+		atomic.AddInt64(calls, 1)
+		res.Result = json.RawMessage(result)
+		return nil
+	})
+}
+
+var errDown = errors.New("connection refused")
+
+func deadNode(calls *int64) Transport {
+	return tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		atomic.AddInt64(calls, 1)
+		return errDown
+	})
+}
+
+func TestMultiFailover(t *testing.T) {
+	t.Parallel()
+	var c0, c1, c2 int64
+	m := &MultiTransport{
+		Endpoints: []Transport{
+			fakeNode(100, `"0x1"`, &c0), // lagging
+			deadNode(&c1),
+			fakeNode(110, `"0x2"`, &c2),
+		},
+		MaxLag: 5,
+	}
+	c := NewClientTransport(m)
+	var out Uint64
+	if err := c.Do("eth_getBalance", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != 2 {
+		t.Errorf("got result %d from lagging node", out)
+	}
+	if c0 != 0 {
+		t.Error("lagging node was queried")
+	}
+	if h := m.Heights(); h[0] != -1 || h[1] != -1 || h[2] != 110 {
+		t.Errorf("unexpected heights %v", h)
+	}
+
+	// without the up-to-date node, the
+	// lagging node becomes the primary
+	m.Endpoints = m.Endpoints[:2]
+	m.healthy = nil
+	if err := c.Do("eth_getBalance", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != 1 {
+		t.Errorf("expected result from lagging node; got %d", out)
+	}
+}
+
+func TestMultiQuorum(t *testing.T) {
+	t.Parallel()
+	var calls int64
+	m := &MultiTransport{
+		Mode: Quorum,
+		Endpoints: []Transport{
+			fakeNode(10, `"0x1"`, &calls),
+			fakeNode(10, `"0x2"`, &calls),
+			fakeNode(10, ` "0x2" `, &calls),
+		},
+	}
+	c := NewClientTransport(m)
+	var out Uint64
+	if err := c.Do("eth_getBalance", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != 2 {
+		t.Errorf("expected majority result 2; got %d", out)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls; got %d", calls)
+	}
+
+	m.Agree = 3
+	if err := c.Do("eth_getBalance", nil, &out); err != ErrNoQuorum {
+		t.Errorf("expected ErrNoQuorum; got %v", err)
+	}
+
+	// writes go to a single node
+	calls = 0
+	if err := c.Do("eth_sendRawTransaction", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call for a write; got %d", calls)
+	}
+}
+
+func TestMultiBroadcast(t *testing.T) {
+	t.Parallel()
+	var c0, c1, c2 int64
+	rejected := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if req.Method == "eth_blockNumber" {
+			res.Result = itox(10)
+			return nil
+		}
+		atomic.AddInt64(&c0, 1)
+		res.Error = RPCError{Code: -32000, Message: "already known"}
+		return nil
+	})
+	m := &MultiTransport{
+		Mode: Broadcast,
+		Endpoints: []Transport{
+			rejected,
+			deadNode(&c1),
+			fakeNode(10, `"0x0000000000000000000000000000000000000000000000000000000000000001"`, &c2),
+		},
+	}
+	c := NewClientTransport(m)
+	h, err := c.RawCall([]byte{0x1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h[31] != 1 {
+		t.Errorf("unexpected hash %s", &h)
+	}
+	if c0 != 1 || c2 != 1 {
+		t.Errorf("raw transaction not sent to every endpoint: %d %d", c0, c2)
+	}
+
+	// reads are not broadcast
+	var out Data
+	if err := c.Do("eth_getCode", nil, &out); err == nil {
+		t.Error("expected an error from the highest-priority endpoint")
+	}
+	if c2 != 1 {
+		t.Error("read was broadcast")
+	}
+}
+
+func TestMultiCheckTimeout(t *testing.T) {
+	t.Parallel()
+	var c0, c1 int64
+	hang := make(chan struct{})
+	defer close(hang)
+	slow := tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if req.Method == "eth_blockNumber" {
+			<-hang
+		}
+		atomic.AddInt64(&c0, 1)
+		res.Result = json.RawMessage(`"0x1"`)
+		return nil
+	})
+	m := &MultiTransport{
+		Endpoints:     []Transport{slow, fakeNode(10, `"0x2"`, &c1)},
+		CheckTimeout:  10 * time.Millisecond,
+		CheckInterval: time.Nanosecond,
+	}
+	c := NewClientTransport(m)
+	var out Uint64
+	for i := 0; i < 3; i++ {
+		// subsequent requests use the last known ordering
+		// rather than waiting for the endpoint that hangs
+		start := time.Now()
+		if err := c.Do("eth_getBalance", nil, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != 2 {
+			t.Errorf("got result %d from an endpoint that failed its check", out)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request took %s", d)
+		}
+	}
+	if atomic.LoadInt64(&c0) != 0 {
+		t.Error("endpoint that failed its check was queried")
+	}
+}
@@ -0,0 +1,217 @@
+package seth
+
+import (
+	"bytes"
+	"math/big"
+)
+
+var (
+	// ERC721Transfer is the hash of the ERC721 Transfer event.
+	// It is identical to ERC20Transfer; ERC721 transfers are
+	// distinguished by their indexed token ID.
+	ERC721Transfer = ERC20Transfer
+	// ERC1155TransferSingle is the hash of the ERC1155 TransferSingle event
+	ERC1155TransferSingle = HashString("TransferSingle(address,address,address,uint256,uint256)")
+	// ERC1155TransferBatch is the hash of the ERC1155 TransferBatch event
+	ERC1155TransferBatch = HashString("TransferBatch(address,address,address,uint256[],uint256[])")
+)
+
+// NFTStandard is the token standard of an NFTTransfer.
+type NFTStandard int
+
+const (
+	// ERC721 is a non-fungible token.
+	ERC721 NFTStandard = iota
+	// ERC1155 is a multi-token contract.
+	ERC1155
+)
+
+func (s NFTStandard) String() string {
+	switch s {
+	case ERC721:
+		return "ERC721"
+	case ERC1155:
+		return "ERC1155"
+	}
+	return "unknown"
+}
+
+// NFTTransfer represents the transfer of a quantity of one
+// ERC721 or ERC1155 token. An ERC1155 TransferBatch event
+// is represented by one NFTTransfer per token ID.
+type NFTTransfer struct {
+	Standard NFTStandard
+	Block    int64   // block number
+	TxHeight int     // index of transaction in block
+	Token    Address // address of contract
+	Operator Address // 'operator' argument (ERC1155 only)
+	From     Address // 'from' argument in transfer
+	To       Address // 'to' argument in transfer
+	ID       Int     // token ID
+	Amount   Int     // value amount; always 1 for ERC721
+}
+
+// ParseNFTTransfers tries to parse a log as an ERC721 or
+// ERC1155 transfer event. The block number and transaction
+// index are taken from the log, if it has them. The events
+// recognized are
+//
+//	event Transfer(address indexed from, address indexed to, uint256 indexed tokenId);
+//	event TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value);
+//	event TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values);
+//
+// as well as the pre-standard ERC721 Transfer event
+// with no indexed arguments. ERC20 transfers are not
+// recognized.
+func ParseNFTTransfers(l *Log) ([]NFTTransfer, bool) {
+	if len(l.Topics) == 0 {
+		return nil, false
+	}
+	for i := range l.Topics {
+		if len(l.Topics[i]) != 32 {
+			return nil, false
+		}
+	}
+	base := NFTTransfer{Token: l.Address}
+	if l.BlockNumber != nil {
+		base.Block = int64(*l.BlockNumber)
+	}
+	if l.TxIndex != nil {
+		base.TxHeight = int(*l.TxIndex)
+	}
+	topic := l.Topics[0]
+	switch {
+	case bytes.Equal(topic, ERC721Transfer[:]) && len(l.Topics) == 4 && len(l.Data) == 0:
+		base.Standard = ERC721
+		copy(base.From[:], l.Topics[1][12:])
+		copy(base.To[:], l.Topics[2][12:])
+		setdata(&base.ID, l.Topics[3])
+		(*big.Int)(&base.Amount).SetInt64(1)
+		return []NFTTransfer{base}, true
+	case bytes.Equal(topic, ERC721Transfer[:]) && len(l.Topics) == 1 && len(l.Data) == 96:
+		base.Standard = ERC721
+		copy(base.From[:], l.Data[12:32])
+		copy(base.To[:], l.Data[44:64])
+		setdata(&base.ID, l.Data[64:])
+		(*big.Int)(&base.Amount).SetInt64(1)
+		return []NFTTransfer{base}, true
+	case bytes.Equal(topic, ERC1155TransferSingle[:]) && len(l.Topics) == 4 && len(l.Data) == 64:
+		base.Standard = ERC1155
+		base.setparties(l)
+		setdata(&base.ID, l.Data[:32])
+		setdata(&base.Amount, l.Data[32:])
+		return []NFTTransfer{base}, true
+	case bytes.Equal(topic, ERC1155TransferBatch[:]) && len(l.Topics) == 4:
+		base.Standard = ERC1155
+		base.setparties(l)
+		ids, ok := abiwords(l.Data, 0)
+		if !ok {
+			return nil, false
+		}
+		values, ok := abiwords(l.Data, 1)
+		if !ok || len(values) != len(ids) {
+			return nil, false
+		}
+		out := make([]NFTTransfer, len(ids))
+		for i := range ids {
+			out[i] = base
+			setdata(&out[i].ID, ids[i])
+			setdata(&out[i].Amount, values[i])
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// ParseNFTTransfers tries to parse this log as an ERC721
+// or ERC1155 transfer event. See ParseNFTTransfers.
+func (r *Receipt) ParseNFTTransfers(l *Log) ([]NFTTransfer, bool) {
+	out, ok := ParseNFTTransfers(l)
+	for i := range out {
+		out[i].Block = int64(r.BlockNumber)
+		out[i].TxHeight = int(r.Index)
+	}
+	return out, ok
+}
+
+func (t *NFTTransfer) setparties(l *Log) {
+	copy(t.Operator[:], l.Topics[1][12:])
+	copy(t.From[:], l.Topics[2][12:])
+	copy(t.To[:], l.Topics[3][12:])
+}
+
+// abiwords decodes the ABI-encoded uint256[]
+// that is argument n of the ABI-encoded data
+func abiwords(data []byte, n int) ([][]byte, bool) {
+	word := func(at int) (int, bool) {
+		if at < 0 || at+32 > len(data) {
+			return 0, false
+		}
+		w := new(big.Int).SetBytes(data[at : at+32])
+		if !w.IsInt64() || w.Int64() > int64(len(data)) {
+			return 0, false
+		}
+		return int(w.Int64()), true
+	}
+	off, ok := word(n * 32)
+	if !ok {
+		return nil, false
+	}
+	size, ok := word(off)
+	if !ok || off+32+size*32 > len(data) {
+		return nil, false
+	}
+	out := make([][]byte, size)
+	for i := range out {
+		start := off + 32 + i*32
+		out[i] = data[start : start+32]
+	}
+	return out, true
+}
+
+// ERC721TransferQuery returns a query that matches ERC721
+// transfers from 'from' to 'to' of the token 'tok'. Nil
+// arguments match any address. ERC20 transfers, which share
+// the event signature, are excluded because the query requires
+// a fourth topic (the token ID), so pre-standard ERC721 events
+// without indexed arguments are excluded as well. The block
+// range of the query is left empty.
+func ERC721TransferQuery(from, to, tok *Address) *FilterQuery {
+	q := TransferQuery(from, to, tok)
+	q.Topics = append(q.Topics, nil)
+	return q
+}
+
+// ERC1155TransferQuery returns a query that matches ERC1155
+// TransferSingle and TransferBatch events from 'from' to 'to'
+// of the token 'tok'. Nil arguments match any address. The
+// block range of the query is left empty.
+func ERC1155TransferQuery(from, to, tok *Address) *FilterQuery {
+	var hashes [4]Hash
+	var args [4]*Hash
+	if from != nil {
+		copy(hashes[2][12:], from[:])
+		args[2] = &hashes[2]
+	}
+	if to != nil {
+		copy(hashes[3][12:], to[:])
+		args[3] = &hashes[3]
+	}
+	q := query(args[:], tok, 0, 0)
+	q.Topics[0] = []Hash{ERC1155TransferSingle, ERC1155TransferBatch}
+	return q
+}
+
+// ERC721Transfers returns a filter that searches for ERC721
+// transfers matching the given arguments, in the same manner
+// as TokenTransfers.
+func (c *Client) ERC721Transfers(from, to, tok *Address, start, end int64) (*Filter, error) {
+	return c.transfers(ERC721TransferQuery(from, to, tok), start, end)
+}
+
+// ERC1155Transfers returns a filter that searches for ERC1155
+// transfers matching the given arguments, in the same manner
+// as TokenTransfers.
+func (c *Client) ERC1155Transfers(from, to, tok *Address, start, end int64) (*Filter, error) {
+	return c.transfers(ERC1155TransferQuery(from, to, tok), start, end)
+}
@@ -0,0 +1,140 @@
+package seth
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestParseNFTTransfers(t *testing.T) {
+	t.Parallel()
+	tok, op, from, to := Address{0xaa}, Address{1}, Address{2}, Address{3}
+	pad := func(a Address) Data {
+		var h Hash
+		copy(h[12:], a[:])
+		return h[:]
+	}
+	word := func(v int64) Data {
+		var h Hash
+		b := big.NewInt(v).Bytes()
+		copy(h[32-len(b):], b)
+		return h[:]
+	}
+	cat := func(ws ...Data) Data {
+		var out Data
+		for _, w := range ws {
+			out = append(out, w...)
+		}
+		return out
+	}
+	num, idx := Uint64(7), Uint64(2)
+	cases := []struct {
+		name string
+		log  Log
+		want []NFTTransfer // nil means rejected
+	}{
+		{
+			name: "erc20",
+			log:  Log{Topics: []Data{ERC20Transfer[:], pad(from), pad(to)}, Data: word(5)},
+		},
+		{
+			name: "erc721",
+			log:  Log{Topics: []Data{ERC721Transfer[:], pad(from), pad(to), word(42)}},
+			want: []NFTTransfer{{Standard: ERC721, From: from, To: to}},
+		},
+		{
+			name: "erc721 unindexed",
+			log:  Log{Topics: []Data{ERC721Transfer[:]}, Data: cat(pad(from), pad(to), word(42))},
+			want: []NFTTransfer{{Standard: ERC721, From: from, To: to}},
+		},
+		{
+			name: "single",
+			log:  Log{Topics: []Data{ERC1155TransferSingle[:], pad(op), pad(from), pad(to)}, Data: cat(word(42), word(10))},
+			want: []NFTTransfer{{Standard: ERC1155, Operator: op, From: from, To: to}},
+		},
+		{
+			name: "batch",
+			log: Log{
+				Topics: []Data{ERC1155TransferBatch[:], pad(op), pad(from), pad(to)},
+				Data:   cat(word(64), word(160), word(2), word(42), word(43), word(2), word(10), word(11)),
+			},
+			want: []NFTTransfer{
+				{Standard: ERC1155, Operator: op, From: from, To: to},
+				{Standard: ERC1155, Operator: op, From: from, To: to},
+			},
+		},
+		{
+			name: "batch truncated",
+			log: Log{
+				Topics: []Data{ERC1155TransferBatch[:], pad(op), pad(from), pad(to)},
+				Data:   cat(word(64), word(160), word(2), word(42), word(43), word(2), word(10)),
+			},
+		},
+	}
+	for _, c := range cases {
+		c.log.Address = tok
+		c.log.BlockNumber, c.log.TxIndex = &num, &idx
+		got, ok := ParseNFTTransfers(&c.log)
+		if ok != (c.want != nil) || len(got) != len(c.want) {
+			t.Errorf("%s: got %v %v", c.name, got, ok)
+			continue
+		}
+		for i := range got {
+			g, w := &got[i], &c.want[i]
+			if g.Standard != w.Standard || g.Operator != w.Operator || g.From != w.From || g.To != w.To ||
+				g.Token != tok || g.Block != 7 || g.TxHeight != 2 {
+				t.Errorf("%s: got %+v", c.name, g)
+			}
+			id, amt := g.ID.Int64(), g.Amount.Int64()
+			switch {
+			case w.Standard == ERC721 && (id != 42 || amt != 1),
+				c.name == "single" && (id != 42 || amt != 10),
+				c.name == "batch" && (id != int64(42+i) || amt != int64(10+i)):
+				t.Errorf("%s: got id %d amount %d", c.name, id, amt)
+			}
+		}
+	}
+
+	var r Receipt
+	if _, ok := r.ParseTransfer(&cases[1].log); ok {
+		t.Error("ParseTransfer accepted an ERC721 transfer")
+	}
+	if _, ok := r.ParseTransfer(&cases[0].log); !ok {
+		t.Error("ParseTransfer rejected an ERC20 transfer")
+	}
+}
+
+func TestNFTQueries(t *testing.T) {
+	t.Parallel()
+	from, to := Address{2}, Address{3}
+	var f, tt Hash
+	copy(f[12:], from[:])
+	copy(tt[12:], to[:])
+	enc := func(q *FilterQuery) string {
+		buf, err := json.Marshal(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Topics []json.RawMessage `json:"topics"`
+		}
+		json.Unmarshal(buf, &out)
+		buf, _ = json.Marshal(out.Topics)
+		return string(buf)
+	}
+	hex := func(h Hash) string { return `"` + h.String() + `"` }
+	want := "[" + hex(ERC721Transfer) + ",null," + hex(tt) + ",null]"
+	if got := enc(ERC721TransferQuery(nil, &to, nil)); got != want {
+		t.Errorf("erc721: got %s, want %s", got, want)
+	}
+	// the trailing wildcard excludes ERC20 transfers
+	erc20 := Log{Topics: []Data{ERC721Transfer[:], f[:], tt[:]}}
+	erc721 := Log{Topics: []Data{ERC721Transfer[:], f[:], tt[:], make(Data, 32)}}
+	if q := ERC721TransferQuery(nil, &to, nil); q.Matches(&erc20) || !q.Matches(&erc721) {
+		t.Error("erc721: query matches the wrong logs")
+	}
+	want = "[[" + hex(ERC1155TransferSingle) + "," + hex(ERC1155TransferBatch) + "],null," + hex(f) + ",null]"
+	if got := enc(ERC1155TransferQuery(&from, nil, nil)); got != want {
+		t.Errorf("erc1155: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,383 @@
+package seth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoSubscriptions is returned by Subscribe when
+// the client's transport cannot deliver notifications.
+var ErrNoSubscriptions = errors.New("seth: transport does not support subscriptions")
+
+// Subscriber is implemented by transports that
+// support eth_subscribe notifications. RPCTransport
+// is a Subscriber; HTTP transports are not.
+type Subscriber interface {
+	// Subscribe executes an eth_subscribe request and returns
+	// the subscription id. The result of every notification for
+	// the subscription is sent on 'out' if it is ready to receive;
+	// otherwise the notification is dropped. The channel is closed
+	// if the subscription is lost (e.g. the connection is closed).
+	Subscribe(req *RPCRequest, out chan<- json.RawMessage) (string, error)
+	// Unsubscribe stops delivering notifications for
+	// the subscription. It does not close the channel.
+	Unsubscribe(id string)
+}
+
+// Subscribe creates a subscription with eth_subscribe.
+// The kind of subscription and its arguments are given
+// by params, e.g. "newHeads" or "newPendingTransactions".
+// See Subscriber for how notifications are delivered.
+func (c *Client) Subscribe(out chan<- json.RawMessage, params ...interface{}) (string, error) {
+	s, ok := c.tport.(Subscriber)
+	if !ok {
+		return "", ErrNoSubscriptions
+	}
+	raw := make([]json.RawMessage, len(params))
+	for i := range params {
+		buf, err := json.Marshal(params[i])
+		if err != nil {
+			return "", err
+		}
+		raw[i] = buf
+	}
+	req := &RPCRequest{
+		Version: "2.0",
+		Method:  "eth_subscribe",
+		Params:  raw,
+		ID:      int(atomic.AddUintptr(&c.nextid, 1)),
+	}
+	return s.Subscribe(req, out)
+}
+
+// Unsubscribe cancels a subscription created with Subscribe.
+func (c *Client) Unsubscribe(id string) error {
+	if s, ok := c.tport.(Subscriber); ok {
+		s.Unsubscribe(id)
+	}
+	buf, _ := json.Marshal(id)
+	var out bool
+	return c.Do("eth_unsubscribe", []json.RawMessage{buf}, &out)
+}
+
+// PendingEventType is the type of a PendingEvent.
+type PendingEventType int
+
+const (
+	// PendingSeen means a matching transaction entered the pool.
+	PendingSeen PendingEventType = iota
+	// PendingMined means a seen transaction was mined.
+	PendingMined
+	// PendingReplaced means a seen transaction was replaced by
+	// another transaction with the same sender and nonce.
+	PendingReplaced
+	// PendingDropped means a seen transaction left the
+	// pool without being mined or replaced.
+	PendingDropped
+)
+
+func (p PendingEventType) String() string {
+	switch p {
+	case PendingSeen:
+		return "seen"
+	case PendingMined:
+		return "mined"
+	case PendingReplaced:
+		return "replaced"
+	case PendingDropped:
+		return "dropped"
+	}
+	return "unknown"
+}
+
+// PendingEvent is an event reported by a PendingWatcher.
+type PendingEvent struct {
+	Type PendingEventType
+	Tx   *Transaction
+	// Replacement is the replacing transaction when
+	// Type is PendingReplaced, if it was seen.
+	Replacement *Transaction
+}
+
+// PendingOptions are the options for a PendingWatcher.
+// Each non-empty predicate must be satisfied for a
+// transaction to match; the zero value matches every
+// pending transaction.
+type PendingOptions struct {
+	From      []Address // matches any of these senders
+	To        []Address // matches any of these receivers
+	Selectors [][4]byte // matches calls to any of these methods
+
+	// Match, if non-nil, is an additional predicate.
+	Match func(tx *Transaction) bool
+
+	// Interval is the polling interval for new transactions
+	// (when subscriptions are unavailable) and for the status
+	// of matched transactions. The default is one second.
+	Interval time.Duration
+
+	// Poll forces the watcher to poll with a filter
+	// even if the transport supports subscriptions.
+	Poll bool
+}
+
+func (o *PendingOptions) interval() time.Duration {
+	if o.Interval > 0 {
+		return o.Interval
+	}
+	return time.Second
+}
+
+func (o *PendingOptions) match(tx *Transaction) bool {
+	if len(o.From) > 0 && (tx.From == nil || !hasaddr(o.From, tx.From)) {
+		return false
+	}
+	if len(o.To) > 0 && (tx.To == nil || !hasaddr(o.To, tx.To)) {
+		return false
+	}
+	if len(o.Selectors) > 0 {
+		ok := false
+		for i := range o.Selectors {
+			if bytes.HasPrefix(tx.Input, o.Selectors[i][:]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return o.Match == nil || o.Match(tx)
+}
+
+func hasaddr(list []Address, a *Address) bool {
+	for i := range list {
+		if list[i] == *a {
+			return true
+		}
+	}
+	return false
+}
+
+type sendernonce struct {
+	from  Address
+	nonce Uint64
+}
+
+// PendingWatcher reports pending transactions that
+// match a set of predicates, and then reports whether
+// each of them is mined, replaced, or dropped.
+type PendingWatcher struct {
+	c    *Client
+	opts PendingOptions
+	out  chan PendingEvent
+	done chan struct{}
+	once sync.Once
+
+	// used only by the watcher goroutine
+	watched map[Hash]*Transaction
+	nonces  map[sendernonce]Hash
+	filter  int64 // pending tx filter id, or -1
+	sub     string
+	subch   chan json.RawMessage
+
+	lock sync.Mutex
+	err  error
+}
+
+// WatchPending creates a PendingWatcher. New transactions
+// are received with the newPendingTransactions subscription
+// if the transport supports it, or by polling a filter
+// created with eth_newPendingTransactionFilter otherwise.
+func (c *Client) WatchPending(opts *PendingOptions) (*PendingWatcher, error) {
+	w := &PendingWatcher{
+		c:       c,
+		opts:    *opts,
+		out:     make(chan PendingEvent, 64),
+		done:    make(chan struct{}),
+		watched: make(map[Hash]*Transaction),
+		nonces:  make(map[sendernonce]Hash),
+		filter:  -1,
+	}
+	if err := w.source(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// source subscribes to new transactions,
+// or creates a filter if that fails
+func (w *PendingWatcher) source() error {
+	if !w.opts.Poll {
+		ch := make(chan json.RawMessage, 256)
+		id, err := w.c.Subscribe(ch, "newPendingTransactions")
+		if err == nil {
+			w.sub, w.subch = id, ch
+			return nil
+		}
+	}
+	var id Uint64
+	if err := w.c.Do("eth_newPendingTransactionFilter", nil, &id); err != nil {
+		return err
+	}
+	w.filter = int64(id)
+	return nil
+}
+
+// Events returns the channel of events. The channel is
+// closed when the watcher is stopped or encounters an
+// error, in which case Err() will be non-nil.
+func (w *PendingWatcher) Events() <-chan PendingEvent { return w.out }
+
+// Err returns the error that caused
+// the watcher to stop, if any.
+func (w *PendingWatcher) Err() error {
+	w.lock.Lock()
+	err := w.err
+	w.lock.Unlock()
+	return err
+}
+
+// Stop stops the watcher. It is safe to call Stop
+// more than once and from any goroutine.
+func (w *PendingWatcher) Stop() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *PendingWatcher) seterr(err error) {
+	w.lock.Lock()
+	w.err = err
+	w.lock.Unlock()
+}
+
+func (w *PendingWatcher) emit(ev PendingEvent) bool {
+	select {
+	case w.out <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// add handles a new pending transaction
+func (w *PendingWatcher) add(h *Hash) bool {
+	if _, ok := w.watched[*h]; ok {
+		return true
+	}
+	tx, err := w.c.GetTransaction(h)
+	if err != nil || tx.From == nil {
+		// gone already, or a transient error
+		return true
+	}
+	key := sendernonce{from: *tx.From, nonce: tx.Nonce}
+	if old, ok := w.nonces[key]; ok && old != tx.Hash {
+		prev := w.watched[old]
+		delete(w.watched, old)
+		delete(w.nonces, key)
+		if !w.emit(PendingEvent{Type: PendingReplaced, Tx: prev, Replacement: tx}) {
+			return false
+		}
+	}
+	if !w.opts.match(tx) {
+		return true
+	}
+	w.watched[tx.Hash] = tx
+	w.nonces[key] = tx.Hash
+	return w.emit(PendingEvent{Type: PendingSeen, Tx: tx})
+}
+
+// check determines the status of every watched transaction
+func (w *PendingWatcher) check() bool {
+	for h, tx := range w.watched {
+		cur, err := w.c.GetTransaction(&h)
+		if err == nil && cur.TxIndex == nil {
+			continue // still pending
+		}
+		if err != nil && err != ErrNotFound {
+			continue
+		}
+		ev := PendingEvent{Tx: tx}
+		if err == nil {
+			ev.Type = PendingMined
+			ev.Tx = cur
+		} else {
+			// the transaction is gone; if its nonce
+			// has been used, it was replaced
+			nonce, err := w.c.GetNonceAt(tx.From, Latest)
+			if err != nil {
+				continue
+			}
+			ev.Type = PendingDropped
+			if nonce > int64(tx.Nonce) {
+				ev.Type = PendingReplaced
+			}
+		}
+		delete(w.watched, h)
+		delete(w.nonces, sendernonce{from: *tx.From, nonce: tx.Nonce})
+		if !w.emit(ev) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *PendingWatcher) poll() bool {
+	var hashes []Hash
+	err := w.c.Do("eth_getFilterChanges", []json.RawMessage{itox(w.filter)}, &hashes)
+	if err != nil && err != ErrNotFound {
+		w.seterr(err)
+		return false
+	}
+	for i := range hashes {
+		if !w.add(&hashes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *PendingWatcher) run() {
+	defer close(w.out)
+	defer func() {
+		if w.subch != nil {
+			w.c.Unsubscribe(w.sub)
+		}
+		if w.filter >= 0 {
+			w.c.deleteFilter(w.filter)
+		}
+	}()
+	ticker := time.NewTicker(w.opts.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case buf, ok := <-w.subch:
+			if !ok {
+				// the subscription was lost; fall back to polling
+				w.subch = nil
+				if err := w.source(); err != nil {
+					w.seterr(err)
+					return
+				}
+				continue
+			}
+			var h Hash
+			if json.Unmarshal(buf, &h) == nil && !w.add(&h) {
+				return
+			}
+		case <-ticker.C:
+			if w.filter >= 0 && !w.poll() {
+				return
+			}
+			if !w.check() {
+				return
+			}
+		}
+	}
+}
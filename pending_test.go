@@ -0,0 +1,223 @@
+package seth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mempool is a transport that serves a pending
+// transaction filter over a set of transactions
+type mempool struct {
+	lock   sync.Mutex
+	txs    map[Hash]*Transaction
+	nonces map[Address]int64
+	news   []Hash
+}
+
+func (m *mempool) add(tx *Transaction) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.txs[tx.Hash] = tx
+	m.news = append(m.news, tx.Hash)
+}
+
+func (m *mempool) mine(h Hash) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	idx := Uint64(0)
+	tx := *m.txs[h]
+	tx.TxIndex = &idx
+	m.txs[h] = &tx
+	m.nonces[*tx.From] = int64(tx.Nonce) + 1
+}
+
+func (m *mempool) drop(h Hash) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.txs, h)
+}
+
+func (m *mempool) Execute(req *RPCRequest, res *RPCResponse) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res.ID = req.ID
+	switch req.Method {
+	case "eth_newPendingTransactionFilter":
+		res.Result = itox(7)
+	case "eth_getFilterChanges":
+		res.Result, _ = json.Marshal(m.news)
+		m.news = m.news[:0]
+	case "eth_uninstallFilter":
+		res.Result = rawtrue
+	case "eth_getTransactionByHash":
+		var h Hash
+		json.Unmarshal(req.Params[0], &h)
+		if tx, ok := m.txs[h]; ok {
+			res.Result, _ = json.Marshal(tx)
+		} else {
+			res.Result = rawnull
+		}
+	case "eth_getTransactionCount":
+		var a Address
+		json.Unmarshal(req.Params[0], &a)
+		res.Result = itox(m.nonces[a])
+	default:
+		return fmt.Errorf("unexpected method %s", req.Method)
+	}
+	return nil
+}
+
+func TestPendingWatcher(t *testing.T) {
+	t.Parallel()
+	pool := &mempool{txs: make(map[Hash]*Transaction), nonces: make(map[Address]int64)}
+	me, other, token := Address{1}, Address{2}, Address{3}
+	transfer := [4]byte{0xa9, 0x05, 0x9c, 0xbb}
+	tx := func(name string, from *Address, nonce int, input []byte) *Transaction {
+		return &Transaction{Hash: HashString(name), From: from, To: &token, Nonce: Uint64(nonce), Input: input}
+	}
+
+	w, err := NewClientTransport(pool).WatchPending(&PendingOptions{
+		From:      []Address{me},
+		Selectors: [][4]byte{transfer},
+		Interval:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	next := func(typ PendingEventType, h Hash) *PendingEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatal("watcher stopped:", w.Err())
+			}
+			if ev.Type != typ || ev.Tx.Hash != h {
+				t.Fatalf("got %s %x; want %s %x", ev.Type, ev.Tx.Hash[:4], typ, h[:4])
+			}
+			return &ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", typ)
+		}
+		return nil
+	}
+
+	a := tx("a", &me, 0, transfer[:])
+	pool.add(tx("not mine", &other, 0, transfer[:]))
+	pool.add(tx("not a transfer", &me, 5, nil))
+	pool.add(a)
+	next(PendingSeen, a.Hash)
+	pool.mine(a.Hash)
+	next(PendingMined, a.Hash)
+
+	// b is replaced by a cancellation that doesn't match
+	b := tx("b", &me, 1, transfer[:])
+	pool.add(b)
+	next(PendingSeen, b.Hash)
+	cancel := tx("cancel", &me, 1, nil)
+	pool.add(cancel)
+	pool.drop(b.Hash)
+	ev := next(PendingReplaced, b.Hash)
+	if ev.Replacement == nil || ev.Replacement.Hash != cancel.Hash {
+		t.Fatalf("unexpected replacement %+v", ev.Replacement)
+	}
+
+	// c disappears without its nonce being used
+	c := tx("c", &me, 2, transfer[:])
+	pool.add(c)
+	next(PendingSeen, c.Hash)
+	pool.drop(c.Hash)
+	next(PendingDropped, c.Hash)
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+	cconn, sconn := net.Pipe()
+	go func() {
+		dec, enc := json.NewDecoder(sconn), json.NewEncoder(sconn)
+		for {
+			var req RPCRequest
+			if err := dec.Decode(&req); err != nil {
+				return
+			}
+			switch req.Method {
+			case "eth_subscribe":
+				// the notification immediately follows the response
+				enc.Encode(map[string]interface{}{"id": req.ID, "result": "0xcafe"})
+				enc.Encode(map[string]interface{}{
+					"method": "eth_subscription",
+					"params": map[string]interface{}{"subscription": "0xcafe", "result": HashString("tx")},
+				})
+			default:
+				enc.Encode(map[string]interface{}{"id": req.ID, "result": true})
+			}
+		}
+	}()
+	c := NewClient(func() (io.ReadWriteCloser, error) { return cconn, nil })
+	ch := make(chan json.RawMessage, 1)
+	id, err := c.Subscribe(ch, "newPendingTransactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "0xcafe" {
+		t.Fatalf("got id %q", id)
+	}
+	select {
+	case buf := <-ch:
+		var h Hash
+		if err := json.Unmarshal(buf, &h); err != nil || h != HashString("tx") {
+			t.Fatalf("unexpected notification %s", buf)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	if err := c.Unsubscribe(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClientTransport(new(mempool)).Subscribe(ch, "newHeads"); err != ErrNoSubscriptions {
+		t.Fatal("expected ErrNoSubscriptions; got", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+	me := Address{1}
+	h := HashString("tx")
+	pending, prompts := 1, 0
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			txs := []Transaction{}
+			if pending > 0 {
+				from := me // a distinct pointer
+				txs = append(txs, Transaction{Hash: h, From: &from})
+				pending--
+			}
+			res.Result, _ = json.Marshal(map[string]interface{}{"transactions": txs})
+		case "eth_getTransactionByHash":
+			idx := Uint64(0)
+			res.Result, _ = json.Marshal(Transaction{Hash: h, TxIndex: &idx})
+		default:
+			return fmt.Errorf("unexpected method %s", req.Method)
+		}
+		return nil
+	}))
+	err := NewSender(c, &me).Drain(func(tx *Transaction) {
+		if tx.Hash != h {
+			t.Errorf("unexpected tx %x", tx.Hash)
+		}
+		prompts++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompts != 1 {
+		t.Fatalf("%d prompts", prompts)
+	}
+}
@@ -119,7 +119,8 @@ func (s *Sender) Call(opts *CallOpts) (Hash, error) {
 	tx := opts.Transaction()
 
 	// if no nonce was specified, try to select it
-	if opts.Nonce == nil {
+	auto := opts.Nonce == nil
+	if auto {
 		if tx.From == nil {
 			return Hash{}, fmt.Errorf("Sender.Call: unspecified nonce, and no from address provided")
 		}
@@ -129,29 +130,57 @@ func (s *Sender) Call(opts *CallOpts) (Hash, error) {
 		}
 		tx.Nonce = Uint64(n)
 	}
+	for tries := 0; ; tries++ {
+		raw, err := s.sign(tx, opts.From)
+		if err != nil {
+			return Hash{}, err
+		}
+		h, err := s.RawCall(raw)
+		switch {
+		case errors.Is(err, ErrAlreadyKnown):
+			// the node already has this exact transaction
+			return HashBytes(raw), nil
+		case auto && tries < 3 && errors.Is(err, ErrNonceTooLow):
+			// a transaction from this account was mined
+			// (or submitted elsewhere) since we picked the nonce
+			n, err := s.GetNonceAt(tx.From, Pending)
+			if err != nil {
+				return Hash{}, err
+			}
+			if Uint64(n) > tx.Nonce {
+				tx.Nonce = Uint64(n)
+			} else {
+				tx.Nonce++
+			}
+			continue
+		}
+		return h, err
+	}
+}
+
+// sign signs tx and returns the encoded raw transaction.
+func (s *Sender) sign(tx *Transaction, from *Address) ([]byte, error) {
 	hash := tx.HashToSign()
 
 	sig, err := s.Signer(hash)
 	if err != nil {
-		return Hash{}, err
+		return nil, err
 	}
 
 	// If a from address was provided, verify that the signer produced a
 	// signature for the correct address.
-	if opts.From != nil {
+	if from != nil {
 		pub, err := sig.Recover(hash)
 		if err != nil {
-			return Hash{}, err
+			return nil, err
 		}
-		from := pub.Address()
-		if *from != *opts.From {
-			return Hash{}, fmt.Errorf(
+		if *pub.Address() != *from {
+			return nil, fmt.Errorf(
 				"sender: address mismatch: expected %v, got %v",
-				opts.From, pub.Address())
+				from, pub.Address())
 		}
 	}
-
-	return s.RawCall(tx.Encode(sig))
+	return tx.Encode(sig), nil
 }
 
 // Send makes a contract call from the sender address.
@@ -176,7 +205,12 @@ func (s *Sender) Cancel(h *Hash) (Hash, error) {
 	} else {
 		opts.GasPrice = NewInt(tx.GasPrice.Int64() + 1)
 	}
-	return s.Call(&opts)
+	ch, err := s.Call(&opts)
+	if errors.Is(err, ErrNonceTooLow) {
+		// the transaction was mined in the meantime
+		return Hash{}, ErrCannotCancel
+	}
+	return ch, err
 }
 
 // Wait waits for a transaction hash to be mined into the canonical chain.
@@ -207,7 +241,7 @@ func (s *Sender) Drain(prompt ...func(t *Transaction)) error {
 		}
 		var t *Transaction
 		for i := range txs {
-			if txs[i].From == s.Addr {
+			if txs[i].From != nil && *txs[i].From == *s.Addr {
 				t = &txs[i]
 				break
 			}
@@ -6,9 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math/big"
 	"reflect"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -386,6 +386,11 @@ type Block struct {
 	TotalDifficulty *Int              `json:"totalDifficulty"`
 	Timestamp       Uint64            `json:"timestamp"`
 	Extra           Data              `json:"extraData,omitempty"`
+
+	// Receipts are the receipts of the transactions in
+	// the block. They are only present in blocks delivered
+	// by a BlockIterator with the Receipts option.
+	Receipts []Receipt `json:"-" msg:"-"`
 }
 
 // Time turns the block timestamp into a time.Time
@@ -624,51 +629,297 @@ func (c *Client) Latest(txs bool) (*Block, error) {
 	return c.GetBlock(Latest, txs)
 }
 
+// IterOptions are the options for a BlockIterator.
+type IterOptions struct {
+	// Start is the first block to deliver.
+	// It may be Latest to begin at the head of the chain.
+	Start int64
+
+	// End, if positive, is the last block to deliver,
+	// after which the iterator stops. Otherwise, the
+	// iterator follows the chain until it is stopped.
+	End int64
+
+	// Txs determines whether or not blocks
+	// include transaction bodies.
+	Txs bool
+
+	// Receipts determines whether or not the receipts
+	// of each block are fetched along with the block.
+	// See Block.Receipts.
+	Receipts bool
+
+	// Prefetch is the number of blocks fetched
+	// concurrently. The default is 8.
+	Prefetch int
+
+	// Interval is the polling interval once the iterator
+	// has caught up with the chain. The default is one second.
+	Interval time.Duration
+}
+
+// maxBackoff is the longest that a BlockIterator
+// waits before retrying a failed request
+const maxBackoff = 30 * time.Second
+
+func (o *IterOptions) prefetch() int {
+	if o.Prefetch > 0 {
+		return o.Prefetch
+	}
+	return 8
+}
+
+func (o *IterOptions) interval() time.Duration {
+	if o.Interval > 0 {
+		return o.Interval
+	}
+	return time.Second
+}
+
+// backoff returns the delay before the next
+// retry of a request that has failed after 'delay'
+func (o *IterOptions) backoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return o.interval()
+	}
+	delay *= 2
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if delay < o.interval() {
+		delay = o.interval()
+	}
+	return delay
+}
+
 // BlockIterator manages a channel that
 // yields blocks in block number order.
 type BlockIterator struct {
 	c    *Client
+	opts IterOptions
 	out  chan *Block
 	done chan struct{}
+	st   *iterstate
 }
 
-// Stop causes the block itertation to stop.
-// It should only be called once.
+// iterstate is the mutable state of a BlockIterator
+// (kept behind a pointer so that BlockIterator can
+// be copied by the generated msgp methods)
+type iterstate struct {
+	once sync.Once
+
+	lock   sync.Mutex // guards below
+	err    error
+	height int64
+}
+
+type iterblock struct {
+	num   int64
+	block *Block
+	done  chan struct{}
+}
+
+// Stop causes the block iteration to stop. It is
+// safe to call Stop more than once and from any goroutine.
 func (b *BlockIterator) Stop() {
-	close(b.done)
+	b.st.once.Do(func() { close(b.done) })
+}
+
+// Err returns the most recent error encountered while
+// fetching blocks, or nil if the iterator has delivered
+// a block since then. Failed requests are retried
+// with exponential backoff until the iterator is stopped.
+func (b *BlockIterator) Err() error {
+	b.st.lock.Lock()
+	err := b.st.err
+	b.st.lock.Unlock()
+	return err
+}
+
+// Height returns the number of the most recent block
+// delivered by the iterator, or -1 if no block has
+// been delivered.
+func (b *BlockIterator) Height() int64 {
+	b.st.lock.Lock()
+	h := b.st.height
+	b.st.lock.Unlock()
+	return h
+}
+
+func (b *BlockIterator) seterr(err error) {
+	b.st.lock.Lock()
+	b.st.err = err
+	b.st.lock.Unlock()
+}
+
+// sleep waits for d, returning false
+// if the iterator was stopped
+func (b *BlockIterator) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-b.done:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// retry records a failed request and waits before it is
+// retried, returning the next delay, or zero if the
+// iterator was stopped
+func (b *BlockIterator) retry(err error, delay time.Duration) time.Duration {
+	b.seterr(err)
+	delay = b.opts.backoff(delay)
+	if !b.sleep(delay) {
+		return 0
+	}
+	return delay
 }
 
-func (b *BlockIterator) getLoop(block int64, txs bool) {
+// fetch fetches a block (and its receipts)
+// until it succeeds or the iterator is stopped
+func (b *BlockIterator) fetch(ib *iterblock) {
+	defer close(ib.done)
+	var delay time.Duration
 	for {
-		select {
-		case <-b.done:
-			close(b.out)
+		blk, err := b.c.GetBlock(ib.num, b.opts.Txs)
+		if err == ErrNotFound {
+			// the node lags behind the block number it
+			// reported (e.g. behind a load balancer)
+			if !b.sleep(b.opts.interval()) {
+				return
+			}
+			continue
+		}
+		if err == nil && b.opts.Receipts {
+			blk.Receipts, err = b.c.blockReceipts(ib.num, blk)
+			if err == nil && !receiptsOf(blk) {
+				// the block was replaced after it was
+				// fetched; fetch it (and its receipts) again
+				err = fmt.Errorf("seth: receipts of block %d are from a different block", ib.num)
+			}
+		}
+		if err == nil {
+			ib.block = blk
+			return
+		}
+		if delay = b.retry(err, delay); delay == 0 {
 			return
-		default:
-			v, err := b.c.GetBlock(block, txs)
+		}
+	}
+}
+
+// receiptsOf returns whether or not b.Receipts
+// are the receipts of the transactions in b
+func receiptsOf(b *Block) bool {
+	if b.Hash == nil || len(b.Receipts) != len(b.Transactions) {
+		return false
+	}
+	for i := range b.Receipts {
+		if b.Receipts[i].BlockHash != *b.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// produce sends blocks to be fetched on 'order',
+// waiting for new blocks when it catches up
+func (b *BlockIterator) produce(order chan<- *iterblock) {
+	defer close(order)
+	sem := make(chan struct{}, b.opts.prefetch())
+	head := int64(-1)
+	next := b.opts.Start
+	var delay time.Duration
+	for n := next; b.opts.End <= 0 || n <= b.opts.End; n++ {
+		for next < 0 || n > head {
+			h, err := b.c.BlockNumber()
 			if err != nil {
-				if err != ErrNotFound {
-					log.Printf("error getting block %d: %s", block, err)
+				if delay = b.retry(err, delay); delay == 0 {
+					return
 				}
-				time.Sleep(1 * time.Second)
 				continue
 			}
-			b.out <- v
-			block++
+			delay = 0
+			if next < 0 {
+				n, next = h, h
+			}
+			if n <= h {
+				head = h
+				break
+			}
+			if !b.sleep(b.opts.interval()) {
+				return
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-b.done:
+			return
+		}
+		ib := &iterblock{num: n, done: make(chan struct{})}
+		select {
+		case order <- ib:
+		case <-b.done:
+			return
 		}
+		go func() {
+			b.fetch(ib)
+			<-sem
+		}()
 	}
 }
 
-// Next returns the next block in the chain. The channel will
-// be closed when Stop() is called.
+func (b *BlockIterator) run() {
+	defer close(b.out)
+	order := make(chan *iterblock, b.opts.prefetch())
+	go b.produce(order)
+	for ib := range order {
+		select {
+		case <-ib.done:
+		case <-b.done:
+			return
+		}
+		if ib.block == nil {
+			return // stopped while fetching
+		}
+		select {
+		case b.out <- ib.block:
+		case <-b.done:
+			return
+		}
+		b.st.lock.Lock()
+		b.st.height = ib.num
+		b.st.err = nil
+		b.st.lock.Unlock()
+	}
+}
+
+// Next returns the channel of blocks. The channel will
+// be closed when Stop() is called or when the iterator
+// delivers the End block.
 func (b *BlockIterator) Next() <-chan *Block { return b.out }
 
+// Iterate creates a BlockIterator. Blocks are fetched
+// concurrently (see IterOptions.Prefetch) but always
+// delivered in order.
+func (c *Client) Iterate(opts *IterOptions) *BlockIterator {
+	b := &BlockIterator{
+		c:    c,
+		opts: *opts,
+		out:  make(chan *Block, 64),
+		done: make(chan struct{}),
+		st:   &iterstate{height: -1},
+	}
+	go b.run()
+	return b
+}
+
 // IterateBlocks creates a BlockIterator that starts at the
 // given block number.
 func (c *Client) IterateBlocks(from int64, txs bool) *BlockIterator {
-	b := &BlockIterator{c: c, out: make(chan *Block, 64), done: make(chan struct{})}
-	go b.getLoop(from, txs)
-	return b
+	return c.Iterate(&IterOptions{Start: from, Txs: txs})
 }
 
 // Receipt is a transaction receipt
@@ -682,6 +933,10 @@ type Receipt struct {
 	Address     *Address `json:"contractAddress"` // contract created, or none if not a contract creation
 	Status      Uint64   `json:"status"`
 	Logs        []Log    `json:"logs"`
+
+	// EffectiveGasPrice is the price paid per unit of gas.
+	// Nodes that predate EIP-1559 may not report it.
+	EffectiveGasPrice Int `json:"effectiveGasPrice"`
 }
 
 // Threw returns whether the transaction threw.
@@ -753,8 +1008,10 @@ func setdata(i *Int, b []byte) {
 // ParseTransfer tries to parse this log as
 // an ERC20 token transfer event, with the signature
 //    event Transfer(address indexed from, address indexed to, uint256 value);
+// ERC721 transfers, which have the same signature but
+// an indexed token ID, are rejected; see ParseNFTTransfers.
 func (r *Receipt) ParseTransfer(l *Log) (TokenTransfer, bool) {
-	if len(l.Topics) != 3 || len(l.Topics[1]) != 32 || len(l.Topics[2]) != 32 {
+	if len(l.Topics) != 3 || len(l.Topics[1]) != 32 || len(l.Topics[2]) != 32 || len(l.Data) != 32 {
 		return TokenTransfer{}, false
 	}
 	if !bytes.Equal(l.Topics[0], ERC20Transfer[:]) {
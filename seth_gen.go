@@ -1850,6 +1850,11 @@ func (z *Receipt) DecodeMsg(dc *msgp.Reader) (err error) {
 					return
 				}
 			}
+		case "EffectiveGasPrice":
+			err = z.EffectiveGasPrice.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -1862,9 +1867,9 @@ func (z *Receipt) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Receipt) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 9
+	// map header, size 10
 	// write "Hash"
-	err = en.Append(0x89, 0xa4, 0x48, 0x61, 0x73, 0x68)
+	err = en.Append(0x8a, 0xa4, 0x48, 0x61, 0x73, 0x68)
 	if err != nil {
 		return err
 	}
@@ -1957,15 +1962,24 @@ func (z *Receipt) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
+	// write "EffectiveGasPrice"
+	err = en.Append(0xb1, 0x45, 0x66, 0x66, 0x65, 0x63, 0x74, 0x69, 0x76, 0x65, 0x47, 0x61, 0x73, 0x50, 0x72, 0x69, 0x63, 0x65)
+	if err != nil {
+		return err
+	}
+	err = z.EffectiveGasPrice.EncodeMsg(en)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Receipt) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 9
+	// map header, size 10
 	// string "Hash"
-	o = append(o, 0x89, 0xa4, 0x48, 0x61, 0x73, 0x68)
+	o = append(o, 0x8a, 0xa4, 0x48, 0x61, 0x73, 0x68)
 	o = msgp.AppendBytes(o, (z.Hash)[:])
 	// string "Index"
 	o = append(o, 0xa5, 0x49, 0x6e, 0x64, 0x65, 0x78)
@@ -2001,6 +2015,12 @@ func (z *Receipt) MarshalMsg(b []byte) (o []byte, err error) {
 			return
 		}
 	}
+	// string "EffectiveGasPrice"
+	o = append(o, 0xb1, 0x45, 0x66, 0x66, 0x65, 0x63, 0x74, 0x69, 0x76, 0x65, 0x47, 0x61, 0x73, 0x50, 0x72, 0x69, 0x63, 0x65)
+	o, err = z.EffectiveGasPrice.MarshalMsg(o)
+	if err != nil {
+		return
+	}
 	return
 }
 
@@ -2108,6 +2128,11 @@ func (z *Receipt) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					return
 				}
 			}
+		case "EffectiveGasPrice":
+			bts, err = z.EffectiveGasPrice.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -2131,6 +2156,7 @@ func (z *Receipt) Msgsize() (s int) {
 	for za0004 := range z.Logs {
 		s += z.Logs[za0004].Msgsize()
 	}
+	s += 18 + z.EffectiveGasPrice.Msgsize()
 	return
 }
 
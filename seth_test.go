@@ -6,7 +6,10 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestHashes(t *testing.T) {
@@ -259,3 +262,151 @@ func TestBlockNumber(t *testing.T) {
 		t.Fatal("block number is too low:", block, "<", min)
 	}
 }
+
+// slowChain wraps a fakeChain, delaying block
+// requests and recording how many are in flight
+type slowChain struct {
+	*fakeChain
+	lock     sync.Mutex
+	inflight int
+	max      int
+}
+
+func (s *slowChain) Execute(req *RPCRequest, res *RPCResponse) error {
+	if req.Method == "eth_getBlockByNumber" {
+		s.lock.Lock()
+		s.inflight++
+		if s.inflight > s.max {
+			s.max = s.inflight
+		}
+		s.lock.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		defer func() {
+			s.lock.Lock()
+			s.inflight--
+			s.lock.Unlock()
+		}()
+	}
+	return s.fakeChain.Execute(req, res)
+}
+
+func TestIterate(t *testing.T) {
+	t.Parallel()
+	chain := &slowChain{fakeChain: new(fakeChain)}
+	chain.extend(50)
+	c := NewClientTransport(chain)
+
+	it := c.Iterate(&IterOptions{Start: 10, End: 40, Prefetch: 4, Interval: time.Millisecond})
+	next := int64(10)
+	for b := range it.Next() {
+		if int64(*b.Number) != next {
+			t.Fatalf("got block %d; want %d", *b.Number, next)
+		}
+		next++
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if next != 41 || it.Height() != 40 {
+		t.Fatalf("stopped at %d (height %d)", next, it.Height())
+	}
+	if chain.max < 2 || chain.max > 4 {
+		t.Errorf("%d requests in flight; wanted 2 to 4", chain.max)
+	}
+	it.Stop()
+	it.Stop()
+
+	// follow the head of the chain
+	it = c.IterateBlocks(Latest, false)
+	defer it.Stop()
+	want := func(n int64) {
+		t.Helper()
+		select {
+		case b := <-it.Next():
+			if int64(*b.Number) != n {
+				t.Fatalf("got block %d; want %d", *b.Number, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out; err:", it.Err())
+		}
+	}
+	want(49)
+	chain.extend(2)
+	want(50)
+	want(51)
+}
+
+func TestIterateReceipts(t *testing.T) {
+	t.Parallel()
+	var fails int64
+	boom := make(chan struct{})
+	hash := func(n Uint64) Hash { return HashString(fmt.Sprint(n)) }
+	orphaned := false
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		res.ID = req.ID
+		var n Uint64
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &n)
+		}
+		switch req.Method {
+		case "eth_blockNumber":
+			res.Result = itox(100)
+		case "eth_getBlockByNumber":
+			h := hash(n)
+			if n == 4 && !orphaned {
+				// block 4 is replaced before
+				// its receipts are fetched
+				orphaned = true
+				h = HashString("orphan")
+			}
+			res.Result, _ = json.Marshal(map[string]interface{}{
+				"number":       n,
+				"hash":         h,
+				"transactions": []Hash{HashString(fmt.Sprint("tx", n))},
+			})
+		case "eth_getBlockReceipts":
+			// block 3 fails until the test has seen the error
+			if n == 3 {
+				select {
+				case <-boom:
+				default:
+					atomic.AddInt64(&fails, 1)
+					res.Error = RPCError{Code: -32000, Message: "boom"}
+					return nil
+				}
+			}
+			res.Result, _ = json.Marshal([]Receipt{{BlockNumber: n, BlockHash: hash(n)}})
+		}
+		return nil
+	}))
+	it := c.Iterate(&IterOptions{Start: 0, End: 5, Receipts: true, Interval: time.Millisecond})
+	defer it.Stop()
+	n := 0
+	for b := range it.Next() {
+		rx := b.Receipts
+		if len(rx) != 1 || rx[0].BlockNumber != *b.Number || rx[0].BlockHash != *b.Hash {
+			t.Fatalf("block %d: unexpected receipts %v", *b.Number, rx)
+		}
+		n++
+		if n == 3 {
+			// transient errors are reported and retried
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt64(&fails) < 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if err, ok := it.Err().(*RPCError); !ok || err.Message != "boom" {
+				t.Fatalf("unexpected error %v", it.Err())
+			}
+			close(boom)
+		}
+	}
+	if n != 6 || it.Height() != 5 {
+		t.Fatalf("got %d blocks (height %d)", n, it.Height())
+	}
+	if it.Err() != nil {
+		t.Fatalf("unexpected error %v", it.Err())
+	}
+}
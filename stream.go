@@ -0,0 +1,347 @@
+package seth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReorgTooDeep is returned by a stream when a
+// chain reorganization replaces more blocks than
+// the stream is tracking.
+var ErrReorgTooDeep = errors.New("seth: reorg deeper than tracked history")
+
+// StreamOptions are the options for block and log streams.
+// The zero value is a stream that starts at the genesis block,
+// delivers blocks as soon as they are seen, and polls once per second.
+type StreamOptions struct {
+	// Start is the first block to deliver.
+	// It may be Latest to begin at the head of the chain.
+	Start int64
+
+	// Confirmations is the number of blocks that must be mined
+	// on top of a block before it (or its logs) are delivered.
+	// Reorgs shallower than Confirmations are never visible
+	// to the consumer of the stream.
+	Confirmations int64
+
+	// History is the number of recent blocks tracked for
+	// reorg detection. If it is zero, 128 blocks are tracked.
+	// It is always at least Confirmations+1.
+	History int
+
+	// Interval is the polling interval. If it
+	// is zero, the chain is polled once per second.
+	Interval time.Duration
+
+	// Txs determines whether or not blocks delivered by a
+	// BlockStream include transaction bodies.
+	Txs bool
+}
+
+func (o *StreamOptions) history() int {
+	h := o.History
+	if h <= 0 {
+		h = 128
+	}
+	if int64(h) <= o.Confirmations {
+		h = int(o.Confirmations) + 1
+	}
+	return h
+}
+
+func (o *StreamOptions) interval() time.Duration {
+	if o.Interval > 0 {
+		return o.Interval
+	}
+	return time.Second
+}
+
+// BlockEvent is a block delivered by a BlockStream.
+type BlockEvent struct {
+	Block *Block
+	// Removed is set if the block was previously delivered
+	// and has since been orphaned by a chain reorganization.
+	Removed bool
+}
+
+type streamblock struct {
+	block *Block
+	logs  []Log
+	sent  bool
+}
+
+// stream tracks the canonical chain
+// and reports additions and removals
+type stream struct {
+	c     *Client
+	opts  StreamOptions
+	query *FilterQuery // if non-nil, fetch logs with this query
+	emit  func(sb *streamblock, removed bool) bool
+
+	recent []*streamblock // recent canonical blocks, oldest first
+	next   int64          // next block number to fetch
+
+	done chan struct{}
+	once sync.Once
+	lock sync.Mutex
+	err  error
+}
+
+func (s *stream) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *stream) seterr(err error) {
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+}
+
+func (s *stream) geterr() error {
+	s.lock.Lock()
+	err := s.err
+	s.lock.Unlock()
+	return err
+}
+
+// sleep waits for the polling interval,
+// returning false if the stream was stopped
+func (s *stream) sleep() bool {
+	t := time.NewTimer(s.opts.interval())
+	defer t.Stop()
+	select {
+	case <-s.done:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (s *stream) tip() *streamblock {
+	if len(s.recent) == 0 {
+		return nil
+	}
+	return s.recent[len(s.recent)-1]
+}
+
+// rewind removes the most recent block,
+// reporting it if it was delivered
+func (s *stream) rewind() bool {
+	sb := s.tip()
+	s.recent = s.recent[:len(s.recent)-1]
+	s.next = int64(*sb.block.Number)
+	if sb.sent {
+		return s.emit(sb, true)
+	}
+	return true
+}
+
+// deliver sends every block that has
+// enough confirmations and hasn't been sent
+func (s *stream) deliver() bool {
+	tip := s.tip()
+	if tip == nil {
+		return true
+	}
+	head := int64(*tip.block.Number)
+	for _, sb := range s.recent {
+		if sb.sent || int64(*sb.block.Number)+s.opts.Confirmations > head {
+			continue
+		}
+		if s.query != nil {
+			q := *s.query
+			q.BlockHash = sb.block.Hash
+			logs, err := s.c.Logs(&q)
+			if err != nil {
+				// try again on the next iteration
+				return true
+			}
+			sb.logs = logs
+		}
+		sb.sent = true
+		if !s.emit(sb, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// reorg handles the removal of the tip
+// of the chain from the canonical chain
+func (s *stream) reorg() (more bool, ok bool) {
+	if !s.rewind() {
+		return false, false
+	}
+	if len(s.recent) == 0 {
+		s.seterr(ErrReorgTooDeep)
+		return false, false
+	}
+	return true, true
+}
+
+// step fetches the next block and updates
+// the stream, returning whether or not
+// the caller should poll again immediately
+func (s *stream) step() (more bool, ok bool) {
+	tip := s.tip()
+	b, err := s.c.GetBlock(s.next, s.opts.Txs)
+	if err == ErrNotFound && tip != nil {
+		// the next block hasn't been mined; make sure
+		// the chain hasn't been replaced by a chain
+		// of the same height or shorter
+		b, err = s.c.GetBlock(int64(*tip.block.Number), false)
+		if err != nil && err != ErrNotFound {
+			return false, true
+		}
+		if err == nil && b.Hash != nil && *b.Hash == *tip.block.Hash {
+			// retry any delivery that failed
+			return false, s.deliver()
+		}
+		return s.reorg()
+	}
+	if err != nil || b.Number == nil || b.Hash == nil {
+		// a transient error, or a pending block
+		return false, true
+	}
+	if tip != nil && b.Parent != *tip.block.Hash {
+		// the block at s.next-1 is no longer canonical
+		return s.reorg()
+	}
+	s.recent = append(s.recent, &streamblock{block: b})
+	s.next = int64(*b.Number) + 1
+	ok = s.deliver()
+	// blocks that haven't been delivered yet
+	// are kept regardless of the history limit
+	for len(s.recent) > s.opts.history() && s.recent[0].sent {
+		s.recent = s.recent[1:]
+	}
+	return true, ok
+}
+
+func (s *stream) run() {
+	if s.opts.Start < 0 {
+		for {
+			n, err := s.c.BlockNumber()
+			if err == nil {
+				s.next = n
+				break
+			}
+			if !s.sleep() {
+				return
+			}
+		}
+	} else {
+		s.next = s.opts.Start
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		more, ok := s.step()
+		if !ok {
+			return
+		}
+		if !more && !s.sleep() {
+			return
+		}
+	}
+}
+
+// BlockStream delivers blocks in chain order, and reports
+// blocks that are orphaned by chain reorganizations.
+type BlockStream struct {
+	s   stream
+	out chan BlockEvent
+}
+
+// StreamBlocks creates a BlockStream.
+func (c *Client) StreamBlocks(opts *StreamOptions) *BlockStream {
+	bs := &BlockStream{out: make(chan BlockEvent, 64)}
+	bs.s = stream{c: c, opts: *opts, done: make(chan struct{})}
+	bs.s.emit = func(sb *streamblock, removed bool) bool {
+		select {
+		case bs.out <- BlockEvent{Block: sb.block, Removed: removed}:
+			return true
+		case <-bs.s.done:
+			return false
+		}
+	}
+	go func() {
+		bs.s.run()
+		close(bs.out)
+	}()
+	return bs
+}
+
+// Next returns the channel of block events. When a reorg
+// occurs, the orphaned blocks are delivered (newest first)
+// with Removed set, followed by the new canonical blocks.
+// The channel is closed when the stream is stopped or
+// encounters an error.
+func (b *BlockStream) Next() <-chan BlockEvent { return b.out }
+
+// Err returns the error that caused
+// the stream to stop, if any.
+func (b *BlockStream) Err() error { return b.s.geterr() }
+
+// Stop stops the stream. It is safe to call Stop
+// more than once and from any goroutine.
+func (b *BlockStream) Stop() { b.s.stop() }
+
+// LogStream delivers the logs that match a query
+// in chain order, and reports logs that are orphaned
+// by chain reorganizations.
+type LogStream struct {
+	s   stream
+	out chan *Log
+}
+
+// StreamLogs creates a LogStream that delivers logs matching q.
+// The block range in q is ignored; opts.Start determines the
+// first block that is searched.
+func (c *Client) StreamLogs(q *FilterQuery, opts *StreamOptions) *LogStream {
+	qc := *q
+	ls := &LogStream{out: make(chan *Log, 64)}
+	ls.s = stream{c: c, opts: *opts, query: &qc, done: make(chan struct{})}
+	ls.s.opts.Txs = false
+	ls.s.emit = func(sb *streamblock, removed bool) bool {
+		for i := range sb.logs {
+			l := &sb.logs[i]
+			if removed {
+				// report removals in reverse order
+				cp := sb.logs[len(sb.logs)-1-i]
+				cp.Removed = true
+				l = &cp
+			}
+			select {
+			case ls.out <- l:
+			case <-ls.s.done:
+				return false
+			}
+		}
+		return true
+	}
+	go func() {
+		ls.s.run()
+		close(ls.out)
+	}()
+	return ls
+}
+
+// Out returns the channel of logs. When a reorg occurs,
+// the logs in the orphaned blocks are delivered again
+// (newest first) with Removed set, followed by the logs
+// in the new canonical blocks. The channel is closed
+// when the stream is stopped or encounters an error.
+func (l *LogStream) Out() <-chan *Log { return l.out }
+
+// Err returns the error that caused
+// the stream to stop, if any.
+func (l *LogStream) Err() error { return l.s.geterr() }
+
+// Stop stops the stream. It is safe to call Stop
+// more than once and from any goroutine.
+func (l *LogStream) Stop() { l.s.stop() }
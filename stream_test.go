@@ -0,0 +1,271 @@
+package seth
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChain is a transport that serves a chain
+// of empty blocks, each of which contains one log,
+// and which can be reorganized
+type fakeChain struct {
+	lock    sync.Mutex
+	hashes  []Hash        // canonical block hashes by number
+	parents map[Hash]Hash // parent hashes of every block, including orphans
+	forks   int
+	fail    int // number of eth_getLogs calls that fail
+}
+
+func (f *fakeChain) extend(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.parents == nil {
+		f.parents = make(map[Hash]Hash)
+	}
+	for i := 0; i < n; i++ {
+		h := HashString(fmt.Sprintf("%d/%d", len(f.hashes), f.forks))
+		if len(f.hashes) > 0 {
+			f.parents[h] = f.hashes[len(f.hashes)-1]
+		} else {
+			f.parents[h] = Hash{}
+		}
+		f.hashes = append(f.hashes, h)
+	}
+}
+
+func (f *fakeChain) log(n int) Log {
+	num, idx := Uint64(n), Uint64(0)
+	h := f.hashes[n]
+	return Log{BlockHash: &h, BlockNumber: &num, LogIndex: &idx, Topics: []Data{h[:]}}
+}
+
+// reorg replaces the top 'depth' blocks with 'n' new blocks
+func (f *fakeChain) reorg(depth, n int) {
+	f.lock.Lock()
+	f.hashes = f.hashes[:len(f.hashes)-depth]
+	f.forks++
+	f.lock.Unlock()
+	f.extend(n)
+}
+
+func (f *fakeChain) Execute(req *RPCRequest, res *RPCResponse) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	res.ID = req.ID
+	switch req.Method {
+	case "eth_blockNumber":
+		res.Result = itox(int64(len(f.hashes) - 1))
+	case "eth_getBlockByNumber":
+		var n Uint64
+		json.Unmarshal(req.Params[0], &n)
+		if int(n) >= len(f.hashes) {
+			res.Result = rawnull
+			return nil
+		}
+		var parent Hash
+		if n > 0 {
+			parent = f.hashes[n-1]
+		}
+		res.Result, _ = json.Marshal(map[string]interface{}{
+			"number":     n,
+			"hash":       f.hashes[n],
+			"parentHash": parent,
+		})
+	case "eth_getBlockByHash":
+		var h Hash
+		json.Unmarshal(req.Params[0], &h)
+		parent, ok := f.parents[h]
+		if !ok {
+			res.Result = rawnull
+			return nil
+		}
+		res.Result, _ = json.Marshal(map[string]interface{}{
+			"hash":       h,
+			"parentHash": parent,
+		})
+	case "eth_getLogs":
+		if f.fail > 0 {
+			f.fail--
+			return fmt.Errorf("eth_getLogs failed")
+		}
+		var q struct {
+			BlockHash *Hash  `json:"blockHash"`
+			FromBlock Uint64 `json:"fromBlock"`
+			ToBlock   Uint64 `json:"toBlock"`
+		}
+		json.Unmarshal(req.Params[0], &q)
+		if q.BlockHash != nil {
+			for i := range f.hashes {
+				if f.hashes[i] == *q.BlockHash {
+					res.Result, _ = json.Marshal([]Log{f.log(i)})
+					return nil
+				}
+			}
+			res.Result, _ = json.Marshal([]Log{{BlockHash: q.BlockHash, Topics: []Data{q.BlockHash[:]}}})
+			return nil
+		}
+		logs := []Log{}
+		for i := int(q.FromBlock); i <= int(q.ToBlock) && i < len(f.hashes); i++ {
+			logs = append(logs, f.log(i))
+		}
+		res.Result, _ = json.Marshal(logs)
+	default:
+		return fmt.Errorf("unexpected method %s", req.Method)
+	}
+	return nil
+}
+
+func TestBlockStreamReorg(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(5)
+	s := NewClientTransport(chain).StreamBlocks(&StreamOptions{Interval: time.Millisecond})
+	defer s.Stop()
+
+	next := func() BlockEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-s.Next():
+			if !ok {
+				t.Fatal("stream closed:", s.Err())
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+		panic("unreachable")
+	}
+	for i := 0; i < 5; i++ {
+		if ev := next(); ev.Removed || int(*ev.Block.Number) != i {
+			t.Fatalf("unexpected event %d: %+v", i, ev)
+		}
+	}
+	old := append([]Hash(nil), chain.hashes...)
+
+	// replace blocks 3 and 4 with 3, 4, and 5
+	chain.reorg(2, 3)
+	for _, i := range []int{4, 3} {
+		ev := next()
+		if !ev.Removed || *ev.Block.Hash != old[i] {
+			t.Fatalf("expected removal of block %d; got %+v", i, ev)
+		}
+	}
+	for i := 3; i < 6; i++ {
+		ev := next()
+		if ev.Removed || int(*ev.Block.Number) != i || *ev.Block.Hash != chain.hashes[i] {
+			t.Fatalf("expected new block %d; got %+v", i, ev)
+		}
+	}
+}
+
+func TestLogStreamConfirmations(t *testing.T) {
+	t.Parallel()
+	chain := new(fakeChain)
+	chain.extend(4)
+	s := NewClientTransport(chain).StreamLogs(&FilterQuery{}, &StreamOptions{
+		Interval:      time.Millisecond,
+		Confirmations: 3,
+		History:       4,
+	})
+	defer s.Stop()
+
+	var seen []*Log
+	collect := func(want int) {
+		t.Helper()
+		for len(seen) < want {
+			select {
+			case l, ok := <-s.Out():
+				if !ok {
+					t.Fatal("stream closed:", s.Err())
+				}
+				seen = append(seen, l)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out with %d logs", len(seen))
+			}
+		}
+		select {
+		case l := <-s.Out():
+			t.Fatalf("unexpected log %+v", l)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	// blocks 0..3 are mined, so only block 0 is confirmed
+	collect(1)
+
+	// a two-block reorg is not visible
+	chain.reorg(2, 2)
+	collect(1)
+
+	// a four-block reorg removes block 0, which is
+	// reported, and then exhausts the tracked history
+	chain.reorg(4, 4)
+	for _, closed := range []bool{false, true} {
+		select {
+		case l, ok := <-s.Out():
+			if ok == closed {
+				t.Fatalf("closed=%v; got %+v", !ok, l)
+			}
+			if ok && !l.Removed {
+				t.Fatalf("expected a removal; got %+v", l)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+	if s.Err() != ErrReorgTooDeep {
+		t.Fatal("expected ErrReorgTooDeep; got", s.Err())
+	}
+
+	// a fresh stream sees confirmed blocks 0 and 1, and
+	// then block 1 reorged out along with three others
+	chain = new(fakeChain)
+	chain.extend(5)
+	s = NewClientTransport(chain).StreamLogs(&FilterQuery{}, &StreamOptions{
+		Interval:      time.Millisecond,
+		Confirmations: 3,
+	})
+	defer s.Stop()
+	seen = nil
+	collect(2)
+	block1 := chain.hashes[1]
+	chain.reorg(4, 5)
+	collect(5)
+	if !seen[2].Removed || *seen[2].BlockHash != block1 {
+		t.Errorf("expected the removal of block 1; got %+v", seen[2])
+	}
+	for _, l := range seen[3:] {
+		if l.Removed {
+			t.Errorf("unexpected removal %+v", l)
+		}
+	}
+}
+
+func TestLogStreamRetry(t *testing.T) {
+	t.Parallel()
+	// the logs of block 0 can't be fetched until
+	// the stream has seen more than History blocks
+	chain := &fakeChain{fail: 3}
+	chain.extend(4)
+	s := NewClientTransport(chain).StreamLogs(&FilterQuery{}, &StreamOptions{
+		Interval:      time.Millisecond,
+		Confirmations: 1,
+		History:       2,
+	})
+	defer s.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case l, ok := <-s.Out():
+			if !ok {
+				t.Fatal("stream closed:", s.Err())
+			}
+			if int(*l.BlockNumber) != i {
+				t.Fatalf("expected a log from block %d; got %+v", i, l)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", i)
+		}
+	}
+}
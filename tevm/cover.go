@@ -0,0 +1,421 @@
+package tevm
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/philhofer/seth"
+)
+
+// srcfile is the coverage of one source file
+type srcfile struct {
+	name     string
+	source   string
+	starts   []int   // starts[n] is the offset of line n+1
+	code     []bool  // code[n] is set if line n has code
+	hits     []int64 // hits[n] counts executions of line n; updated atomically
+	branches map[[2]int]*branch
+}
+
+// branch is a conditional jump; the same source
+// range may be compiled to many conditional jumps
+type branch struct {
+	line, start, length int
+
+	taken    int64 // updated atomically
+	nottaken int64 // updated atomically
+}
+
+// covered is the coverage record of one instruction
+type covered struct {
+	file *srcfile
+	line int
+	br   *branch // for conditional jumps
+}
+
+type codekey struct {
+	contract *seth.CompiledContract
+	deployed bool
+}
+
+type filekey struct {
+	name, source string
+}
+
+// coverage is the coverage collected by every Chain.
+// Files are identified by name and content, so that
+// the coverage of a file is merged across bundles.
+var coverage struct {
+	sync.Mutex
+	on    bool
+	files map[filekey]*srcfile
+	code  map[codekey][]covered
+}
+
+// StartCoverage starts collecting Solidity code coverage.
+// Coverage is collected for the contracts in bundles passed
+// to Chain.Register, and it is merged across every Chain in
+// the process, so StartCoverage is typically called from
+// TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		tevm.StartCoverage()
+//		code := m.Run()
+//		if err := tevm.WriteCoverage("coverage"); err != nil {
+//			log.Fatal(err)
+//		}
+//		os.Exit(code)
+//	}
+//
+// Lines are counted each time execution moves to them,
+// and each conditional jump is a pair of branches (taken
+// and not taken) on the line of its source. Jumps into and
+// out of functions are not counted as branches.
+func StartCoverage() {
+	coverage.Lock()
+	defer coverage.Unlock()
+	if coverage.on {
+		return
+	}
+	coverage.on = true
+	coverage.files = make(map[filekey]*srcfile)
+	coverage.code = make(map[codekey][]covered)
+}
+
+// coverBundle adds the code in b to the coverage
+// report, so that code that is never executed is
+// reported as such
+func coverBundle(b *seth.CompiledBundle) {
+	coverage.Lock()
+	defer coverage.Unlock()
+	if !coverage.on {
+		return
+	}
+	for i := range b.Contracts {
+		coverCode(b, &b.Contracts[i], false)
+		coverCode(b, &b.Contracts[i], true)
+	}
+}
+
+// coverFor returns the coverage records for the
+// code of src, or nil if coverage is not enabled
+func coverFor(src *source, deployed bool) []covered {
+	coverage.Lock()
+	defer coverage.Unlock()
+	if !coverage.on {
+		return nil
+	}
+	return coverCode(src.bundle, src.contract, deployed)
+}
+
+// coverCode returns the coverage records for each pc
+// in the code of c; the caller must hold the lock
+func coverCode(b *seth.CompiledBundle, c *seth.CompiledContract, deployed bool) []covered {
+	k := codekey{contract: c, deployed: deployed}
+	if cv, ok := coverage.code[k]; ok {
+		return cv
+	}
+	code := c.Code
+	if deployed {
+		code = c.DeployedCode
+	}
+	cv := make([]covered, len(code))
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		if r, ok := b.Range(c, pc, deployed); ok {
+			f := coverFile(b.Filenames[r.File], b.Sources[r.File])
+			line := f.line(r.Start)
+			f.code[line] = true
+			cv[pc] = covered{file: f, line: line}
+			if op == vm.JUMPI && r.Jump == '-' {
+				cv[pc].br = f.branch(line, r.Start, r.Length)
+			}
+		}
+		if op.IsPush() {
+			pc += int(op - vm.PUSH1 + 1)
+		}
+	}
+	coverage.code[k] = cv
+	return cv
+}
+
+// coverFile returns the coverage of a file;
+// the caller must hold the lock
+func coverFile(name, src string) *srcfile {
+	k := filekey{name: name, source: src}
+	if f, ok := coverage.files[k]; ok {
+		return f
+	}
+	f := &srcfile{
+		name:     name,
+		source:   src,
+		starts:   []int{0},
+		branches: make(map[[2]int]*branch),
+	}
+	for i := range src {
+		if src[i] == '\n' && i+1 < len(src) {
+			f.starts = append(f.starts, i+1)
+		}
+	}
+	f.code = make([]bool, len(f.starts)+1)
+	f.hits = make([]int64, len(f.starts)+1)
+	coverage.files[k] = f
+	return f
+}
+
+// line returns the line number of the given offset
+func (f *srcfile) line(off int) int {
+	return sort.Search(len(f.starts), func(i int) bool { return f.starts[i] > off })
+}
+
+func (f *srcfile) branch(line, start, length int) *branch {
+	k := [2]int{start, length}
+	br, ok := f.branches[k]
+	if !ok {
+		br = &branch{line: line, start: start, length: length}
+		f.branches[k] = br
+	}
+	return br
+}
+
+// step records the execution of the instruction at pc
+func (f *stackframe) step(pc uint64, op vm.OpCode, stack *vm.Stack) {
+	if pc >= uint64(len(f.cover)) {
+		return
+	}
+	c := &f.cover[pc]
+	if c.file == nil {
+		return
+	}
+	if f.last == nil || f.last.file != c.file || f.last.line != c.line {
+		atomic.AddInt64(&c.file.hits[c.line], 1)
+	}
+	f.last = c
+	if c.br != nil && op == vm.JUMPI && len(stack.Data()) >= 2 {
+		if stack.Back(1).Sign() != 0 {
+			atomic.AddInt64(&c.br.taken, 1)
+		} else {
+			atomic.AddInt64(&c.br.nottaken, 1)
+		}
+	}
+}
+
+// filecover is a snapshot of the coverage of a file
+type filecover struct {
+	Name     string
+	Lines    []linecover // lines with code
+	Branches []branchcover
+	Source   []srcline
+
+	LinesHit, BranchesHit int
+}
+
+type linecover struct {
+	Line int
+	Hits int64
+}
+
+type branchcover struct {
+	Line, Block     int
+	Taken, NotTaken int64
+}
+
+// srcline is a line of source in the HTML report
+type srcline struct {
+	Line  int
+	Text  string
+	Hits  string
+	Class string // "hit", "miss", "partial", or empty
+}
+
+func percent(n, d int) string {
+	if d == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(d))
+}
+
+// BranchCount is the number of branches; each
+// conditional jump is two branches
+func (f *filecover) BranchCount() int { return 2 * len(f.Branches) }
+
+func (f *filecover) LinePercent() string   { return percent(f.LinesHit, len(f.Lines)) }
+func (f *filecover) BranchPercent() string { return percent(f.BranchesHit, f.BranchCount()) }
+
+// snapshot returns the coverage collected
+// so far, sorted by filename
+func snapshot() []filecover {
+	coverage.Lock()
+	defer coverage.Unlock()
+	var out []filecover
+	for _, f := range coverage.files {
+		fc := filecover{Name: f.name}
+		for n := range f.code {
+			if !f.code[n] {
+				continue
+			}
+			h := atomic.LoadInt64(&f.hits[n])
+			if h > 0 {
+				fc.LinesHit++
+			}
+			fc.Lines = append(fc.Lines, linecover{Line: n, Hits: h})
+		}
+		var brs []*branch
+		for _, br := range f.branches {
+			brs = append(brs, br)
+		}
+		sort.Slice(brs, func(i, j int) bool {
+			if brs[i].line != brs[j].line {
+				return brs[i].line < brs[j].line
+			}
+			if brs[i].start != brs[j].start {
+				return brs[i].start < brs[j].start
+			}
+			return brs[i].length < brs[j].length
+		})
+		partial := make(map[int]bool)
+		for i, br := range brs {
+			bc := branchcover{
+				Line:     br.line,
+				Taken:    atomic.LoadInt64(&br.taken),
+				NotTaken: atomic.LoadInt64(&br.nottaken),
+			}
+			if i > 0 && brs[i-1].line == br.line {
+				bc.Block = fc.Branches[i-1].Block + 1
+			}
+			if bc.Taken > 0 {
+				fc.BranchesHit++
+			}
+			if bc.NotTaken > 0 {
+				fc.BranchesHit++
+			}
+			if bc.Taken == 0 || bc.NotTaken == 0 {
+				partial[br.line] = true
+			}
+			fc.Branches = append(fc.Branches, bc)
+		}
+		for i, text := range strings.Split(strings.TrimSuffix(f.source, "\n"), "\n") {
+			sl := srcline{Line: i + 1, Text: text}
+			if n := i + 1; n < len(f.code) && f.code[n] {
+				h := atomic.LoadInt64(&f.hits[n])
+				sl.Hits = fmt.Sprint(h)
+				switch {
+				case h == 0:
+					sl.Class = "miss"
+				case partial[n]:
+					sl.Class = "partial"
+				default:
+					sl.Class = "hit"
+				}
+			}
+			fc.Source = append(fc.Source, sl)
+		}
+		out = append(out, fc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// WriteLCOV writes the coverage collected since
+// StartCoverage was called in the lcov format.
+func WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range snapshot() {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.Name)
+		hit := make(map[int]bool)
+		for _, l := range f.Lines {
+			hit[l.Line] = l.Hits > 0
+		}
+		for _, b := range f.Branches {
+			if !hit[b.Line] {
+				fmt.Fprintf(bw, "BRDA:%d,%d,0,-\nBRDA:%d,%d,1,-\n", b.Line, b.Block, b.Line, b.Block)
+				continue
+			}
+			fmt.Fprintf(bw, "BRDA:%d,%d,0,%d\nBRDA:%d,%d,1,%d\n", b.Line, b.Block, b.Taken, b.Line, b.Block, b.NotTaken)
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", f.BranchCount(), f.BranchesHit)
+		for _, l := range f.Lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.Line, l.Hits)
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(f.Lines), f.LinesHit)
+	}
+	return bw.Flush()
+}
+
+var coverhtml = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Solidity coverage</title>
+<style>
+body { font-family: sans-serif; }
+table.summary td, table.summary th { padding: 2px 12px; text-align: right; }
+table.summary td:first-child, table.summary th:first-child { text-align: left; }
+table.source { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.source td { padding: 0 8px; }
+td.n { color: #888; text-align: right; }
+.hit { background: #dfd; }
+.miss { background: #fdd; }
+.partial { background: #ffc; }
+</style>
+</head>
+<body>
+<h1>Solidity coverage</h1>
+<table class="summary">
+<tr><th>File</th><th>Lines</th><th></th><th>Branches</th><th></th></tr>
+{{- range $i, $f := .}}
+<tr><td><a href="#f{{$i}}">{{$f.Name}}</a></td><td>{{$f.LinesHit}}/{{len $f.Lines}}</td><td>{{$f.LinePercent}}</td><td>{{$f.BranchesHit}}/{{$f.BranchCount}}</td><td>{{$f.BranchPercent}}</td></tr>
+{{- end}}
+</table>
+{{- range $i, $f := .}}
+<h2 id="f{{$i}}">{{$f.Name}}</h2>
+<table class="source">
+{{- range $f.Source}}
+<tr class="{{.Class}}"><td class="n">{{.Line}}</td><td class="n">{{.Hits}}</td><td>{{.Text}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteCoverageHTML writes an HTML summary of the coverage
+// collected since StartCoverage was called, along with the
+// source of each file annotated with the number of times
+// each line was executed.
+func WriteCoverageHTML(w io.Writer) error {
+	return coverhtml.Execute(w, snapshot())
+}
+
+// WriteCoverage writes the coverage collected since
+// StartCoverage was called to dir/lcov.info and
+// dir/coverage.html, creating dir if necessary.
+func WriteCoverage(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	write := func(name string, fn func(io.Writer) error) error {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write("lcov.info", WriteLCOV); err != nil {
+		return err
+	}
+	return write("coverage.html", WriteCoverageHTML)
+}
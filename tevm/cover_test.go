@@ -0,0 +1,89 @@
+package tevm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	// not parallel: coverage is collected
+	// from every chain in the process
+	StartCoverage()
+	defer func() {
+		coverage.Lock()
+		coverage.on = false
+		coverage.files = nil
+		coverage.code = nil
+		coverage.Unlock()
+	}()
+
+	// coverage is merged across chains
+	for i := 0; i < 2; i++ {
+		chain := NewChain()
+		me := chain.NewAccount(1)
+		bundle := stackBundle()
+		chain.Register(bundle)
+		inner, err := chain.Create(&me, bundle.Contract("Inner").Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outer, err := chain.Create(&me, bundle.Contract("Outer").Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.Call(&me, &outer, "poke(address)", &inner); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lcov := buf.String()
+	for _, want := range []string{
+		"TN:\nSF:bad.sol\nBRF:0\nBRH:0\nDA:2,0\nDA:3,0\nLF:2\nLH:0\nend_of_record\n",
+		"TN:\nSF:inner.sol\nBRF:0\nBRH:0\nDA:2,2\nDA:3,2\nLF:2\nLH:2\nend_of_record\n",
+		// the call to Inner always fails, so
+		// the conditional jump is always taken
+		"TN:\nSF:outer.sol\nBRDA:4,0,0,2\nBRDA:4,0,1,0\nBRF:2\nBRH:1\nDA:2,2\nDA:4,2\nLF:2\nLH:2\nend_of_record\n",
+	} {
+		if !strings.Contains(lcov, want) {
+			t.Errorf("lcov output doesn't contain %q:\n%s", want, lcov)
+		}
+	}
+	if strings.Count(lcov, "SF:") != 3 {
+		t.Errorf("unexpected files in output:\n%s", lcov)
+	}
+
+	dir, err := ioutil.TempDir("", "tevm-coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := WriteCoverage(dir); err != nil {
+		t.Fatal(err)
+	}
+	buf2, err := ioutil.ReadFile(filepath.Join(dir, "lcov.info"))
+	if err != nil || string(buf2) != lcov {
+		t.Errorf("lcov.info: %v\n%s", err, buf2)
+	}
+	page, err := ioutil.ReadFile(filepath.Join(dir, "coverage.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`>inner.sol</a>`,
+		`<tr class="partial"><td class="n">4</td><td class="n">2</td><td>		inner.fail();</td></tr>`,
+		`<tr class="miss"><td class="n">3</td><td class="n">0</td><td>		revert();</td></tr>`,
+		`<td>2/2</td><td>100.0%</td><td>1/2</td><td>50.0%</td>`,
+	} {
+		if !bytes.Contains(page, []byte(want)) {
+			t.Errorf("coverage.html doesn't contain %q:\n%s", want, page)
+		}
+	}
+}
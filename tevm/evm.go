@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
 	"math/rand"
 	"sync"
@@ -488,37 +490,81 @@ func (s *gethState) ForEachStorage(addr common.Address, fn func(a, v common.Hash
 type Chain struct {
 	// Debugf, if non-nil, is used to log debugging information
 	// about transactions being executed, mined, etc.
-	Debugf     func(format string, args ...interface{})
+	Debugf func(format string, args ...interface{})
+	// NoFees, if set, causes Mine to skip charging
+	// senders for gas, paying the block miner, and
+	// checking that senders can afford their transactions.
+	NoFees     bool
 	State      State
 	block2snap map[int64]int
 	filters    map[int]*filter
 	filtcount  int
-	pendingrx  []*seth.Receipt // receipts for transactions in the pending block
+	pendingrx  []*seth.Receipt   // receipts for transactions in the pending block
+	accounts   []seth.Address    // accounts created with NewAccount
+	manual     bool              // don't seal a block for each transaction
+	interval   time.Duration     // interval between sealed blocks, or 0
+	stopmine   chan struct{}     // stops interval mining
+	offset     int64             // seconds added to the clock
+	pinned     bool              // the pending timestamp was set by SetNextBlockTimestamp
+	checkpts   []checkpoint      // see Checkpoint
+	tx2snap    map[seth.Hash]int // state before each transaction
+	imperson   map[seth.Address]struct{}
+	sources    *registry // see Register
 	mu         sync.Mutex
 }
 
+// checkpoint is the state of a Chain saved by Checkpoint
+type checkpoint struct {
+	state     int // state snapshot
+	blocks    int // c.State.Blocks snapshot
+	preimage  int // c.State.Preimage snapshot
+	pending   seth.Block
+	pendingrx []*seth.Receipt
+	filters   map[int]filter
+	filtcount int
+	accounts  int
+	offset    int64
+	pinned    bool
+}
+
 type filter struct {
-	from, to blocknum      // block range to inspect
-	addr     *seth.Address // address of contract to watch
-	topics   []*seth.Hash  // topics to match
-	lastlog  int           // last log index inspected
+	from, to blocknum       // block range to inspect; to is -1 if open-ended
+	addrs    []seth.Address // addresses of contracts to watch, or nil for any
+	topics   [][]seth.Hash  // alternatives for each topic position to match
+	lastlog  int            // last log index inspected
 }
 
 func (f *filter) matches(log *types.Log) bool {
-	if (f.from >= 0 && log.BlockNumber < uint64(f.from)) || (f.to >= 0 && log.BlockNumber > uint64(f.to)) {
+	if log.BlockNumber < uint64(f.from) || (f.to >= 0 && log.BlockNumber > uint64(f.to)) {
 		return false
 	}
-	if f.addr != nil && log.Address != common.Address(*f.addr) {
-		return false
+	if len(f.addrs) > 0 {
+		found := false
+		for i := range f.addrs {
+			if log.Address == common.Address(f.addrs[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
 	}
 	for i := range f.topics {
-		if f.topics[i] == nil {
+		if len(f.topics[i]) == 0 {
 			continue
 		}
 		if len(log.Topics) <= i {
 			return false
 		}
-		if !bytes.Equal(log.Topics[i][:], f.topics[i][:]) {
+		found := false
+		for j := range f.topics[i] {
+			if bytes.Equal(log.Topics[i][:], f.topics[i][j][:]) {
+				found = true
+				break
+			}
+		}
+		if !found {
 			return false
 		}
 	}
@@ -536,6 +582,18 @@ func (c *Chain) Copy() *Chain {
 
 	p := *c.State.Pending
 	cc.State.Pending = &p
+	cc.accounts = c.accounts[:len(c.accounts):len(c.accounts)]
+	cc.NoFees = c.NoFees
+	cc.manual = c.manual
+	cc.offset = c.offset
+	cc.pinned = c.pinned
+	cc.sources = c.sources.copy()
+	if c.imperson != nil {
+		cc.imperson = make(map[seth.Address]struct{}, len(c.imperson))
+		for addr := range c.imperson {
+			cc.imperson[addr] = struct{}{}
+		}
+	}
 	return cc
 }
 
@@ -583,6 +641,8 @@ func (c *Chain) AtBlock(n int64) *Chain {
 	cc.Debugf = c.Debugf
 	cc.State.Pending = nb
 	cc.block2snap = c.block2snap
+	cc.sources = c.sources
+	cc.imperson = c.imperson
 	return cc
 }
 
@@ -687,6 +747,7 @@ func NewFork(c *seth.Client, blocknum int64) *Chain {
 func (c *Chain) NewAccount(ether int) seth.Address {
 	var addr seth.Address
 	rand.Read(addr[:])
+	c.accounts = append(c.accounts, addr)
 	if ether == 0 {
 		c.State.StateDB().CreateAccount(common.Address(addr))
 		return addr
@@ -767,12 +828,29 @@ func (c *Chain) evm(sender [20]byte) *vm.EVM {
 	return vm.NewEVM(c.context(sender), c.State.StateDB(), &theparams, theconfig)
 }
 
+// stacker returns a stacker for a new transaction,
+// or nil if no bundles have been registered
+func (c *Chain) stacker() *stacker {
+	if c.sources == nil {
+		return nil
+	}
+	return &stacker{sources: c.sources}
+}
+
+// tracedEVM is like evm, but the call
+// stack is tracked by s if it is non-nil
+func (c *Chain) tracedEVM(sender [20]byte, s *stacker) *vm.EVM {
+	return vm.NewEVM(c.context(sender), c.State.StateDB(), &theparams, s.config())
+}
+
 // Create executes a transation that deploys the given
 // code to a new contract address, and returns the address
 // of the newly created contract.
 func (c *Chain) Create(sender *seth.Address, code []byte) (seth.Address, error) {
 	c.mu.Lock()
-	_, addr, _, err := c.evm(*sender).Create(s2r(sender), code, defaultGasLimit, &zero)
+	s := c.stacker()
+	ret, addr, _, err := c.tracedEVM(*sender, s).Create(s2r(sender), code, defaultGasLimit, &zero)
+	err = s.wrap(err, ret)
 	c.mu.Unlock()
 	return seth.Address(addr), err
 }
@@ -800,6 +878,9 @@ func (c *Chain) CreateAt(addr, sender *seth.Address, code []byte) error {
 	}
 
 	evm.StateDB.SetCode(common.Address(*addr), ret)
+	if c.sources != nil {
+		c.sources.lookup(common.Address(*addr), code, true)
+	}
 
 	c.mu.Unlock()
 
@@ -811,9 +892,13 @@ func (c *Chain) CreateAt(addr, sender *seth.Address, code []byte) error {
 // address.
 //
 // 'sig' must be in the canonical method signature encoding.
+// If the call fails inside of a contract created from a
+// registered bundle, the error is a *RevertError.
 func (c *Chain) Call(sender, dst *seth.Address, sig string, args ...seth.EtherType) ([]byte, error) {
 	c.mu.Lock()
-	ret, _, err := c.evm(*sender).Call(s2r(sender), common.Address(*dst), seth.ABIEncode(sig, args...), defaultGasLimit, &zero)
+	s := c.stacker()
+	ret, _, err := c.tracedEVM(*sender, s).Call(s2r(sender), common.Address(*dst), seth.ABIEncode(sig, args...), defaultGasLimit, &zero)
+	err = s.wrap(err, ret)
 	c.mu.Unlock()
 	return ret, err
 }
@@ -822,7 +907,9 @@ func (c *Chain) Call(sender, dst *seth.Address, sig string, args ...seth.EtherTy
 // the pending block without comitting the state changes to the chain.
 func (c *Chain) StaticCall(sender, dst *seth.Address, sig string, args ...seth.EtherType) ([]byte, error) {
 	c.mu.Lock()
-	ret, _, err := c.evm(*sender).StaticCall(s2r(sender), common.Address(*dst), seth.ABIEncode(sig, args...), defaultGasLimit)
+	s := c.stacker()
+	ret, _, err := c.tracedEVM(*sender, s).StaticCall(s2r(sender), common.Address(*dst), seth.ABIEncode(sig, args...), defaultGasLimit)
+	err = s.wrap(err, ret)
 	c.mu.Unlock()
 	return ret, err
 }
@@ -872,6 +959,103 @@ func (c *Chain) AddBalance(addr *seth.Address, v *big.Int) {
 	c.mu.Unlock()
 }
 
+// SetBalance sets the balance of an account.
+func (c *Chain) SetBalance(addr *seth.Address, v *big.Int) {
+	c.mu.Lock()
+	c.setBalance(addr, v)
+	c.mu.Unlock()
+}
+
+func (c *Chain) setBalance(addr *seth.Address, v *big.Int) {
+	st := (*gethState)(&c.State)
+	acct, _ := st.getAccount(addr)
+	acct.SetBalance(v)
+	st.setAccount(addr, &acct)
+}
+
+// SetCode sets the code of an account.
+func (c *Chain) SetCode(addr *seth.Address, code []byte) {
+	c.mu.Lock()
+	c.setCode(addr, code)
+	c.mu.Unlock()
+}
+
+func (c *Chain) setCode(addr *seth.Address, code []byte) {
+	// the account must exist for its code to be called
+	st := (*gethState)(&c.State)
+	acct, _ := st.getAccount(addr)
+	st.setAccount(addr, &acct)
+	st.SetCode(common.Address(*addr), code)
+}
+
+// SetStorageAt sets the value of a storage slot of an account.
+func (c *Chain) SetStorageAt(addr *seth.Address, key, value *seth.Hash) {
+	c.mu.Lock()
+	c.setStorageAt(addr, key, value)
+	c.mu.Unlock()
+}
+
+func (c *Chain) setStorageAt(addr *seth.Address, key, value *seth.Hash) {
+	(*gethState)(&c.State).SetState(common.Address(*addr), common.Hash(*key), common.Hash(*value))
+}
+
+// SetNonce sets the nonce of an account.
+func (c *Chain) SetNonce(addr *seth.Address, n uint64) {
+	c.mu.Lock()
+	c.setNonce(addr, n)
+	c.mu.Unlock()
+}
+
+func (c *Chain) setNonce(addr *seth.Address, n uint64) {
+	(*gethState)(&c.State).SetNonce(common.Address(*addr), n)
+}
+
+// Impersonate allows transactions from an address
+// to be sent through the chain's transport without
+// being signed, as if the address were one of the
+// accounts created with NewAccount.
+func (c *Chain) Impersonate(addr *seth.Address) {
+	c.mu.Lock()
+	c.impersonate(addr)
+	c.mu.Unlock()
+}
+
+func (c *Chain) impersonate(addr *seth.Address) {
+	if c.imperson == nil {
+		c.imperson = make(map[seth.Address]struct{})
+	}
+	c.imperson[*addr] = struct{}{}
+}
+
+// StopImpersonating undoes Impersonate.
+func (c *Chain) StopImpersonating(addr *seth.Address) {
+	c.mu.Lock()
+	c.stopImpersonating(addr)
+	c.mu.Unlock()
+}
+
+// stopImpersonating returns whether or
+// not addr was being impersonated
+func (c *Chain) stopImpersonating(addr *seth.Address) bool {
+	_, ok := c.imperson[*addr]
+	delete(c.imperson, *addr)
+	return ok
+}
+
+// canSend returns whether or not unsigned
+// transactions from an address are accepted
+func (c *Chain) canSend(addr *seth.Address) bool {
+	if _, ok := c.imperson[*addr]; ok {
+		return true
+	}
+	for i := range c.accounts {
+		if c.accounts[i] == *addr {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Chain) balanceOf(addr *seth.Address) *big.Int {
 	acct, _ := ((*gethState)(&c.State)).getAccount(addr)
 	bal := acct.Balance()
@@ -899,6 +1083,117 @@ func pretty(v interface{}) []byte {
 	return buf
 }
 
+// Checkpoint saves the state of the chain, including
+// its blocks, receipts, filters, and pending block, and
+// returns an identifier that can be passed to Revert.
+func (c *Chain) Checkpoint() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpoint()
+}
+
+func (c *Chain) checkpoint() int {
+	cp := checkpoint{
+		state:     (*gethState)(&c.State).Snapshot(),
+		blocks:    c.State.Blocks.Snapshot(),
+		preimage:  c.State.Preimage.Snapshot(),
+		pending:   *c.State.Pending,
+		pendingrx: copyrx(c.pendingrx),
+		filters:   make(map[int]filter, len(c.filters)),
+		filtcount: c.filtcount,
+		accounts:  len(c.accounts),
+		offset:    c.offset,
+		pinned:    c.pinned,
+	}
+	cp.pending.Transactions = append([]json.RawMessage(nil), c.State.Pending.Transactions...)
+	for fd, f := range c.filters {
+		cp.filters[fd] = *f
+	}
+	c.checkpts = append(c.checkpts, cp)
+	return len(c.checkpts) - 1
+}
+
+func copyrx(rxs []*seth.Receipt) []*seth.Receipt {
+	out := make([]*seth.Receipt, len(rxs))
+	for i := range rxs {
+		rx := *rxs[i]
+		out[i] = &rx
+	}
+	return out
+}
+
+// Revert restores the state of the chain saved by
+// Checkpoint. Reverting to a checkpoint discards it
+// along with every checkpoint made after it. Revert
+// returns false if the checkpoint does not exist.
+func (c *Chain) Revert(id int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.revert(id)
+}
+
+func (c *Chain) revert(id int) bool {
+	if id < 0 || id >= len(c.checkpts) {
+		return false
+	}
+	cp := &c.checkpts[id]
+	(*gethState)(&c.State).RevertToSnapshot(cp.state)
+	c.State.Blocks.Rollback(cp.blocks)
+	c.State.Preimage.Rollback(cp.preimage)
+	for n := range c.block2snap {
+		if n >= int64(*cp.pending.Number) {
+			delete(c.block2snap, n)
+		}
+	}
+	// transactions executed after the checkpoint are gone
+	for h, snap := range c.tx2snap {
+		if snap >= cp.state {
+			delete(c.tx2snap, h)
+		}
+	}
+	pending := cp.pending
+	c.State.Pending = &pending
+	c.pendingrx = cp.pendingrx
+	c.filters = make(map[int]*filter, len(cp.filters))
+	for fd := range cp.filters {
+		f := cp.filters[fd]
+		c.filters[fd] = &f
+	}
+	c.filtcount = cp.filtcount
+	c.accounts = c.accounts[:cp.accounts]
+	c.offset = cp.offset
+	c.pinned = cp.pinned
+	c.checkpts = c.checkpts[:id]
+	return true
+}
+
+// Errors returned by Mine when a transaction
+// cannot be included in the pending block.
+var (
+	ErrNonceTooLow       = errors.New("tevm: nonce too low")
+	ErrNonceTooHigh      = errors.New("tevm: nonce too high")
+	ErrIntrinsicGas      = errors.New("tevm: intrinsic gas too low")
+	ErrGasLimitReached   = errors.New("tevm: gas limit reached")
+	ErrInsufficientFunds = errors.New("tevm: insufficient funds for gas * price + value")
+)
+
+// intrinsic returns the gas charged for a transaction
+// before any code is executed
+func intrinsic(data []byte, create bool) uint64 {
+	gas := params.TxGas
+	if create {
+		gas = params.TxGasContractCreation
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGas
+		}
+	}
+	return gas
+}
+
 // Mine executes a transaction and returns
 // the return value of the transaction (if any) and the
 // transaction hash. Unlike the other methods of executing
@@ -908,32 +1203,103 @@ func pretty(v interface{}) []byte {
 // this method respects the amount of gas sent in the transaction,
 // rather than offering all of the gas in the block to the transaction,
 // which more faithfully mimics the behavior of an actual ethereum node.
+//
+// Like a real node, Mine requires that the transaction nonce
+// is the sender's next nonce, that the transaction offers at
+// least its intrinsic gas, and that it fits in the pending block.
+// Unless c.NoFees is set, the sender must also be able to afford
+// tx.Gas * tx.GasPrice + tx.Value; the sender is charged for the
+// gas used (less refunds) and the block miner is paid for it.
+// If any of these checks fails, Mine returns one of the errors
+// above and the transaction is not included in the block.
+//
+// If the transaction fails inside of a contract created from
+// a registered bundle, the error is a *RevertError.
 func (c *Chain) Mine(tx *seth.Transaction) (ret []byte, h seth.Hash, err error) {
+	s := c.stacker()
+	ret, rx, err := c.mine(tx, s.config())
+	if rx != nil {
+		h = rx.Hash
+	}
+	return ret, h, s.wrap(err, ret)
+}
+
+// mine implements Mine. If the transaction is included
+// in the block, its receipt is returned along with any
+// execution error; otherwise the receipt is nil.
+func (c *Chain) mine(tx *seth.Transaction, cfg vm.Config) (ret []byte, rx *seth.Receipt, err error) {
 	b := c.State.Pending
+	st := (*gethState)(&c.State)
+	sender := common.Address(*tx.From)
 
-	// make up a tx hash:
+	if n := st.GetNonce(sender); uint64(tx.Nonce) < n {
+		return nil, nil, ErrNonceTooLow
+	} else if uint64(tx.Nonce) > n {
+		return nil, nil, ErrNonceTooHigh
+	}
+	igas := intrinsic(tx.Input, tx.To == nil)
+	if uint64(tx.Gas) < igas {
+		return nil, nil, ErrIntrinsicGas
+	}
+	if b.GasUsed+tx.Gas > b.GasLimit {
+		return nil, nil, ErrGasLimitReached
+	}
+	price := tx.GasPrice.Big()
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(uint64(tx.Gas)), price)
+	if !c.NoFees && st.GetBalance(sender).Cmp(new(big.Int).Add(fee, tx.Value.Big())) < 0 {
+		return nil, nil, ErrInsufficientFunds
+	}
+
+	// make up a tx hash if the transaction doesn't have one:
 	// combine block number and transaction index deterministically
-	bh := n2h(uint64(*b.Number) | (uint64(len(b.Transactions)) << 48))
-	tx.Hash = seth.HashBytes(bh[:])
-	h = tx.Hash
+	if tx.Hash == (seth.Hash{}) {
+		bh := n2h(uint64(*b.Number) | (uint64(len(b.Transactions)) << 48))
+		tx.Hash = seth.HashBytes(bh[:])
+	}
+
+	// save the state before the transaction so
+	// that it can be executed again by a tracer
+	if c.tx2snap == nil {
+		c.tx2snap = make(map[seth.Hash]int)
+	}
+	c.tx2snap[tx.Hash] = st.Snapshot()
+	if !c.NoFees {
+		st.SubBalance(sender, fee)
+	}
 
 	l0 := len(c.State.Logs)
+	c.State.Refund = 0
 
 	var gas uint64
 	var addr common.Address
 	status := 1
-	vm := c.evm(*tx.From)
+	evm := vm.NewEVM(c.context(*tx.From), c.State.StateDB(), &theparams, cfg)
+	evm.Context.GasPrice = price
 	if tx.To == nil {
-		ret, addr, gas, err = vm.Create(s2r(tx.From), []byte(tx.Input), uint64(tx.Gas), tx.Value.Big())
+		// Create increments the sender nonce
+		ret, addr, gas, err = evm.Create(s2r(tx.From), []byte(tx.Input), uint64(tx.Gas)-igas, tx.Value.Big())
 	} else {
-		ret, gas, err = vm.Call(s2r(tx.From), common.Address(*tx.To), []byte(tx.Input), uint64(tx.Gas), tx.Value.Big())
+		evm.StateDB.SetNonce(sender, uint64(tx.Nonce)+1)
+		ret, gas, err = evm.Call(s2r(tx.From), common.Address(*tx.To), []byte(tx.Input), uint64(tx.Gas)-igas, tx.Value.Big())
 	}
 
 	if err != nil {
 		status = 0
 	}
 
+	// apply the refund counter, capped at half the gas used
 	used := uint64(tx.Gas) - gas
+	refund := used / 2
+	if r := st.GetRefund(); r < refund {
+		refund = r
+	}
+	gas += refund
+	used -= refund
+	if !c.NoFees {
+		st.AddBalance(sender, new(big.Int).Mul(new(big.Int).SetUint64(gas), price))
+		st.AddBalance(common.Address(b.Miner), new(big.Int).Mul(new(big.Int).SetUint64(used), price))
+	}
+
 	b.GasUsed += seth.Uint64(used)
 	idx := new(seth.Uint64)
 	*idx = seth.Uint64(len(b.Transactions))
@@ -945,13 +1311,14 @@ func (c *Chain) Mine(tx *seth.Transaction) (ret []byte, h seth.Hash, err error)
 		copy(l.TxHash[:], tx.Hash[:])
 	}
 
-	rx := &seth.Receipt{
-		Hash:       tx.Hash,
-		Index:      *tx.TxIndex,
-		GasUsed:    seth.Uint64(used),
-		Cumulative: b.GasUsed,
-		Logs:       lconv(c.State.Logs[l0:]),
-		Status:     seth.Uint64(status),
+	rx = &seth.Receipt{
+		Hash:              tx.Hash,
+		Index:             *tx.TxIndex,
+		GasUsed:           seth.Uint64(used),
+		Cumulative:        b.GasUsed,
+		Logs:              lconv(c.State.Logs[l0:]),
+		Status:            seth.Uint64(status),
+		EffectiveGasPrice: tx.GasPrice,
 	}
 	if tx.To == nil {
 		rx.Address = new(seth.Address)
@@ -979,13 +1346,27 @@ func js(v interface{}) []byte {
 func (c *Chain) Seal() {
 	b := c.State.Pending
 
+	// the pending block may have been waiting for a
+	// while (when automining is off), so timestamp it
+	// with the time that it is actually sealed
+	if ts := c.clock(0); !c.pinned && ts > b.Timestamp {
+		b.Timestamp = ts
+	}
+	c.pinned = false
+
 	// for all transactions in the block,
 	// produce a transaction receipt
+	var bloom seth.Bloom
 	for i := range c.pendingrx {
 		rx := c.pendingrx[i]
 		copy(rx.BlockHash[:], b.Hash[:])
+		rx.BlockNumber = *b.Number
+		for j := range rx.Logs {
+			bloom.AddLog(&rx.Logs[j])
+		}
 		c.State.Receipts.Insert(rx.Hash[:], encode(rx))
 	}
+	b.Bloom = seth.Data(bloom[:])
 	c.pendingrx = c.pendingrx[:0]
 
 	// seal the current state
@@ -998,11 +1379,110 @@ func (c *Chain) Seal() {
 		Number:          &n,
 		Parent:          *b.Hash,
 		Hash:            &h,
+		Miner:           b.Miner,
 		GasLimit:        b.GasLimit,
 		Difficulty:      seth.NewInt(0),
 		TotalDifficulty: seth.NewInt(0),
-		Timestamp:       seth.Uint64(time.Now().Unix()),
+		Timestamp:       c.clock(b.Timestamp),
+	}
+}
+
+// clock returns the timestamp of a block
+// following a block with timestamp 'prev'
+func (c *Chain) clock(prev seth.Uint64) seth.Uint64 {
+	ts := seth.Uint64(time.Now().Unix() + c.offset)
+	if ts <= prev {
+		ts = prev + 1
+	}
+	return ts
+}
+
+// SetAutomine determines whether or not a block is sealed
+// for every transaction sent through the chain's transport,
+// which is the default. When automining is off, transactions
+// accumulate in the pending block until it is sealed, either
+// by Seal, by an evm_mine RPC, or by interval mining.
+func (c *Chain) SetAutomine(on bool) {
+	c.mu.Lock()
+	c.manual = !on
+	c.mu.Unlock()
+}
+
+// SetMiningInterval causes the pending block to be sealed
+// every 'd' in the background, independent of automining.
+// An interval of zero stops interval mining. While interval
+// mining is on, the chain must be accessed through its
+// transport or through methods that lock the chain.
+func (c *Chain) SetMiningInterval(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopmine != nil {
+		close(c.stopmine)
+		c.stopmine = nil
+	}
+	c.interval = d
+	if d <= 0 {
+		return
 	}
+	stop := make(chan struct{})
+	c.stopmine = stop
+	go func() {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				c.mu.Lock()
+				c.Seal()
+				c.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// IncreaseTime moves the chain's clock forward by 'd',
+// which is rounded down to a whole number of seconds.
+// The pending block and every block after it are
+// timestamped accordingly. IncreaseTime returns the
+// total adjustment made to the clock.
+func (c *Chain) IncreaseTime(d time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.increaseTime(int64(d / time.Second))
+}
+
+func (c *Chain) increaseTime(sec int64) time.Duration {
+	c.offset += sec
+	c.State.Pending.Timestamp = seth.Uint64(int64(c.State.Pending.Timestamp) + sec)
+	return time.Duration(c.offset) * time.Second
+}
+
+// SetNextBlockTimestamp sets the timestamp of the pending block.
+// Subsequent blocks are timestamped relative to 't'. The timestamp
+// must be later than the timestamp of the latest sealed block.
+func (c *Chain) SetNextBlockTimestamp(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setNextBlockTimestamp(t.Unix())
+}
+
+func (c *Chain) setNextBlockTimestamp(ts int64) error {
+	b := c.State.Pending
+	if buf := c.State.Blocks.Get(b.Parent[:]); buf != nil {
+		parent := new(seth.Block)
+		if _, err := parent.UnmarshalMsg(buf); err != nil {
+			return err
+		}
+		if ts <= int64(parent.Timestamp) {
+			return fmt.Errorf("tevm: timestamp %d is not later than the latest block timestamp %d", ts, parent.Timestamp)
+		}
+	}
+	c.offset = ts - time.Now().Unix()
+	b.Timestamp = seth.Uint64(ts)
+	c.pinned = true
+	return nil
 }
 
 // MarshalJSON implements json.Marshaler.
@@ -1011,7 +1491,9 @@ func (c *Chain) MarshalJSON() ([]byte, error) {
 	b, err := json.Marshal(&struct {
 		State      State
 		Block2snap map[int64]int
-	}{c.State, c.block2snap})
+		Tx2snap    map[seth.Hash]int
+		Accounts   []seth.Address
+	}{c.State, c.block2snap, c.tx2snap, c.accounts})
 	c.mu.Unlock()
 	return b, err
 }
@@ -1021,6 +1503,8 @@ func (c *Chain) UnmarshalJSON(b []byte) error {
 	var s struct {
 		State      State
 		Block2snap map[int64]int
+		Tx2snap    map[seth.Hash]int
+		Accounts   []seth.Address
 	}
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
@@ -1028,6 +1512,8 @@ func (c *Chain) UnmarshalJSON(b []byte) error {
 	c.mu.Lock()
 	c.State = s.State
 	c.block2snap = s.Block2snap
+	c.tx2snap = s.Tx2snap
+	c.accounts = s.Accounts
 	c.mu.Unlock()
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/philhofer/seth"
@@ -48,6 +49,7 @@ func TestChainBasic(t *testing.T) {
 	t.Parallel()
 	c := NewChain()
 	// c.State.Trace = tracefn(t) // -- for debugging
+	c.NoFees = true // the balances below are exact
 	me := c.NewAccount(1)
 	please(t, c.BalanceOf(&me).Int64() == 1e18)
 
@@ -145,6 +147,156 @@ func TestTransportBasic(t *testing.T) {
 	}
 }
 
+// TestMineFees tests that Mine enforces nonces
+// and charges for gas like a real node.
+func TestMineFees(t *testing.T) {
+	t.Parallel()
+	c := NewChain()
+	c.State.Pending.Miner = seth.Address{0xcc}
+	me := c.NewAccount(1)
+	to := seth.Address{0xaa}
+
+	tx := func(from *seth.Address, nonce, gas uint64) *seth.Transaction {
+		return &seth.Transaction{
+			From:     from,
+			To:       &to,
+			Nonce:    seth.Uint64(nonce),
+			Gas:      seth.Uint64(gas),
+			GasPrice: *seth.NewInt(1e10),
+			Value:    *seth.NewInt(1),
+		}
+	}
+	_, h, err := c.Mine(tx(&me, 0, 50000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Seal()
+	fee := int64(21000 * 1e10)
+	if b := c.BalanceOf(&me).Int64(); b != 1e18-fee-1 {
+		t.Errorf("sender balance %d; want %d", b, 1e18-fee-1)
+	}
+	if b := c.BalanceOf(&c.State.Pending.Miner).Int64(); b != fee {
+		t.Errorf("miner balance %d; want %d", b, fee)
+	}
+	rx, err := c.Client().GetReceipt(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx.GasUsed != 21000 || rx.EffectiveGasPrice.Int64() != 1e10 {
+		t.Errorf("unexpected receipt %+v", rx)
+	}
+
+	checks := []struct {
+		tx  *seth.Transaction
+		err error
+	}{
+		{tx(&me, 0, 21000), ErrNonceTooLow},
+		{tx(&me, 2, 21000), ErrNonceTooHigh},
+		{tx(&me, 1, 20999), ErrIntrinsicGas},
+		{tx(&me, 1, defaultGasLimit+1), ErrGasLimitReached},
+		{tx(&to, 0, 21000), ErrInsufficientFunds},
+	}
+	for i := range checks {
+		if _, _, err := c.Mine(checks[i].tx); err != checks[i].err {
+			t.Errorf("check %d: got error %v; want %v", i, err, checks[i].err)
+		}
+	}
+	if len(c.State.Pending.Transactions) != 0 {
+		t.Fatal("rejected transactions were included in the block")
+	}
+
+	// without fees, only the value is transferred
+	poor := c.NewAccount(0)
+	c.AddBalance(&poor, big.NewInt(1))
+	c.NoFees = true
+	if _, _, err := c.Mine(tx(&poor, 0, 21000)); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.BalanceOf(&poor).Int64(); b != 0 {
+		t.Errorf("balance %d after NoFees transaction", b)
+	}
+}
+
+// TestCheckpoint tests that Revert restores
+// the state saved by Checkpoint.
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	c := NewChain()
+	client := c.Client()
+	me := c.NewAccount(1)
+	sender := c.Sender(&me)
+	pay := func() seth.Hash {
+		t.Helper()
+		h, err := sender.Call(&seth.CallOpts{To: &seth.Address{0xaa}, Value: seth.NewInt(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	pay()
+
+	bal := c.BalanceOf(&me)
+	num := *c.State.Pending.Number
+	ts := c.State.Pending.Timestamp
+	id := c.Checkpoint()
+
+	h := pay()
+	other := c.NewAccount(1)
+	c.IncreaseTime(time.Hour)
+	var fd seth.Uint64
+	if err := client.Do("eth_newFilter", []json.RawMessage{json.RawMessage("{}")}, &fd); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Revert(id) {
+		t.Fatal("Revert failed")
+	}
+	if b := c.BalanceOf(&me); b.Cmp(bal) != 0 {
+		t.Errorf("balance %s after revert; want %s", b, bal)
+	}
+	if b := c.BalanceOf(&other); b.Sign() != 0 {
+		t.Errorf("new account has balance %s after revert", b)
+	}
+	if p := c.State.Pending; *p.Number != num || p.Timestamp != ts || len(p.Transactions) != 0 {
+		t.Errorf("unexpected pending block %+v", p)
+	}
+	if _, err := client.GetReceipt(&h); err != seth.ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+	if n, err := client.GetBlockTransactionCount(int64(num)); err != nil || n != 0 {
+		t.Errorf("block %d has %d transactions after revert (%v)", num, n, err)
+	}
+	if c.AtBlock(int64(num)+1) != nil {
+		t.Error("found state for a reverted block")
+	}
+	if _, ok := c.tx2snap[h]; ok {
+		t.Error("found the state before a reverted transaction")
+	}
+	var changes json.RawMessage
+	if err := client.Do("eth_getFilterChanges", []json.RawMessage{js(fd)}, &changes); err == nil {
+		t.Error("found a filter installed after the checkpoint")
+	}
+	if c.Revert(id) {
+		t.Error("reverted to a checkpoint twice")
+	}
+
+	// the chain continues from the checkpoint, and
+	// the same is possible with evm_snapshot and evm_revert
+	var snap seth.Uint64
+	if err := client.Do("evm_snapshot", nil, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if h2 := pay(); h2 != h {
+		t.Errorf("got tx hash %s after revert; want %s", h2.String(), h.String())
+	}
+	var ok bool
+	if err := client.Do("evm_revert", []json.RawMessage{js(snap)}, &ok); err != nil || !ok {
+		t.Fatalf("evm_revert returned %v %v", ok, err)
+	}
+	if b := c.BalanceOf(&me); b.Cmp(bal) != 0 {
+		t.Errorf("balance %s after revert; want %s", b, bal)
+	}
+}
+
 // Test that a chain can be JSON marshaled and recovered.
 func TestChainSerialization(t *testing.T) {
 	t.Parallel()
@@ -2,9 +2,11 @@ package tevm
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/philhofer/seth"
 )
 
@@ -68,3 +70,170 @@ func TestFilter(t *testing.T) {
 	checkTransfer()
 	filter.Close()
 }
+
+func TestFilterQuery(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	acct := chain.NewAccount(1)
+	client := chain.Client()
+	sender := chain.Sender(&acct)
+
+	// the runtime code emits LOG2 with topics
+	// calldata[0:32] and calldata[32:64]:
+	//   PUSH1 32 CALLDATALOAD PUSH1 0 CALLDATALOAD
+	//   PUSH1 0 PUSH1 0 LOG2 STOP
+	code, err := hex.DecodeString("600c600c600039600c6000f3" + "60203560003560006000a200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contracts [2]seth.Address
+	for i := range contracts {
+		contracts[i], err = sender.Create(code, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	start, err := client.BlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c := seth.HashString("A"), seth.HashString("B"), seth.HashString("C")
+	x, y := seth.HashString("x"), seth.HashString("y")
+	emit := func(contract *seth.Address, topic0, topic1 seth.Hash) {
+		t.Helper()
+		opts := seth.CallOpts{To: contract, Data: append(topic0[:], topic1[:]...)}
+		h, err := sender.Call(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sender.Wait(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	emit(&contracts[0], a, x)
+	emit(&contracts[0], b, y)
+	emit(&contracts[0], c, x)
+	emit(&contracts[1], a, x)
+	end, err := client.BlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query seth.FilterQuery
+		want  int
+	}{
+		{seth.FilterQuery{FromBlock: start, ToBlock: end, Addresses: contracts[:], Topics: [][]seth.Hash{{a, b}, {x}}}, 2},
+		{seth.FilterQuery{FromBlock: start, ToBlock: end, Addresses: contracts[:1], Topics: [][]seth.Hash{{a, b, c}}}, 3},
+		{seth.FilterQuery{FromBlock: start, ToBlock: end, Topics: [][]seth.Hash{nil, {y}}}, 1},
+		{seth.FilterQuery{FromBlock: start, ToBlock: end}, 4},
+		{seth.FilterQuery{FromBlock: end + 1, ToBlock: end + 1}, 0},
+	}
+	for i := range cases {
+		logs, err := client.Logs(&cases[i].query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != cases[i].want {
+			t.Errorf("case %d: eth_getLogs returned %d logs; wanted %d", i, len(logs), cases[i].want)
+		}
+
+		f, err := client.NewFilter(&cases[i].query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range f.Out() {
+			n++
+		}
+		if err := f.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != cases[i].want {
+			t.Errorf("case %d: filter returned %d logs; wanted %d", i, n, cases[i].want)
+		}
+		f.Close()
+
+		if cases[i].query.FromBlock > end {
+			continue
+		}
+		n = 0
+		err = client.ScanReceipts(&cases[i].query, start, end, func(r *seth.Receipt) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != cases[i].want {
+			t.Errorf("case %d: scan returned %d receipts; wanted %d", i, n, cases[i].want)
+		}
+	}
+
+	// every sealed block should carry the same
+	// bloom filter that geth would compute
+	var empty seth.Bloom
+	for n := start; n <= end; n++ {
+		b, err := client.GetBlock(n, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var glogs []*types.Log
+		for _, l := range chain.State.Logs {
+			if int64(l.BlockNumber) == n {
+				glogs = append(glogs, l)
+			}
+		}
+		bloom, ok := b.LogsBloom()
+		if !ok {
+			// the pending block has no bloom
+			if len(glogs) > 0 {
+				t.Fatalf("block %d has no bloom", n)
+			}
+			continue
+		}
+		want := types.BytesToBloom(types.LogsBloom(glogs).Bytes())
+		if !bytes.Equal(bloom[:], want[:]) {
+			t.Errorf("block %d: bloom %s; geth computes %x", n, bloom, want[:])
+		}
+		if len(glogs) > 0 && *bloom == empty {
+			t.Errorf("block %d: empty bloom", n)
+		}
+		for _, l := range glogs {
+			addr := seth.Address(l.Address)
+			topic := seth.Hash(l.Topics[0])
+			if !bloom.Test(&addr) || !bloom.TestTopic(&topic) {
+				t.Errorf("block %d: bloom is missing %x or %x", n, addr[:], topic[:])
+			}
+		}
+	}
+
+	// "latest" is the last sealed block, which
+	// holds only the last log emitted above
+	for _, to := range []int64{seth.Latest, seth.Pending, end} {
+		logs, err := client.Logs(&seth.FilterQuery{FromBlock: seth.Latest, ToBlock: to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 1 || logs[0].Address != contracts[1] {
+			t.Errorf("logs from latest to %d: %v", to, logs)
+		}
+	}
+	// ... and a filter installed at "latest"
+	// doesn't yield the logs in earlier blocks
+	f, err := client.NewFilter(&seth.FilterQuery{FromBlock: seth.Latest, ToBlock: seth.Latest, Topics: [][]seth.Hash{{b}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	emit(&contracts[1], b, y)
+	select {
+	case l := <-f.Out():
+		if l.Address != contracts[1] {
+			t.Errorf("filter from latest yielded a log from %s", l.Address)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no log from filter")
+	}
+}
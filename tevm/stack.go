@@ -0,0 +1,337 @@
+package tevm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/philhofer/seth"
+)
+
+// source is a compiled contract and the bundle it belongs to
+type source struct {
+	bundle   *seth.CompiledBundle
+	contract *seth.CompiledContract
+}
+
+// registry maps contract addresses to the
+// compiled contracts they were created from
+type registry struct {
+	bundles []*seth.CompiledBundle
+	known   map[common.Address]source
+}
+
+func (r *registry) copy() *registry {
+	if r == nil {
+		return nil
+	}
+	cr := &registry{
+		bundles: r.bundles[:len(r.bundles):len(r.bundles)],
+		known:   make(map[common.Address]source, len(r.known)),
+	}
+	for addr, src := range r.known {
+		cr.known[addr] = src
+	}
+	return cr
+}
+
+// find finds the contract with the given creation
+// code (plus constructor arguments) or deployed code
+func (r *registry) find(code []byte, create bool) (source, bool) {
+	for _, b := range r.bundles {
+		for i := range b.Contracts {
+			cc := &b.Contracts[i]
+			if create && len(cc.Code) > 0 && bytes.HasPrefix(code, cc.Code) ||
+				!create && len(cc.DeployedCode) > 0 && bytes.Equal(code, cc.DeployedCode) {
+				return source{bundle: b, contract: cc}, true
+			}
+		}
+	}
+	return source{}, false
+}
+
+// lookup returns the source of code executing at addr.
+// When a registered contract is created, its address is
+// recorded so that later calls to it can be attributed
+// to the contract even if its code cannot be matched.
+func (r *registry) lookup(addr common.Address, code []byte, create bool) (source, bool) {
+	if create {
+		src, ok := r.find(code, true)
+		if ok {
+			r.known[addr] = src
+		} else {
+			delete(r.known, addr)
+		}
+		return src, ok
+	}
+	if src, ok := r.known[addr]; ok {
+		return src, true
+	}
+	src, ok := r.find(code, false)
+	if ok {
+		r.known[addr] = src
+	}
+	return src, ok
+}
+
+// Register registers the contracts in a compiled bundle
+// with the chain. Contracts created from the creation code
+// of a registered contract (by any means) are associated
+// with that contract, and failed calls into them return
+// a *RevertError that carries a Solidity stack trace.
+// Calls into contracts whose code is identical to the
+// deployed code of a registered contract are also
+// associated with that contract.
+//
+// Executing transactions is somewhat slower once
+// a bundle has been registered. Registered bundles
+// are also the ones included in code coverage reports;
+// see StartCoverage.
+func (c *Chain) Register(b *seth.CompiledBundle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sources == nil {
+		c.sources = &registry{known: make(map[common.Address]source)}
+	}
+	c.sources.bundles = append(c.sources.bundles, b)
+	coverBundle(b)
+}
+
+// Frame is one frame of a Solidity stack trace.
+type Frame struct {
+	Address  seth.Address `json:"address"`            // address of the contract
+	Contract string       `json:"contract,omitempty"` // contract name, if the contract is known
+	// Function is the name of the function being executed,
+	// or "constructor" or "fallback". It is empty when the
+	// function cannot be determined.
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"` // source file of the current statement
+	Line     int    `json:"line,omitempty"` // line of the current statement
+}
+
+func (f *Frame) String() string {
+	if f.Contract == "" {
+		return f.Address.String()
+	}
+	s := f.Contract
+	if f.Function != "" {
+		s += "." + f.Function
+	}
+	if f.File != "" {
+		s += fmt.Sprintf(" (%s:%d)", f.File, f.Line)
+	}
+	return s
+}
+
+// RevertError is the error returned by Create, Call, StaticCall,
+// and Mine when execution fails inside of a contract created
+// from a registered bundle. (See Register.) In the RPC
+// interface, the revert data and the stack are returned as
+// the error data.
+type RevertError struct {
+	Err  error  // the error returned by the EVM
+	Data []byte // the data returned by the failed call
+	// Stack is the call stack at the point where the
+	// failure happened, starting with the innermost frame.
+	// For each frame, the current statement is the one
+	// that failed or the call to the frame above it.
+	Stack []Frame
+}
+
+// message is the error message without the stack trace
+func (e *RevertError) message() string {
+	if reason, ok := seth.DecodeRevert(e.Data); ok {
+		return e.Err.Error() + ": " + reason
+	}
+	return e.Err.Error()
+}
+
+func (e *RevertError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.message())
+	for i := range e.Stack {
+		sb.WriteString("\n\tat ")
+		sb.WriteString(e.Stack[i].String())
+	}
+	return sb.String()
+}
+
+// Unwrap returns e.Err.
+func (e *RevertError) Unwrap() error { return e.Err }
+
+// errdata returns the JSON RPC error data for e
+func (e *RevertError) errdata() json.RawMessage {
+	b, err := json.Marshal(&struct {
+		Data  seth.Data `json:"data"`
+		Stack []Frame   `json:"stack"`
+	}{e.Data, e.Stack})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// stackframe is a call frame tracked by a stacker
+type stackframe struct {
+	id     int
+	addr   common.Address // address of the executing code
+	input  []byte
+	create bool
+	pc     uint64
+	src    source
+	known  bool
+	cover  []covered // see StartCoverage
+	last   *covered  // the last instruction covered
+}
+
+// stacker implements vm.Tracer; it tracks the call stack
+// so that it can be reported when execution fails
+type stacker struct {
+	sources *registry
+	frames  []stackframe // frames[i] is executing at depth i+1
+	failed  []stackframe // the call stack at the innermost failure
+	output  []byte       // the data returned by the innermost failure
+	revert  []byte       // the data passed to the last REVERT
+	lastop  vm.OpCode    // the last instruction executed
+	create  bool         // whether or not the outermost frame is a create
+	nextid  int
+}
+
+// config returns the vm.Config for executing
+// with s, which may be nil
+func (s *stacker) config() vm.Config {
+	if s == nil {
+		return theconfig
+	}
+	return vm.Config{Debug: true, Tracer: s}
+}
+
+func (s *stacker) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	s.frames = s.frames[:0]
+	s.failed = nil
+	s.create = create
+	return nil
+}
+
+func (s *stacker) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if depth > len(s.frames) {
+		s.enter(contract)
+	} else {
+		s.frames = s.frames[:depth]
+	}
+	s.frames[depth-1].pc = pc
+	s.frames[depth-1].step(pc, op, stack)
+	s.lastop = op
+	switch {
+	case err != nil:
+		s.fail(depth, nil)
+	case op == vm.REVERT:
+		// the arguments are gone by the time
+		// that CaptureFault is called
+		s.revert = mem(memory, stack.Back(0), stack.Back(1))
+	}
+	return nil
+}
+
+// enter pushes a new frame for the contract
+func (s *stacker) enter(contract *vm.Contract) {
+	f := stackframe{
+		id:    s.nextid,
+		addr:  contract.Address(),
+		input: contract.Input,
+	}
+	s.nextid++
+	if len(s.frames) == 0 {
+		f.create = s.create
+	} else {
+		f.create = s.lastop == vm.CREATE || s.lastop == vm.CREATE2
+	}
+	if !f.create && contract.CodeAddr != nil {
+		f.addr = *contract.CodeAddr
+	}
+	f.src, f.known = s.sources.lookup(f.addr, contract.Code, f.create)
+	if f.known {
+		f.cover = coverFor(&f.src, !f.create)
+	}
+	s.frames = append(s.frames, f)
+}
+
+// fail records a failure in the frame at depth
+func (s *stacker) fail(depth int, output []byte) {
+	if depth > len(s.frames) {
+		return
+	}
+	// when a failure in a callee is propagated
+	// (by reverting with the same data), keep the
+	// stack at the original failure
+	if len(s.failed) > depth && s.failed[depth-1].id == s.frames[depth-1].id && bytes.Equal(output, s.output) {
+		return
+	}
+	s.failed = append(s.failed[:0], s.frames[:depth]...)
+	s.output = output
+}
+
+func (s *stacker) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	var output []byte
+	if op == vm.REVERT {
+		output = s.revert
+	}
+	s.fail(depth, output)
+	return nil
+}
+
+func (s *stacker) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+// frame produces the stack trace frame for f
+func (f *stackframe) frame() Frame {
+	fr := Frame{Address: seth.Address(f.addr)}
+	if !f.known {
+		return fr
+	}
+	cc := f.src.contract
+	fr.Contract = cc.Name
+	switch {
+	case f.create:
+		fr.Function = "constructor"
+	case len(f.input) < 4:
+		fr.Function = "fallback"
+	default:
+		if d := cc.FindSelector(f.input); d != nil {
+			fr.Function = d.Name
+		} else {
+			fr.Function = "fallback"
+		}
+	}
+	fr.File, fr.Line = f.src.bundle.Position(cc, int(f.pc), !f.create)
+	return fr
+}
+
+// wrap returns err as a *RevertError if the
+// failure happened inside of a known contract
+func (s *stacker) wrap(err error, ret []byte) error {
+	if s == nil || err == nil || len(s.failed) == 0 {
+		return err
+	}
+	known := false
+	stack := make([]Frame, len(s.failed))
+	for i := range s.failed {
+		f := &s.failed[len(s.failed)-1-i]
+		known = known || f.known
+		stack[i] = f.frame()
+	}
+	if !known {
+		return err
+	}
+	return &RevertError{
+		Err:   err,
+		Data:  append([]byte(nil), ret...),
+		Stack: stack,
+	}
+}
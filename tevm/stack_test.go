@@ -0,0 +1,198 @@
+package tevm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/philhofer/seth"
+)
+
+// deploy returns creation code that deploys 'runtime':
+//
+//	PUSH1 len DUP1 PUSH1 11 PUSH1 0 CODECOPY PUSH1 0 RETURN
+func deploy(runtime []byte) []byte {
+	return append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, runtime...)
+}
+
+// srcmap returns a sourcemap that maps the first
+// len(stmts) instructions to the given statements
+func srcmap(src string, file int, stmts ...string) string {
+	var parts []string
+	prev := ""
+	for _, s := range stmts {
+		if s == prev {
+			parts = append(parts, "")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d:%d:%d", strings.Index(src, s), len(s), file))
+		prev = s
+	}
+	return strings.Join(parts, ";")
+}
+
+// stackBundle returns a bundle with the contracts
+//
+//	Inner, which reverts in fail(),
+//	Outer, which calls Inner.fail() in poke(address), and
+//	Bad, which reverts in its constructor
+//
+// along with their hand-assembled code and source maps
+func stackBundle() *seth.CompiledBundle {
+	inner := `contract Inner {
+	function fail() public {
+		revert();
+	}
+}
+`
+	outer := `contract Outer {
+	function poke(Inner inner) public {
+		// always fails
+		inner.fail();
+	}
+}
+`
+	bad := `contract Bad {
+	constructor() public {
+		revert();
+	}
+}
+`
+	// PUSH1 0 DUP1 REVERT
+	revert := mustHex("600080fd")
+
+	// PUSH32 selector PUSH1 0 MSTORE
+	// PUSH1 0 PUSH1 0 PUSH1 4 PUSH1 0 PUSH1 0 PUSH1 4 CALLDATALOAD GAS CALL
+	// ISZERO PUSH1 56 JUMPI STOP JUMPDEST PUSH1 0 DUP1 REVERT
+	sel := seth.HashString("fail()")
+	outercode := append([]byte{0x7f}, sel[:4]...)
+	outercode = append(outercode, make([]byte, 28)...)
+	outercode = append(outercode, mustHex("60005260006000600460006000600435"+"5af11560385700"+"5b600080fd")...)
+	var outermap []string
+	for i := 0; i < 20; i++ {
+		stmt := "function poke"
+		if i >= 11 { // CALL
+			stmt = "inner.fail()"
+		}
+		outermap = append(outermap, stmt)
+	}
+
+	return &seth.CompiledBundle{
+		Filenames: []string{"inner.sol", "outer.sol", "bad.sol"},
+		Sources:   []string{inner, outer, bad},
+		Contracts: []seth.CompiledContract{{
+			Name:              "Inner",
+			Code:              deploy(revert),
+			DeployedCode:      revert,
+			DeployedSourcemap: srcmap(inner, 0, "function fail", "function fail", "revert()"),
+			ABI:               []seth.ABIDescriptor{{Type: "function", Name: "fail"}},
+		}, {
+			Name:              "Outer",
+			Code:              deploy(outercode),
+			DeployedCode:      outercode,
+			DeployedSourcemap: srcmap(outer, 1, outermap...),
+			ABI: []seth.ABIDescriptor{{
+				Type:   "function",
+				Name:   "poke",
+				Inputs: []seth.ABIParam{{Name: "inner", Type: "address"}},
+			}},
+		}, {
+			Name:      "Bad",
+			Code:      revert,
+			Sourcemap: srcmap(bad, 2, "constructor", "constructor", "revert()"),
+		}},
+	}
+}
+
+func TestRevertStack(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	me := chain.NewAccount(1)
+	bundle := stackBundle()
+	chain.Register(bundle)
+
+	inner, err := chain.Create(&me, bundle.Contract("Inner").Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, err := chain.Create(&me, bundle.Contract("Outer").Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Frame{
+		{Address: inner, Contract: "Inner", Function: "fail", File: "inner.sol", Line: 3},
+		{Address: outer, Contract: "Outer", Function: "poke", File: "outer.sol", Line: 4},
+	}
+	check := func(what string, err error) {
+		t.Helper()
+		re, ok := err.(*RevertError)
+		if !ok {
+			t.Fatalf("%s: unexpected error %v", what, err)
+		}
+		if fmt.Sprint(re.Stack) != fmt.Sprint(want) || re.Err.Error() != "evm: execution reverted" {
+			t.Errorf("%s: unexpected stack %v", what, re.Stack)
+		}
+	}
+
+	_, err = chain.Call(&me, &outer, "poke(address)", &inner)
+	check("Call", err)
+	if msg := err.Error(); !strings.Contains(msg, "\n\tat Inner.fail (inner.sol:3)\n\tat Outer.poke (outer.sol:4)") {
+		t.Errorf("unexpected error message %q", msg)
+	}
+
+	client := chain.Client()
+	opts := &seth.CallOpts{From: &me, To: &outer, Gas: seth.NewInt(100000)}
+	opts.EncodeCall("poke(address)", &inner)
+	_, err = client.Call(opts)
+	re, ok := err.(*seth.RPCError)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var data struct {
+		Stack []Frame
+	}
+	if err := json.Unmarshal(re.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(data.Stack) != fmt.Sprint(want) {
+		t.Errorf("unexpected error data %s", re.Data)
+	}
+	if _, ok := re.RevertData(); !ok {
+		t.Errorf("no revert data in %s", re.Data)
+	}
+
+	// Mine reports the same stack
+	tx := &seth.Transaction{
+		From:  &me,
+		To:    &outer,
+		Gas:   100000,
+		Input: opts.Data,
+		Nonce: seth.Uint64(chain.State.StateDB().GetNonce(common.Address(me))),
+	}
+	_, _, err = chain.Mine(tx)
+	check("Mine", err)
+
+	// failures in constructors
+	_, err = chain.Create(&me, bundle.Contract("Bad").Code)
+	re2, ok := err.(*RevertError)
+	if !ok || len(re2.Stack) != 1 || re2.Stack[0].String() != "Bad.constructor (bad.sol:3)" {
+		t.Errorf("unexpected constructor error %v", err)
+	}
+
+	// contracts that can't be identified are
+	// reported without a stack trace
+	other := seth.Address{0xc1}
+	chain.SetCode(&other, mustHex("60006000fd"))
+	if _, err := chain.Call(&me, &other, "fail()"); err == nil || err.Error() != "evm: execution reverted" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// a copy of the deployed code is recognized
+	chain.SetCode(&other, bundle.Contract("Inner").DeployedCode)
+	_, err = chain.Call(&me, &other, "fail()")
+	if re, ok := err.(*RevertError); !ok || re.Stack[0].Contract != "Inner" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/philhofer/seth"
 	"github.com/philhofer/seth/tevm"
@@ -15,11 +16,13 @@ import (
 var addr string
 var src string
 var verbose bool
+var blocktime time.Duration
 
 func init() {
 	flag.StringVar(&addr, "a", ":8043", "bind address to listen on")
 	flag.StringVar(&src, "e", "", "chain source (path or url)")
 	flag.BoolVar(&verbose, "v", false, "be verbose")
+	flag.DurationVar(&blocktime, "b", 0, "block time (default: one block per transaction)")
 }
 
 func client() *seth.Client {
@@ -74,6 +77,10 @@ func main() {
 	if verbose {
 		c.Debugf = log.Printf
 	}
+	if blocktime > 0 {
+		c.SetAutomine(false)
+		c.SetMiningInterval(blocktime)
+	}
 
 	acct := c.NewAccount(10)
 	log.Println("default account:", acct.String())
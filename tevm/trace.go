@@ -0,0 +1,419 @@
+package tevm
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/philhofer/seth"
+)
+
+// TraceConfig determines what is captured by a trace.
+// Its JSON representation is the same as the options
+// accepted by geth's debug_traceTransaction.
+type TraceConfig struct {
+	DisableStack   bool `json:"disableStack"`
+	DisableMemory  bool `json:"disableMemory"`
+	DisableStorage bool `json:"disableStorage"`
+
+	// Tracer selects the result returned by the
+	// debug_trace* RPCs. The empty string selects
+	// the struct logs, and "callTracer" selects
+	// the call tree. No other tracers are supported.
+	Tracer string `json:"tracer"`
+}
+
+// StructLog is the state of the EVM before the execution
+// of one instruction. Stack items, memory words, and storage
+// are hex-encoded without a prefix, as they are by geth.
+type StructLog struct {
+	Pc      uint64 `json:"pc"`
+	Op      string `json:"op"`
+	Gas     uint64 `json:"gas"`
+	GasCost uint64 `json:"gasCost"`
+	Depth   int    `json:"depth"`
+	Error   string `json:"error,omitempty"`
+
+	Stack  []string `json:"stack,omitempty"`
+	Memory []string `json:"memory,omitempty"` // 32-byte words
+	// Storage holds the storage slots of the
+	// executing contract written so far.
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// CallFrame is a message call made during the
+// execution of a transaction, in the format produced
+// by geth's callTracer.
+type CallFrame struct {
+	Type    string       `json:"type"` // CALL, STATICCALL, CREATE, etc.
+	From    seth.Address `json:"from"`
+	To      seth.Address `json:"to"`
+	Value   *seth.Int    `json:"value,omitempty"`
+	Gas     seth.Uint64  `json:"gas"`
+	GasUsed seth.Uint64  `json:"gasUsed"`
+	Input   seth.Data    `json:"input"`
+	Output  seth.Data    `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Calls   []CallFrame  `json:"calls,omitempty"`
+
+	left uint64 // gas left after the last instruction
+}
+
+func (c *TraceConfig) check() error {
+	switch c.Tracer {
+	case "", "callTracer":
+		return nil
+	}
+	return fmt.Errorf("tevm: unsupported tracer %q", c.Tracer)
+}
+
+// result returns the part of a trace selected by c.Tracer
+func (c *TraceConfig) result(tr *Trace) interface{} {
+	if c.Tracer == "callTracer" {
+		return tr.Call
+	}
+	return tr
+}
+
+// Trace is the execution trace of a transaction. Its JSON
+// representation is the one returned by geth's
+// debug_traceTransaction when no tracer is specified.
+type Trace struct {
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []StructLog `json:"structLogs"`
+
+	// Call is the call tree of the transaction.
+	Call *CallFrame `json:"-"`
+}
+
+// tracer implements vm.Tracer
+type tracer struct {
+	cfg     TraceConfig
+	logs    []StructLog
+	storage map[common.Address]map[string]string
+	frames  []*CallFrame // frames[i] is executing at depth i+1
+	pending *CallFrame   // the call made by the last instruction
+}
+
+func newTracer(cfg *TraceConfig) *tracer {
+	t := &tracer{storage: make(map[common.Address]map[string]string)}
+	if cfg != nil {
+		t.cfg = *cfg
+	}
+	return t
+}
+
+func (t *tracer) config() vm.Config {
+	return vm.Config{Debug: true, Tracer: t}
+}
+
+func (t *tracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	f := &CallFrame{
+		Type:  "CALL",
+		From:  seth.Address(from),
+		To:    seth.Address(to),
+		Value: (*seth.Int)(new(big.Int).Set(value)),
+		Gas:   seth.Uint64(gas),
+		Input: append(seth.Data(nil), input...),
+	}
+	if create {
+		f.Type = "CREATE"
+	}
+	t.frames = []*CallFrame{f}
+	return nil
+}
+
+// word returns the hex encoding of a stack item
+func word(v *big.Int) string {
+	return fmt.Sprintf("%x", math.PaddedBigBytes(v, 32))
+}
+
+// mem returns a copy of memory[off:off+size], or
+// nil if the range does not fit in memory
+func mem(m *vm.Memory, off, size *big.Int) []byte {
+	if !off.IsInt64() || !size.IsInt64() || off.Int64()+size.Int64() > int64(m.Len()) {
+		return nil
+	}
+	return m.Get(off.Int64(), size.Int64())
+}
+
+// exit pops the frame on top of the call stack; 'ok'
+// is whether or not the call succeeded
+func (t *tracer) exit(ok bool) {
+	n := len(t.frames) - 1
+	f := t.frames[n]
+	t.frames = t.frames[:n]
+	if !ok && f.Error == "" {
+		f.Error = "execution failed"
+	}
+	f.GasUsed = f.Gas - seth.Uint64(f.left)
+	if n > 0 {
+		p := t.frames[n-1]
+		p.Calls = append(p.Calls, *f)
+	}
+}
+
+// returned handles the return of every call made from
+// a frame at 'depth', given the stack of that frame
+func (t *tracer) returned(depth int, stack *vm.Stack) {
+	ok := len(stack.Data()) > 0 && stack.Back(0).Sign() != 0
+	if f := t.pending; f != nil {
+		// the call did not execute any code
+		t.pending = nil
+		if len(t.frames) == depth {
+			f.left = uint64(f.Gas)
+			if f.Type == "CREATE" || f.Type == "CREATE2" {
+				f.left = 0
+			}
+			t.frames = append(t.frames, f)
+		}
+	}
+	for len(t.frames) > depth {
+		f := t.frames[len(t.frames)-1]
+		if ok && (f.Type == "CREATE" || f.Type == "CREATE2") {
+			f.To = seth.Address(common.BigToAddress(stack.Back(0)))
+		}
+		t.exit(ok)
+	}
+}
+
+func (t *tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if f := t.pending; f != nil && depth == len(t.frames)+1 {
+		// the first instruction of a new call
+		t.pending = nil
+		f.Gas = seth.Uint64(gas)
+		t.frames = append(t.frames, f)
+	} else if len(t.frames) > 0 {
+		t.returned(depth, stack)
+	}
+
+	addr := contract.Address()
+	if op == vm.SSTORE && len(stack.Data()) >= 2 {
+		if t.storage[addr] == nil {
+			t.storage[addr] = make(map[string]string)
+		}
+		t.storage[addr][word(stack.Back(0))] = word(stack.Back(1))
+	}
+	l := StructLog{
+		Pc:      pc,
+		Op:      op.String(),
+		Gas:     gas,
+		GasCost: cost,
+		Depth:   depth,
+	}
+	if err != nil {
+		l.Error = err.Error()
+	}
+	if !t.cfg.DisableStack {
+		l.Stack = make([]string, len(stack.Data()))
+		for i, v := range stack.Data() {
+			l.Stack[i] = word(v)
+		}
+	}
+	if !t.cfg.DisableMemory {
+		data := memory.Data()
+		for i := 0; i+32 <= len(data); i += 32 {
+			l.Memory = append(l.Memory, fmt.Sprintf("%x", data[i:i+32]))
+		}
+	}
+	if !t.cfg.DisableStorage && len(t.storage[addr]) > 0 {
+		l.Storage = make(map[string]string, len(t.storage[addr]))
+		for k, v := range t.storage[addr] {
+			l.Storage[k] = v
+		}
+	}
+	t.logs = append(t.logs, l)
+
+	if len(t.frames) == 0 {
+		return nil
+	}
+	top := t.frames[len(t.frames)-1]
+	if err != nil {
+		top.Error = err.Error()
+		top.left = 0
+		return nil
+	}
+	if gas >= cost {
+		top.left = gas - cost
+	}
+	t.call(op, stack, memory, addr)
+	switch op {
+	case vm.RETURN, vm.REVERT:
+		top.Output = mem(memory, stack.Back(0), stack.Back(1))
+		if op == vm.REVERT {
+			top.Error = "execution reverted"
+		}
+	}
+	return nil
+}
+
+// call records the message call made by an instruction
+func (t *tracer) call(op vm.OpCode, stack *vm.Stack, memory *vm.Memory, from common.Address) {
+	f := &CallFrame{Type: op.String(), From: seth.Address(from)}
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		f.Value = (*seth.Int)(new(big.Int).Set(stack.Back(2)))
+		f.Input = mem(memory, stack.Back(3), stack.Back(4))
+	case vm.DELEGATECALL, vm.STATICCALL:
+		f.Input = mem(memory, stack.Back(2), stack.Back(3))
+	case vm.CREATE, vm.CREATE2:
+		f.Value = (*seth.Int)(new(big.Int).Set(stack.Back(0)))
+		f.Input = mem(memory, stack.Back(1), stack.Back(2))
+		t.pending = f
+		return
+	default:
+		return
+	}
+	f.To = seth.Address(common.BigToAddress(stack.Back(1)))
+	if g := stack.Back(0); g.IsUint64() {
+		f.Gas = seth.Uint64(g.Uint64())
+	}
+	t.pending = f
+}
+
+func (t *tracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	t.pending = nil
+	if op == vm.REVERT || len(t.frames) == 0 {
+		return nil
+	}
+	if n := len(t.logs); n > 0 {
+		t.logs[n-1].Error = err.Error()
+	}
+	top := t.frames[len(t.frames)-1]
+	top.Error = err.Error()
+	top.left = 0
+	return nil
+}
+
+func (t *tracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	for len(t.frames) > 1 {
+		t.exit(false)
+	}
+	root := t.frames[0]
+	root.Output = append(seth.Data(nil), output...)
+	if err != nil && root.Error == "" {
+		root.Error = err.Error()
+	}
+	return nil
+}
+
+// result produces the trace of a transaction that
+// used 'gas' and returned 'ret' and 'err'
+func (t *tracer) result(gas uint64, ret []byte, err error) *Trace {
+	tr := &Trace{
+		Gas:         gas,
+		Failed:      err != nil,
+		ReturnValue: fmt.Sprintf("%x", ret),
+		StructLogs:  t.logs,
+	}
+	if tr.StructLogs == nil {
+		tr.StructLogs = []StructLog{}
+	}
+	if len(t.frames) > 0 {
+		tr.Call = t.frames[0]
+		tr.Call.GasUsed = seth.Uint64(gas)
+	}
+	return tr
+}
+
+// TraceTransaction executes a transaction that has already
+// been mined again, and returns a trace of its execution.
+func (c *Chain) TraceTransaction(h *seth.Hash, cfg *TraceConfig) (*Trace, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.traceTransaction(h, cfg)
+}
+
+func (c *Chain) traceTransaction(h *seth.Hash, cfg *TraceConfig) (*Trace, error) {
+	tx, err := c.transaction(*h)
+	if err != nil {
+		return nil, err
+	}
+	snap, ok := c.tx2snap[*h]
+	if tx == nil || !ok {
+		return nil, fmt.Errorf("tevm: transaction %s not found", h.String())
+	}
+	rx, err := c.receipt(*h)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.pendingrx {
+		if c.pendingrx[i].Hash == *h {
+			rx = c.pendingrx[i]
+		}
+	}
+	if rx == nil {
+		return nil, fmt.Errorf("tevm: receipt for %s not found", h.String())
+	}
+	b, err := c.getBlock(&tx.Block, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// execute the transaction on a copy of the
+	// state and block just before it was mined
+	cc := &Chain{NoFees: c.NoFees}
+	c.State.atSnap(snap, &cc.State)
+	p := *b
+	p.GasUsed = rx.Cumulative - rx.GasUsed
+	p.Transactions = p.Transactions[:rx.Index:rx.Index]
+	cc.State.Pending = &p
+
+	t := newTracer(cfg)
+	ret, rx, err := cc.mine(tx, t.config())
+	if rx == nil {
+		return nil, err
+	}
+	tr := t.result(uint64(rx.GasUsed), ret, err)
+	if tr.Call != nil {
+		tr.Call.Gas = tx.Gas
+	}
+	return tr, nil
+}
+
+// TraceCall executes a call at the given block number
+// in the same manner as eth_call and returns a trace of
+// its execution. Any state changes are discarded.
+func (c *Chain) TraceCall(opts *seth.CallOpts, block int64, cfg *TraceConfig) (*Trace, error) {
+	a := new(callArgs)
+	if err := gross(opts, a); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.traceCall(a, block, cfg)
+}
+
+func (c *Chain) traceCall(a *callArgs, block int64, cfg *TraceConfig) (*Trace, error) {
+	c = c.AtBlock(block)
+	if c == nil {
+		return nil, fmt.Errorf("unknown block number %d", block)
+	}
+	t := newTracer(cfg)
+	evm := vm.NewEVM(c.context(a.From), c.State.StateDB(), &theparams, t.config())
+	evm.Context.GasPrice = a.GasPrice.Big()
+	snap := evm.StateDB.Snapshot()
+	defer evm.StateDB.RevertToSnapshot(snap)
+
+	gas := uint64(c.State.Pending.GasLimit)
+	if a.Gas != 0 {
+		gas = uint64(a.Gas)
+	}
+	var ret []byte
+	var left uint64
+	var err error
+	if a.To == nil {
+		ret, _, left, err = evm.Create(a.Ref(), a.Data, gas, a.Value.Big())
+	} else {
+		ret, left, err = evm.Call(a.Ref(), *a.To, a.Data, gas, a.Value.Big())
+	}
+	return t.result(gas-left, ret, err), nil
+}
@@ -0,0 +1,121 @@
+package tevm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/philhofer/seth"
+)
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	client := chain.Client()
+	me := chain.NewAccount(1)
+
+	// callee stores 1 in slot 0 and returns a zero word:
+	//   PUSH1 1 PUSH1 0 SSTORE PUSH1 32 PUSH1 0 RETURN
+	// caller calls the callee with all of its gas:
+	//   PUSH1 32 PUSH1 0 PUSH1 0 PUSH1 0 PUSH1 0
+	//   PUSH20 callee GAS CALL STOP
+	// reverter reverts:
+	//   PUSH1 0 PUSH1 0 REVERT
+	callee, caller, reverter := seth.Address{0xc1}, seth.Address{0xc2}, seth.Address{0xc3}
+	chain.SetCode(&callee, mustHex("600160005560206000f3"))
+	chain.SetCode(&caller, append(append(mustHex("6020600060006000600073"), callee[:]...), 0x5a, 0xf1, 0x00))
+	chain.SetCode(&reverter, mustHex("60006000fd"))
+
+	// calls don't modify the state
+	tr, err := chain.TraceCall(&seth.CallOpts{From: &me, To: &callee}, seth.Pending, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Failed || len(tr.StructLogs) != 6 || tr.ReturnValue != strings.Repeat("0", 64) {
+		t.Errorf("unexpected trace %+v", tr)
+	}
+	if l := tr.StructLogs[3]; l.Op != "PUSH1" || len(l.Storage) != 1 || len(l.Stack) != 0 {
+		t.Errorf("unexpected struct log %+v", l)
+	}
+	if v, err := client.StorageAt(&callee, &seth.Hash{}, seth.Pending); err != nil || v != (seth.Hash{}) {
+		t.Errorf("storage %x %v", v, err)
+	}
+	tr, err = chain.TraceCall(&seth.CallOpts{From: &me, To: &reverter}, seth.Pending, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Failed || tr.Call.Error != "execution reverted" {
+		t.Errorf("unexpected trace of revert %+v", tr.Call)
+	}
+
+	h, err := chain.Sender(&me).Call(&seth.CallOpts{To: &caller})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, err := client.GetReceipt(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = chain.TraceTransaction(&h, &TraceConfig{DisableMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Gas != uint64(rx.GasUsed) || tr.Failed {
+		t.Errorf("trace gas %d; receipt gas %d", tr.Gas, rx.GasUsed)
+	}
+	depth2 := 0
+	for _, l := range tr.StructLogs {
+		if l.Depth == 2 {
+			depth2++
+		}
+		if l.Memory != nil {
+			t.Fatal("memory was captured")
+		}
+	}
+	if depth2 != 6 {
+		t.Errorf("%d instructions at depth 2; want 6", depth2)
+	}
+	root := tr.Call
+	if root.Type != "CALL" || root.From != me || root.To != caller || root.GasUsed != rx.GasUsed || len(root.Calls) != 1 {
+		t.Fatalf("unexpected root call %+v", root)
+	}
+	if c := root.Calls[0]; c.Type != "CALL" || c.From != caller || c.To != callee ||
+		len(c.Output) != 32 || c.GasUsed == 0 || c.GasUsed > c.Gas || c.Error != "" {
+		t.Errorf("unexpected call %+v", c)
+	}
+
+	// the same traces are available through the transport
+	var frame CallFrame
+	err = client.Do("debug_traceTransaction", []json.RawMessage{js(&h), json.RawMessage(`{"tracer":"callTracer"}`)}, &frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.To != caller || len(frame.Calls) != 1 || frame.Calls[0].To != callee {
+		t.Errorf("unexpected call frame %+v", frame)
+	}
+	var res struct {
+		Gas        uint64
+		StructLogs []json.RawMessage
+	}
+	if err := client.Do("debug_traceTransaction", []json.RawMessage{js(&h)}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Gas != tr.Gas || len(res.StructLogs) != len(tr.StructLogs) {
+		t.Errorf("unexpected trace %+v", res)
+	}
+	for _, params := range [][]json.RawMessage{nil, {js(&h), json.RawMessage("{}"), json.RawMessage("{}")}} {
+		if err := client.Do("debug_traceTransaction", params, &res); err == nil {
+			t.Errorf("traced a transaction with %d params", len(params))
+		}
+	}
+	call := json.RawMessage(`{"from":"` + me.String() + `","to":"` + callee.String() + `"}`)
+	if err := client.Do("debug_traceCall", []json.RawMessage{call, json.RawMessage(`"pending"`)}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.StructLogs) != 6 {
+		t.Errorf("debug_traceCall returned %d struct logs", len(res.StructLogs))
+	}
+	if _, err := chain.TraceTransaction(&seth.Hash{1}, nil); err == nil {
+		t.Error("traced an unknown transaction")
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/philhofer/seth"
 )
 
@@ -22,10 +26,11 @@ type callArgs struct {
 	GasPrice seth.Int        `json:"gasPrice"`
 	Value    seth.Int        `json:"value"`
 	Data     seth.Data       `json:"data"`
+	Nonce    *seth.Uint64    `json:"nonce"`
 }
 
 func (c *callArgs) tx() *seth.Transaction {
-	return &seth.Transaction{
+	tx := &seth.Transaction{
 		From:     (*seth.Address)(&c.From),
 		To:       (*seth.Address)(c.To),
 		Gas:      c.Gas,
@@ -33,6 +38,10 @@ func (c *callArgs) tx() *seth.Transaction {
 		Value:    c.Value,
 		Input:    c.Data,
 	}
+	if c.Nonce != nil {
+		tx.Nonce = *c.Nonce
+	}
+	return tx
 }
 
 type blocknum int64
@@ -50,7 +59,16 @@ func (b *blocknum) UnmarshalJSON(buf []byte) error {
 	case bytes.Equal(rawearliest, buf):
 		*b = 0
 	default:
-		// should be an integer
+		// should be a hex-encoded quantity
+		// (but accept a plain integer, too)
+		if len(buf) >= 2 && buf[0] == '"' {
+			var n seth.Uint64
+			if err := n.UnmarshalJSON(buf); err != nil {
+				return err
+			}
+			*b = blocknum(n)
+			return nil
+		}
 		i, err := strconv.ParseInt(string(buf), 10, 64)
 		if err != nil {
 			return err
@@ -60,6 +78,97 @@ func (b *blocknum) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+// addrlist is a filter address parameter,
+// which is either a single address or a list
+type addrlist []seth.Address
+
+func (a *addrlist) UnmarshalJSON(buf []byte) error {
+	if len(buf) > 0 && buf[0] == '[' {
+		return json.Unmarshal(buf, (*[]seth.Address)(a))
+	}
+	var addr seth.Address
+	if err := json.Unmarshal(buf, &addr); err != nil {
+		return err
+	}
+	*a = addrlist{addr}
+	return nil
+}
+
+// topicset is one position in a filter topic
+// parameter: null, a single topic, or a list
+// of alternatives
+type topicset []seth.Hash
+
+func (t *topicset) UnmarshalJSON(buf []byte) error {
+	switch {
+	case bytes.Equal(buf, []byte("null")):
+		*t = nil
+		return nil
+	case len(buf) > 0 && buf[0] == '[':
+		return json.Unmarshal(buf, (*[]seth.Hash)(t))
+	}
+	var h seth.Hash
+	if err := json.Unmarshal(buf, &h); err != nil {
+		return err
+	}
+	*t = topicset{h}
+	return nil
+}
+
+// filterReq is the parameter to
+// eth_newFilter and eth_getLogs
+type filterReq struct {
+	FromBlock blocknum   `json:"fromBlock"`
+	ToBlock   blocknum   `json:"toBlock"`
+	Address   addrlist   `json:"address"`
+	Topics    []topicset `json:"topics"`
+	BlockHash *seth.Hash `json:"blockHash"`
+}
+
+// parseFilter parses the parameter to eth_newFilter or
+// eth_getLogs and resolves block tags to block numbers.
+// If open is set, a tag in toBlock leaves the range
+// open-ended, so that the filter keeps matching new blocks.
+func (c *Chain) parseFilter(params []json.RawMessage, open bool) (*filter, error) {
+	// omitted block numbers mean "latest"
+	req := &filterReq{FromBlock: -2, ToBlock: -2}
+	if len(params) != 1 {
+		return nil, fmt.Errorf("expected 1 param; found %d", len(params))
+	}
+	if err := json.Unmarshal(params[0], req); err != nil {
+		return nil, err
+	}
+	if req.BlockHash != nil {
+		b, err := c.getBlock(req.BlockHash, false)
+		if err != nil {
+			return nil, err
+		}
+		if b.Number == nil {
+			return nil, fmt.Errorf("block %s not mined", req.BlockHash)
+		}
+		req.FromBlock = blocknum(*b.Number)
+		req.ToBlock = req.FromBlock
+	}
+	req.FromBlock = c.resolve(req.FromBlock)
+	if req.ToBlock >= 0 || !open {
+		req.ToBlock = c.resolve(req.ToBlock)
+	} else {
+		req.ToBlock = -1
+	}
+	if req.ToBlock >= 0 && req.FromBlock > req.ToBlock {
+		return nil, fmt.Errorf("cannot filter block range [%d,%d]", req.FromBlock, req.ToBlock)
+	}
+	f := &filter{
+		from:  req.FromBlock,
+		to:    req.ToBlock,
+		addrs: req.Address,
+	}
+	for i := range req.Topics {
+		f.topics = append(f.topics, req.Topics[i])
+	}
+	return f, nil
+}
+
 func (a *callArgs) Ref() vm.ContractRef {
 	return (*acctref)(&a.From)
 }
@@ -101,6 +210,11 @@ func (c *Chain) Execute(req *seth.RPCRequest, res *seth.RPCResponse) error {
 		res.Error.Code = -32601
 		res.Error.Message = err.Error()
 		res.Error.Data = nil
+		if re, ok := err.(*RevertError); ok {
+			// the stack is in the data
+			res.Error.Message = re.message()
+			res.Error.Data = re.errdata()
+		}
 		err = nil
 	} else {
 		err = gross(ret, &res.Result)
@@ -146,6 +260,13 @@ func (c *Chain) execute(method string, params []json.RawMessage) (interface{}, e
 		if err := marshal(params, a); err != nil {
 			return nil, err
 		}
+		if from := seth.Address(a.From); !c.canSend(&from) {
+			return nil, fmt.Errorf("tevm: unknown account %s", from.String())
+		}
+		if a.Nonce == nil {
+			n := seth.Uint64((*gethState)(&c.State).GetNonce(a.From))
+			a.Nonce = &n
+		}
 		return c.send(a.tx())
 	case "eth_getTransactionReceipt":
 		var h seth.Hash
@@ -177,28 +298,253 @@ func (c *Chain) execute(method string, params []json.RawMessage) (interface{}, e
 		if err := marshal(params, &h, &all); err != nil {
 			return nil, err
 		}
-		return c.getBlock(&h, all)
+		return c.lookupBlock(&h, all)
 	case "eth_getBlockByNumber":
-		var n seth.Int
 		var all bool
-		if err := marshal(params, &n, &all); err != nil {
+		if err := marshal(params, &b, &all); err != nil {
+			return nil, err
+		}
+		return c.lookupBlock(c.blockHash(b), all)
+	case "eth_getBlockTransactionCountByHash":
+		var h seth.Hash
+		if err := marshal(params, &h); err != nil {
+			return nil, err
+		}
+		return c.txCount(&h)
+	case "eth_getBlockTransactionCountByNumber":
+		if err := marshal(params, &b); err != nil {
+			return nil, err
+		}
+		return c.txCount(c.blockHash(b))
+	case "eth_getTransactionByBlockHashAndIndex":
+		var h seth.Hash
+		var i seth.Uint64
+		if err := marshal(params, &h, &i); err != nil {
+			return nil, err
+		}
+		return c.txByIndex(&h, int(i))
+	case "eth_getTransactionByBlockNumberAndIndex":
+		var i seth.Uint64
+		if err := marshal(params, &b, &i); err != nil {
+			return nil, err
+		}
+		return c.txByIndex(c.blockHash(b), int(i))
+	case "eth_getBlockReceipts":
+		if err := marshal(params, &b); err != nil {
+			return nil, err
+		}
+		return c.blockReceipts(c.blockHash(b))
+	case "eth_getUncleCountByBlockHash", "eth_getUncleCountByBlockNumber":
+		// there are never any uncles
+		return seth.Uint64(0), nil
+	case "eth_getUncleByBlockHashAndIndex", "eth_getUncleByBlockNumberAndIndex":
+		return nil, nil
+	case "eth_getCode":
+		var addr seth.Address
+		if err := marshal(params, &addr, &b); err != nil {
+			return nil, err
+		}
+		return c.code(&addr, int64(b))
+	case "eth_getStorageAt":
+		var addr seth.Address
+		var pos seth.Int
+		if err := marshal(params, &addr, &pos, &b); err != nil {
+			return nil, err
+		}
+		return c.storageAt(&addr, &pos, int64(b))
+	case "eth_getTransactionCount":
+		var addr seth.Address
+		if err := marshal(params, &addr, &b); err != nil {
+			return nil, err
+		}
+		return c.nonce(&addr, int64(b))
+	case "eth_sendRawTransaction":
+		var raw seth.Data
+		if err := marshal(params, &raw); err != nil {
+			return nil, err
+		}
+		return c.sendRaw(raw)
+	case "eth_chainId":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return seth.Uint64(theparams.ChainID.Uint64()), nil
+	case "net_version":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return theparams.ChainID.String(), nil
+	case "net_listening":
+		return true, nil
+	case "net_peerCount":
+		return seth.Uint64(0), nil
+	case "web3_clientVersion":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return "tevm/" + runtime.Version(), nil
+	case "web3_sha3":
+		var data seth.Data
+		if err := marshal(params, &data); err != nil {
+			return nil, err
+		}
+		return seth.HashBytes(data), nil
+	case "eth_accounts":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return append([]seth.Address{}, c.accounts...), nil
+	case "eth_coinbase":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return c.State.Pending.Miner, nil
+	case "eth_mining":
+		return !c.manual || c.interval > 0, nil
+	case "eth_hashrate":
+		return seth.Uint64(0), nil
+	case "evm_mine":
+		// the timestamp of the block is optional
+		if len(params) > 0 {
+			var ts seth.Uint64
+			if err := marshal(params, &ts); err != nil {
+				return nil, err
+			}
+			if err := c.setNextBlockTimestamp(int64(ts)); err != nil {
+				return nil, err
+			}
+		}
+		c.Seal()
+		return "0x0", nil
+	case "evm_increaseTime":
+		var sec seth.Uint64
+		if err := marshal(params, &sec); err != nil {
+			return nil, err
+		}
+		return int64(c.increaseTime(int64(sec)) / time.Second), nil
+	case "evm_setNextBlockTimestamp":
+		var ts seth.Uint64
+		if err := marshal(params, &ts); err != nil {
+			return nil, err
+		}
+		if err := c.setNextBlockTimestamp(int64(ts)); err != nil {
+			return nil, err
+		}
+		return ts, nil
+	case "evm_setAutomine":
+		var on bool
+		if err := marshal(params, &on); err != nil {
+			return nil, err
+		}
+		c.manual = !on
+		return true, nil
+	case "evm_snapshot":
+		if err := marshal(params); err != nil {
+			return nil, err
+		}
+		return seth.Uint64(c.checkpoint()), nil
+	case "evm_revert":
+		var id seth.Uint64
+		if err := marshal(params, &id); err != nil {
+			return nil, err
+		}
+		return c.revert(int(id)), nil
+	case "hardhat_impersonateAccount":
+		var addr seth.Address
+		if err := marshal(params, &addr); err != nil {
+			return nil, err
+		}
+		c.impersonate(&addr)
+		return true, nil
+	case "hardhat_stopImpersonatingAccount":
+		var addr seth.Address
+		if err := marshal(params, &addr); err != nil {
+			return nil, err
+		}
+		return c.stopImpersonating(&addr), nil
+	case "hardhat_setBalance":
+		var addr seth.Address
+		var v seth.Int
+		if err := marshal(params, &addr, &v); err != nil {
+			return nil, err
+		}
+		c.setBalance(&addr, v.Big())
+		return true, nil
+	case "hardhat_setCode":
+		var addr seth.Address
+		var code seth.Data
+		if err := marshal(params, &addr, &code); err != nil {
+			return nil, err
+		}
+		c.setCode(&addr, code)
+		return true, nil
+	case "hardhat_setStorageAt":
+		var addr seth.Address
+		var pos seth.Int
+		var v seth.Hash
+		if err := marshal(params, &addr, &pos, &v); err != nil {
+			return nil, err
+		}
+		key, err := storageKey(&pos)
+		if err != nil {
+			return nil, err
+		}
+		c.setStorageAt(&addr, key, &v)
+		return true, nil
+	case "hardhat_setNonce":
+		var addr seth.Address
+		var n seth.Uint64
+		if err := marshal(params, &addr, &n); err != nil {
+			return nil, err
+		}
+		c.setNonce(&addr, uint64(n))
+		return true, nil
+	case "debug_traceTransaction":
+		var h seth.Hash
+		cfg := new(TraceConfig)
+		if len(params) < 1 || len(params) > 2 {
+			return nil, fmt.Errorf("expected a transaction hash and optional trace config; got %d params", len(params))
+		}
+		args := []interface{}{&h, cfg}
+		if err := marshal(params, args[:len(params)]...); err != nil {
+			return nil, fmt.Errorf("expected a transaction hash and optional trace config: %v", err)
+		}
+		if err := cfg.check(); err != nil {
+			return nil, err
+		}
+		tr, err := c.traceTransaction(&h, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.result(tr), nil
+	case "debug_traceCall":
+		a := new(callArgs)
+		cfg := new(TraceConfig)
+		if err := marshal(params, a, &b, cfg); err != nil {
+			if err := marshal(params, a, &b); err != nil {
+				return nil, err
+			}
+		}
+		if err := cfg.check(); err != nil {
 			return nil, err
 		}
-		// hack: block hashes are hashes of the block number
-		h := seth.Hash(n2h(uint64(n.Int64())))
-		return c.getBlock(&h, all)
+		tr, err := c.traceCall(a, int64(b), cfg)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.result(tr), nil
 	case "eth_newFilter":
-		type newFilterReq struct {
-			FromBlock blocknum      `json:"fromBlock,omitempty"`
-			ToBlock   blocknum      `json:"toBlock,omitempty"`
-			Address   *seth.Address `json:"address,omitempty"`
-			Topics    []*seth.Hash  `json:"topics,omitempty"`
+		f, err := c.parseFilter(params, true)
+		if err != nil {
+			return nil, err
 		}
-		req := new(newFilterReq)
-		if err := marshal(params, req); err != nil {
+		return c.newFilter(f), nil
+	case "eth_getLogs":
+		f, err := c.parseFilter(params, false)
+		if err != nil {
 			return nil, err
 		}
-		return c.newFilter(req.FromBlock, req.ToBlock, req.Address, req.Topics)
+		return c.logs(f), nil
 	case "eth_getFilterChanges":
 		var n seth.Int
 		if err := marshal(params, &n); err != nil {
@@ -222,21 +568,26 @@ func (c *Chain) execute(method string, params []json.RawMessage) (interface{}, e
 	}
 }
 
-func (c *Chain) newFilter(from, to blocknum, addr *seth.Address, topics []*seth.Hash) (int, error) {
-	if from > to {
-		return 0, fmt.Errorf("cannot filter block range [%d,%d)", from, to)
-	}
+func (c *Chain) newFilter(f *filter) int {
 	c.filtcount++
 	if c.filters == nil {
 		c.filters = make(map[int]*filter)
 	}
-	c.filters[c.filtcount] = &filter{
-		from:   from,
-		to:     to,
-		addr:   addr,
-		topics: topics,
+	c.filters[c.filtcount] = f
+	return c.filtcount
+}
+
+// logs returns every log that matches the filter
+func (c *Chain) logs(filt *filter) []seth.Log {
+	out := make([]seth.Log, 0)
+	for i := range c.State.Logs {
+		if filt.matches(c.State.Logs[i]) {
+			var next seth.Log
+			l2l(c.State.Logs[i], &next)
+			out = append(out, next)
+		}
 	}
-	return c.filtcount, nil
+	return out
 }
 
 func (c *Chain) filterLogs(fd int) ([]seth.Log, error) {
@@ -249,16 +600,7 @@ func (c *Chain) filterLogs(fd int) ([]seth.Log, error) {
 	if !ok {
 		return nil, fmt.Errorf("bad filter id %d", fd)
 	}
-
-	out := make([]seth.Log, 0)
-	for i := range c.State.Logs {
-		if filt.matches(c.State.Logs[i]) {
-			var next seth.Log
-			l2l(c.State.Logs[i], &next)
-			out = append(out, next)
-		}
-	}
-	return out, nil
+	return c.logs(filt), nil
 }
 
 func (c *Chain) filterChanges(fd int) ([]seth.Log, error) {
@@ -295,7 +637,8 @@ func (c *Chain) staticCall(a *callArgs, blocknum int64) (seth.Data, error) {
 	if c == nil {
 		return nil, fmt.Errorf("unknown block number %d", blocknum)
 	}
-	evm := c.evm(a.From)
+	s := c.stacker()
+	evm := c.tracedEVM(a.From, s)
 	gas := uint64(c.State.Pending.GasLimit)
 	if a.Gas != 0 {
 		gas = uint64(a.Gas)
@@ -306,7 +649,7 @@ func (c *Chain) staticCall(a *callArgs, blocknum int64) (seth.Data, error) {
 	}
 	ret, _, err := evm.StaticCall(a.Ref(), to, a.Data, gas)
 	if err != nil {
-		return nil, err
+		return nil, s.wrap(err, ret)
 	}
 	return seth.Data(ret), nil
 }
@@ -352,14 +695,176 @@ func (c *Chain) getBlock(h *seth.Hash, fulltx bool) (*seth.Block, error) {
 	return b, nil
 }
 
+// resolve returns the block number that n refers
+// to, which may be "latest" (-2) or "pending" (-1)
+func (c *Chain) resolve(n blocknum) blocknum {
+	pending := blocknum(*c.State.Pending.Number)
+	switch n {
+	case -1:
+		n = pending
+	case -2:
+		// the latest block is the pending
+		// block if nothing has been sealed
+		n = pending
+		if _, ok := c.block2snap[int64(pending-1)]; ok {
+			n = pending - 1
+		}
+	}
+	return n
+}
+
+// blockHash returns the hash of the block with the given
+// number, which may be "latest" (-2) or "pending" (-1)
+func (c *Chain) blockHash(n blocknum) *seth.Hash {
+	// block hashes are hashes of the block number
+	h := seth.Hash(n2h(uint64(c.resolve(n))))
+	return &h
+}
+
+// lookupBlock is like getBlock, but it
+// returns nil if the block does not exist
+func (c *Chain) lookupBlock(h *seth.Hash, fulltx bool) (*seth.Block, error) {
+	if *h != *c.State.Pending.Hash && c.State.Blocks.Get(h[:]) == nil {
+		return nil, nil
+	}
+	return c.getBlock(h, fulltx)
+}
+
+// txCount handles eth_getBlockTransactionCountBy*.
+func (c *Chain) txCount(h *seth.Hash) (*seth.Uint64, error) {
+	b, err := c.lookupBlock(h, false)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	n := seth.Uint64(len(b.Transactions))
+	return &n, nil
+}
+
+// txByIndex handles eth_getTransactionByBlock*AndIndex.
+func (c *Chain) txByIndex(h *seth.Hash, i int) (*seth.Transaction, error) {
+	b, err := c.lookupBlock(h, false)
+	if b == nil || err != nil || i >= len(b.Transactions) {
+		return nil, err
+	}
+	var txh seth.Hash
+	if err := json.Unmarshal(b.Transactions[i], &txh); err != nil {
+		return nil, fmt.Errorf("internal error: malformed tx %q", b.Transactions[i])
+	}
+	return c.transaction(txh)
+}
+
+// blockReceipts handles eth_getBlockReceipts.
+func (c *Chain) blockReceipts(h *seth.Hash) ([]seth.Receipt, error) {
+	b, err := c.lookupBlock(h, false)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	out := make([]seth.Receipt, 0, len(b.Transactions))
+	if b == c.State.Pending {
+		for _, rx := range c.pendingrx {
+			out = append(out, *rx)
+		}
+		return out, nil
+	}
+	for i := range b.Transactions {
+		var txh seth.Hash
+		if err := json.Unmarshal(b.Transactions[i], &txh); err != nil {
+			return nil, fmt.Errorf("internal error: malformed tx %q", b.Transactions[i])
+		}
+		rx, err := c.receipt(txh)
+		if err != nil {
+			return nil, err
+		}
+		if rx == nil {
+			return nil, fmt.Errorf("internal error: no receipt for tx %s", txh.String())
+		}
+		out = append(out, *rx)
+	}
+	return out, nil
+}
+
+// code handles eth_getCode.
+func (c *Chain) code(addr *seth.Address, block int64) (seth.Data, error) {
+	c = c.AtBlock(block)
+	if c == nil {
+		return nil, fmt.Errorf("unknown block number %d", block)
+	}
+	return seth.Data((*gethState)(&c.State).getCode(addr)), nil
+}
+
+// storageKey converts a storage position to a key
+func storageKey(pos *seth.Int) (*seth.Hash, error) {
+	buf := pos.Big().Bytes()
+	if len(buf) > 32 {
+		return nil, fmt.Errorf("storage position %s out of range", pos.Big())
+	}
+	key := new(seth.Hash)
+	copy(key[32-len(buf):], buf)
+	return key, nil
+}
+
+// storageAt handles eth_getStorageAt.
+func (c *Chain) storageAt(addr *seth.Address, pos *seth.Int, block int64) (*seth.Hash, error) {
+	c = c.AtBlock(block)
+	if c == nil {
+		return nil, fmt.Errorf("unknown block number %d", block)
+	}
+	key, err := storageKey(pos)
+	if err != nil {
+		return nil, err
+	}
+	out := seth.Hash((*gethState)(&c.State).GetState(common.Address(*addr), common.Hash(*key)))
+	return &out, nil
+}
+
+// nonce handles eth_getTransactionCount.
+func (c *Chain) nonce(addr *seth.Address, block int64) (seth.Uint64, error) {
+	c = c.AtBlock(block)
+	if c == nil {
+		return 0, fmt.Errorf("unknown block number %d", block)
+	}
+	return seth.Uint64((*gethState)(&c.State).GetNonce(common.Address(*addr))), nil
+}
+
+// sendRaw handles eth_sendRawTransaction. Transactions
+// signed for any chain ID are accepted, so that tooling
+// configured for the chain that a fork is based on can
+// send transactions to the fork.
+func (c *Chain) sendRaw(raw []byte) (*seth.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return nil, err
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	stx := &seth.Transaction{
+		Hash:  seth.Hash(tx.Hash()),
+		Nonce: seth.Uint64(tx.Nonce()),
+		From:  (*seth.Address)(&from),
+		To:    (*seth.Address)(tx.To()),
+		Gas:   seth.Uint64(tx.Gas()),
+		Input: seth.Data(tx.Data()),
+	}
+	stx.Value = seth.Int(*tx.Value())
+	stx.GasPrice = seth.Int(*tx.GasPrice())
+	return c.send(stx)
+}
+
 // send handles eth_sendTransaction
 func (c *Chain) send(a *seth.Transaction) (*seth.Hash, error) {
 	_, h, err := c.Mine(a)
 	if err != nil {
 		return nil, err
 	}
-	// For now, 1 tx per block.
-	c.Seal()
+	if !c.manual {
+		c.Seal()
+	}
 	return &h, nil
 }
 
@@ -367,7 +872,7 @@ func (c *Chain) send(a *seth.Transaction) (*seth.Hash, error) {
 func (c *Chain) receipt(h seth.Hash) (*seth.Receipt, error) {
 	b := c.State.Receipts.Get(h[:])
 	if b == nil {
-		return nil, fmt.Errorf("receipt %s not found", h.String())
+		return nil, nil
 	}
 	r := new(seth.Receipt)
 	_, err := r.UnmarshalMsg(b)
@@ -381,7 +886,7 @@ func (c *Chain) receipt(h seth.Hash) (*seth.Receipt, error) {
 func (c *Chain) transaction(h seth.Hash) (*seth.Transaction, error) {
 	b := c.State.Transactions.Get(h[:])
 	if b == nil {
-		return nil, fmt.Errorf("no such transaction %s", h.String())
+		return nil, nil
 	}
 	tx := new(seth.Transaction)
 	_, err := tx.UnmarshalMsg(b)
@@ -433,7 +938,9 @@ func (c *Chain) estimate(a *callArgs, blocknum int64) (seth.Uint64, error) {
 
 	evm.StateDB.RevertToSnapshot(snap)
 
-	return seth.Uint64(gas), nil
+	// the estimate includes the intrinsic gas
+	// that Mine charges before execution
+	return seth.Uint64(gas + intrinsic(a.Data, a.To == nil)), nil
 }
 
 func marshal(from []json.RawMessage, to ...interface{}) error {
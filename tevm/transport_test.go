@@ -0,0 +1,355 @@
+package tevm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/philhofer/seth"
+)
+
+// TestTransportMethods tests the standard RPCs
+// used by wallets and other tooling.
+func TestTransportMethods(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	client := chain.Client()
+	acct := chain.NewAccount(1)
+
+	if id, err := client.ChainID(); err != nil || id != 5 {
+		t.Errorf("chain id %d %v", id, err)
+	}
+	if v, err := client.NetVersion(); err != nil || v != "5" {
+		t.Errorf("net version %q %v", v, err)
+	}
+	if v, err := client.ClientVersion(); err != nil || !strings.HasPrefix(v, "tevm/") {
+		t.Errorf("client version %q %v", v, err)
+	}
+	if accts, err := client.Accounts(); err != nil || len(accts) != 1 || accts[0] != acct {
+		t.Errorf("accounts %v %v", accts, err)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := seth.Address(crypto.PubkeyToAddress(key.PublicKey))
+	chain.AddBalance(&from, big.NewInt(1e18))
+
+	// transactions signed for mainnet are accepted
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	send := func(tx *types.Transaction) (seth.Hash, error) {
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := client.RawCall(raw)
+		if err == nil && h != seth.Hash(tx.Hash()) {
+			t.Fatalf("got hash %s; want %s", h.String(), tx.Hash().String())
+		}
+		return h, err
+	}
+
+	// the constructor stores 42 in slot 0, and the
+	// runtime code emits a log with two topics
+	runtime := seth.Data(mustHex("60203560003560006000a200"))
+	init := append(mustHex("602a600055600c6011600039600c6000f3"), runtime...)
+	h, err := send(types.NewContractCreation(0, new(big.Int), 100000, new(big.Int), init))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, err := client.GetReceipt(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx.Threw() || rx.Address == nil {
+		t.Fatalf("unexpected receipt %+v", rx)
+	}
+	if tx, err := client.GetTransaction(&h); err != nil || *tx.From != from || tx.Nonce != 0 {
+		t.Fatalf("unexpected transaction %+v %v", tx, err)
+	}
+	if code, err := client.GetCode(rx.Address); err != nil || !bytes.Equal(code, runtime) {
+		t.Errorf("code %x %v", code, err)
+	}
+	if v, err := client.StorageAt(rx.Address, &seth.Hash{}, seth.Latest); err != nil || v[31] != 42 {
+		t.Errorf("storage %x %v", v, err)
+	}
+
+	// calls increment the nonce, too
+	if _, err := send(types.NewTransaction(1, common.Address(*rx.Address), new(big.Int), 100000, new(big.Int), nil)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.GetNonce(&from); err != nil || n != 2 {
+		t.Errorf("nonce %d %v", n, err)
+	}
+	if _, err := send(types.NewTransaction(1, common.Address(*rx.Address), new(big.Int), 100000, new(big.Int), nil)); err == nil {
+		t.Error("expected a reused nonce to be rejected")
+	}
+
+	n := int64(rx.BlockNumber)
+	if b, err := client.GetBlock(n, false); err != nil || *b.Hash != rx.BlockHash {
+		t.Errorf("block %d: %v", n, err)
+	}
+	if b, err := client.Latest(false); err != nil || int64(*b.Number) != n+1 {
+		t.Errorf("latest block: %v", err)
+	}
+	if _, err := client.GetBlock(n+100, false); err != seth.ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+	if _, err := client.GetReceipt(&seth.Hash{1}); err != seth.ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+	if c, err := client.GetBlockTransactionCount(n); err != nil || c != 1 {
+		t.Errorf("tx count %d %v", c, err)
+	}
+	if tx, err := client.GetTransactionByIndex(n, 0); err != nil || tx.Hash != h {
+		t.Errorf("tx by index %v %v", tx, err)
+	}
+	if rxs, err := client.GetBlockReceipts(n); err != nil || len(rxs) != 1 || rxs[0].Hash != h {
+		t.Errorf("block receipts %v %v", rxs, err)
+	}
+}
+
+// TestMiningModes tests manual and interval
+// mining and the evm_* time control RPCs.
+func TestMiningModes(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	client := chain.Client()
+	acct := chain.NewAccount(1)
+	sender := chain.Sender(&acct)
+	do := func(method string, out interface{}, params ...string) error {
+		raw := make([]json.RawMessage, len(params))
+		for i := range params {
+			raw[i] = json.RawMessage(params[i])
+		}
+		if out == nil {
+			out = new(json.RawMessage)
+		}
+		return client.Do(method, raw, out)
+	}
+
+	// with automine off, transactions share a block
+	if err := do("evm_setAutomine", nil, "false"); err != nil {
+		t.Fatal(err)
+	}
+	var hashes []seth.Hash
+	for i := 0; i < 2; i++ {
+		h, err := sender.Call(&seth.CallOpts{To: &seth.Address{0xaa}, Value: seth.NewInt(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetReceipt(&h); err != seth.ErrNotFound {
+			t.Fatalf("expected an unmined transaction; got %v", err)
+		}
+		hashes = append(hashes, h)
+	}
+	n, err := client.BlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := do("evm_mine", nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := range hashes {
+		rx, err := client.GetReceipt(&hashes[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(rx.BlockNumber) != n || int(rx.Index) != i {
+			t.Errorf("tx %d mined in block %d at index %d", i, rx.BlockNumber, rx.Index)
+		}
+	}
+
+	// the clock can be moved forward, but not back
+	latest, err := client.Latest(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := int64(latest.Timestamp)
+	if err := do("evm_setNextBlockTimestamp", nil, strconv.FormatInt(start, 10)); err == nil {
+		t.Error("expected an error setting a timestamp in the past")
+	}
+	if err := do("evm_mine", nil, strconv.FormatInt(start+1000, 10)); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	if err := do("evm_increaseTime", &total, "60"); err != nil {
+		t.Fatal(err)
+	}
+	if err := do("evm_setNextBlockTimestamp", nil, strconv.FormatInt(start+2000, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.SetNextBlockTimestamp(time.Unix(start+5000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	chain.IncreaseTime(time.Hour)
+	if err := do("evm_mine", nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int64{start + 1000, start + 5000 + 3600} {
+		b, err := client.GetBlock(n+1+int64(i), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(b.Timestamp) != want {
+			t.Errorf("block %d has timestamp %d; want %d", *b.Number, b.Timestamp, want)
+		}
+	}
+	if b := chain.State.Pending; int64(b.Timestamp) <= start+5000+3600 {
+		t.Errorf("pending timestamp %d went backwards", b.Timestamp)
+	}
+
+	// a block is timestamped when it is sealed, not when
+	// the previous block was sealed (the clock is moved
+	// directly to simulate waiting to seal the block)
+	chain.mu.Lock()
+	chain.offset += 100
+	pending := int64(chain.State.Pending.Timestamp)
+	chain.mu.Unlock()
+	if err := do("evm_mine", nil); err != nil {
+		t.Fatal(err)
+	}
+	if latest, err = client.Latest(false); err != nil {
+		t.Fatal(err)
+	} else if int64(latest.Timestamp) < pending+90 {
+		t.Errorf("block sealed with stale timestamp %d (pending block had %d)", latest.Timestamp, pending)
+	}
+
+	// interval mining seals blocks in the background
+	var mining bool
+	if err := do("eth_mining", &mining); err != nil || mining {
+		t.Errorf("eth_mining returned %v %v", mining, err)
+	}
+	chain.SetMiningInterval(time.Millisecond)
+	defer chain.SetMiningInterval(0)
+	n, err = client.BlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cur, err := client.BlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cur > n+2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no blocks were mined")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestImpersonation tests the hardhat_* RPCs
+// that impersonate accounts and modify state.
+func TestImpersonation(t *testing.T) {
+	t.Parallel()
+	chain := NewChain()
+	client := chain.Client()
+	whale := seth.Address{0x77}
+	do := func(method string, params ...string) {
+		t.Helper()
+		raw := make([]json.RawMessage, len(params))
+		for i := range params {
+			raw[i] = json.RawMessage(params[i])
+		}
+		var ok bool
+		if err := client.Do(method, raw, &ok); err != nil || !ok {
+			t.Fatalf("%s returned %v %v", method, ok, err)
+		}
+	}
+	addr := string(js(&whale))
+	pay := func() error {
+		_, err := chain.Sender(&whale).Call(&seth.CallOpts{To: &seth.Address{0xaa}, Value: seth.NewInt(1)})
+		return err
+	}
+
+	if err := pay(); err == nil {
+		t.Fatal("sent a transaction from an unknown account")
+	}
+	do("hardhat_setBalance", addr, `"0xde0b6b3a7640000"`)
+	if b := chain.BalanceOf(&whale); b.Int64() != 1e18 {
+		t.Errorf("balance %s", b)
+	}
+	do("hardhat_impersonateAccount", addr)
+	if err := pay(); err != nil {
+		t.Fatal(err)
+	}
+	do("hardhat_stopImpersonatingAccount", addr)
+	if err := pay(); err == nil {
+		t.Fatal("sent a transaction after impersonation stopped")
+	}
+	chain.Impersonate(&whale)
+	if err := pay(); err != nil {
+		t.Fatal(err)
+	}
+	// copies keep impersonating independently
+	cp := chain.Copy()
+	chain.StopImpersonating(&whale)
+	if !cp.canSend(&whale) || chain.canSend(&whale) {
+		t.Error("impersonation was not copied")
+	}
+
+	// state is modified in the pending block
+	// PUSH1 0 SLOAD PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := mustHex("60005460005260206000f3")
+	contract := seth.Address{0xcc}
+	do("hardhat_setCode", string(js(&contract)), string(js(seth.Data(code))))
+	do("hardhat_setStorageAt", string(js(&contract)), `"0x0"`, string(js(seth.Hash{31: 42})))
+	do("hardhat_setNonce", addr, `"0x10"`)
+	if c, err := client.GetCodeAt(&contract, seth.Pending); err != nil || !bytes.Equal(c, code) {
+		t.Errorf("code %x %v", c, err)
+	}
+	var ret seth.Data
+	call := json.RawMessage(`{"to":"` + contract.String() + `"}`)
+	if err := client.Do("eth_call", []json.RawMessage{call, json.RawMessage(`"pending"`)}, &ret); err != nil || len(ret) != 32 || ret[31] != 42 {
+		t.Errorf("eth_call returned %x %v", ret, err)
+	}
+	if v, err := client.StorageAt(&contract, &seth.Hash{}, seth.Pending); err != nil || v[31] != 42 {
+		t.Errorf("storage %x %v", v, err)
+	}
+	if n, err := client.GetNonceAt(&whale, seth.Pending); err != nil || n != 16 {
+		t.Errorf("nonce %d %v", n, err)
+	}
+
+	chain.SetBalance(&whale, big.NewInt(5))
+	chain.SetNonce(&whale, 3)
+	chain.SetStorageAt(&contract, &seth.Hash{}, &seth.Hash{31: 7})
+	chain.SetCode(&contract, code[:1])
+	if b := chain.BalanceOf(&whale); b.Int64() != 5 {
+		t.Errorf("balance %s", b)
+	}
+	if n, err := client.GetNonceAt(&whale, seth.Pending); err != nil || n != 3 {
+		t.Errorf("nonce %d %v", n, err)
+	}
+	if v, err := client.StorageAt(&contract, &seth.Hash{}, seth.Pending); err != nil || v[31] != 7 {
+		t.Errorf("storage %x %v", v, err)
+	}
+	if c, err := client.GetCodeAt(&contract, seth.Pending); err != nil || len(c) != 1 {
+		t.Errorf("code %x %v", c, err)
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,294 @@
+package seth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// CallFrame is one call in a call tree,
+// as produced by the geth callTracer.
+type CallFrame struct {
+	Type    string      `json:"type"` // CALL, STATICCALL, DELEGATECALL, CALLCODE, CREATE, CREATE2, or SELFDESTRUCT
+	From    Address     `json:"from"`
+	To      *Address    `json:"to,omitempty"`    // callee, or created contract
+	Value   *Int        `json:"value,omitempty"` // value transferred, or nil for calls that cannot transfer value
+	Gas     Uint64      `json:"gas"`
+	GasUsed Uint64      `json:"gasUsed"`
+	Input   Data        `json:"input"`
+	Output  Data        `json:"output,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Calls   []CallFrame `json:"calls,omitempty"` // sub-calls, in order
+}
+
+// Failed returns whether or not the call reverted or threw.
+func (f *CallFrame) Failed() bool { return f.Error != "" }
+
+// Walk calls fn on f and each of its sub-calls,
+// depth-first, in execution order. The root frame
+// has depth 0. If fn returns false, the sub-calls
+// of that frame are skipped.
+func (f *CallFrame) Walk(fn func(depth int, f *CallFrame) bool) {
+	f.walk(0, fn)
+}
+
+func (f *CallFrame) walk(depth int, fn func(int, *CallFrame) bool) {
+	if !fn(depth, f) {
+		return
+	}
+	for i := range f.Calls {
+		f.Calls[i].walk(depth+1, fn)
+	}
+}
+
+// ValueTransfer is a movement of ether
+// from one account to another.
+type ValueTransfer struct {
+	From  Address
+	To    Address
+	Value Int
+	Depth int // zero for the transaction itself
+}
+
+// Transfers returns every non-zero movement of ether in
+// the call tree that was not reverted, including internal
+// transfers made by contracts.
+func (f *CallFrame) Transfers() []ValueTransfer {
+	var out []ValueTransfer
+	f.Walk(func(depth int, f *CallFrame) bool {
+		if f.Failed() {
+			return false
+		}
+		if f.Type != "DELEGATECALL" && f.Type != "CALLCODE" &&
+			f.Value != nil && f.Value.Big().Sign() > 0 && f.To != nil {
+			out = append(out, ValueTransfer{
+				From:  f.From,
+				To:    *f.To,
+				Value: *f.Value,
+				Depth: depth,
+			})
+		}
+		return true
+	})
+	return out
+}
+
+// AccountState is the state of an account
+// as reported by the geth prestateTracer.
+// Fields that are omitted by the tracer are zero.
+type AccountState struct {
+	Balance *Int          `json:"balance,omitempty"`
+	Nonce   Uint64        `json:"nonce,omitempty"`
+	Code    Data          `json:"code,omitempty"`
+	Storage map[Hash]Hash `json:"storage,omitempty"`
+}
+
+// StateDiff is the set of changes made by a transaction.
+// Pre contains the original values of every account field
+// that was modified, and Post contains the new values.
+// Accounts that were created are absent from Pre, and
+// accounts that were deleted are absent from Post.
+type StateDiff struct {
+	Pre  map[Address]AccountState `json:"pre"`
+	Post map[Address]AccountState `json:"post"`
+}
+
+type tracerOpts struct {
+	Tracer string      `json:"tracer"`
+	Config interface{} `json:"tracerConfig,omitempty"`
+}
+
+var (
+	callTracer  = tracerOpts{Tracer: "callTracer"}
+	diffTracer  = tracerOpts{Tracer: "prestateTracer", Config: map[string]bool{"diffMode": true}}
+	stateTracer = tracerOpts{Tracer: "prestateTracer"}
+)
+
+func (c *Client) traceTx(h *Hash, opts *tracerOpts, out interface{}) error {
+	buf, _ := json.Marshal(h)
+	obuf, _ := json.Marshal(opts)
+	return c.Do("debug_traceTransaction", []json.RawMessage{buf, obuf}, out)
+}
+
+func (c *Client) traceCall(call *CallOpts, blocknum int64, opts *tracerOpts, out interface{}) error {
+	buf, _ := json.Marshal(call)
+	obuf, _ := json.Marshal(opts)
+	return c.Do("debug_traceCall", []json.RawMessage{buf, itobs(blocknum), obuf}, out)
+}
+
+// TraceTransaction returns the call tree of a
+// mined transaction using debug_traceTransaction.
+func (c *Client) TraceTransaction(h *Hash) (*CallFrame, error) {
+	out := new(CallFrame)
+	if err := c.traceTx(h, &callTracer, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TraceCall executes a call at the given block
+// without mining it and returns its call tree.
+func (c *Client) TraceCall(call *CallOpts, blocknum int64) (*CallFrame, error) {
+	out := new(CallFrame)
+	if err := c.traceCall(call, blocknum, &callTracer, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TraceStateDiff returns the state
+// changes made by a mined transaction.
+func (c *Client) TraceStateDiff(h *Hash) (*StateDiff, error) {
+	out := new(StateDiff)
+	if err := c.traceTx(h, &diffTracer, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TraceCallStateDiff returns the state changes that
+// a call would make if it were executed at the given block.
+func (c *Client) TraceCallStateDiff(call *CallOpts, blocknum int64) (*StateDiff, error) {
+	out := new(StateDiff)
+	if err := c.traceCall(call, blocknum, &diffTracer, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TracePrestate returns the state of every account touched
+// by a mined transaction, as of immediately before it executed.
+func (c *Client) TracePrestate(h *Hash) (map[Address]AccountState, error) {
+	var out map[Address]AccountState
+	if err := c.traceTx(h, &stateTracer, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParityAction is the action of a ParityTrace.
+// Call fields are set for "call" traces, Init for "create"
+// traces, and Address, RefundAddress and Balance for
+// "suicide" traces.
+type ParityAction struct {
+	CallType      string   `json:"callType,omitempty"` // call, staticcall, delegatecall, or callcode
+	From          Address  `json:"from"`
+	To            *Address `json:"to,omitempty"`
+	Value         *Int     `json:"value,omitempty"`
+	Gas           Uint64   `json:"gas"`
+	Input         Data     `json:"input,omitempty"`
+	Init          Data     `json:"init,omitempty"`
+	Address       *Address `json:"address,omitempty"`
+	RefundAddress *Address `json:"refundAddress,omitempty"`
+	Balance       *Int     `json:"balance,omitempty"`
+}
+
+// ParityResult is the result of a ParityTrace.
+type ParityResult struct {
+	GasUsed Uint64   `json:"gasUsed"`
+	Output  Data     `json:"output,omitempty"`
+	Address *Address `json:"address,omitempty"` // created contract
+	Code    Data     `json:"code,omitempty"`    // created contract code
+}
+
+// ParityTrace is one entry of the flat trace list
+// returned by the Parity-style trace_* methods.
+type ParityTrace struct {
+	Type         string        `json:"type"` // call, create, or suicide
+	Action       ParityAction  `json:"action"`
+	Result       *ParityResult `json:"result"` // nil if Error is set
+	Error        string        `json:"error,omitempty"`
+	Subtraces    int           `json:"subtraces"`
+	TraceAddress []int         `json:"traceAddress"` // path from the root call
+	BlockHash    *Hash         `json:"blockHash"`
+	BlockNumber  Uint64        `json:"blockNumber"`
+	TxHash       *Hash         `json:"transactionHash"` // nil for block rewards
+	TxPosition   *Uint64       `json:"transactionPosition"`
+}
+
+// Traces returns the Parity-style traces
+// of a transaction using trace_transaction.
+func (c *Client) Traces(h *Hash) ([]ParityTrace, error) {
+	buf, _ := json.Marshal(h)
+	var out []ParityTrace
+	err := c.Do("trace_transaction", []json.RawMessage{buf}, &out)
+	return out, err
+}
+
+// BlockTraces returns the Parity-style traces of every
+// transaction in a block using trace_block.
+func (c *Client) BlockTraces(blocknum int64) ([]ParityTrace, error) {
+	var out []ParityTrace
+	err := c.Do("trace_block", []json.RawMessage{itobs(blocknum)}, &out)
+	return out, err
+}
+
+func (t *ParityTrace) frame() CallFrame {
+	f := CallFrame{
+		From:  t.Action.From,
+		To:    t.Action.To,
+		Value: t.Action.Value,
+		Gas:   t.Action.Gas,
+		Input: t.Action.Input,
+		Error: t.Error,
+	}
+	switch t.Type {
+	case "create":
+		f.Type = "CREATE"
+		f.Input = t.Action.Init
+	case "suicide":
+		f.Type = "SELFDESTRUCT"
+		if t.Action.Address != nil {
+			f.From = *t.Action.Address
+		}
+		f.To = t.Action.RefundAddress
+		f.Value = t.Action.Balance
+	default:
+		f.Type = "CALL"
+		if t.Action.CallType != "" {
+			f.Type = strings.ToUpper(t.Action.CallType)
+		}
+	}
+	if t.Result != nil {
+		f.GasUsed = t.Result.GasUsed
+		f.Output = t.Result.Output
+		if t.Result.Address != nil {
+			f.To = t.Result.Address
+		}
+	}
+	return f
+}
+
+var (
+	errNoRoot     = errors.New("seth: traces must contain exactly one root call, first")
+	errTraceOrder = errors.New("seth: trace addresses out of order")
+)
+
+// CallTree converts the flat Parity-style traces of a single
+// transaction into a call tree. The traces must be in the order
+// in which they are returned by Traces.
+func CallTree(traces []ParityTrace) (*CallFrame, error) {
+	if len(traces) == 0 || len(traces[0].TraceAddress) != 0 {
+		return nil, errNoRoot
+	}
+	root := traces[0].frame()
+	for i := range traces[1:] {
+		t := &traces[i+1]
+		path := t.TraceAddress
+		if len(path) == 0 {
+			return nil, errNoRoot
+		}
+		parent := &root
+		for _, j := range path[:len(path)-1] {
+			if j < 0 || j >= len(parent.Calls) {
+				return nil, errTraceOrder
+			}
+			parent = &parent.Calls[j]
+		}
+		if path[len(path)-1] != len(parent.Calls) {
+			return nil, errTraceOrder
+		}
+		parent.Calls = append(parent.Calls, t.frame())
+	}
+	return &root, nil
+}
@@ -0,0 +1,142 @@
+package seth
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testCallTrace = `{
+  "type": "CALL",
+  "from": "0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f",
+  "to": "0x419d0d8bdd9af5e606ae2232ed285aff190e711b",
+  "value": "0x0",
+  "gas": "0x15f90",
+  "gasUsed": "0x86d0",
+  "input": "0x2e1a7d4d0000000000000000000000000000000000000000000000000de0b6b3a7640000",
+  "output": "0x",
+  "calls": [
+    {
+      "type": "CALL",
+      "from": "0x419d0d8bdd9af5e606ae2232ed285aff190e711b",
+      "to": "0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f",
+      "value": "0xde0b6b3a7640000",
+      "gas": "0x8fc",
+      "gasUsed": "0x0",
+      "input": "0x"
+    },
+    {
+      "type": "CALL",
+      "from": "0x419d0d8bdd9af5e606ae2232ed285aff190e711b",
+      "to": "0x50b26685bc788e164d940f0a73770f4b9196b052",
+      "value": "0x1",
+      "gas": "0x8fc",
+      "gasUsed": "0x8fc",
+      "input": "0x",
+      "error": "out of gas"
+    }
+  ]
+}`
+
+func TestTraceTransaction(t *testing.T) {
+	t.Parallel()
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if req.Method != "debug_traceTransaction" || len(req.Params) != 2 {
+			t.Fatalf("unexpected request %s %s", req.Method, req.Params)
+		}
+		if string(req.Params[1]) != `{"tracer":"callTracer"}` {
+			t.Errorf("unexpected tracer options %s", req.Params[1])
+		}
+		res.Result = json.RawMessage(testCallTrace)
+		return nil
+	}))
+	var h Hash
+	f, err := c.TraceTransaction(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Calls) != 2 || f.GasUsed != 0x86d0 || !f.Calls[1].Failed() {
+		t.Fatalf("bad call tree: %+v", f)
+	}
+	xfers := f.Transfers()
+	if len(xfers) != 1 {
+		t.Fatalf("expected 1 transfer; got %d", len(xfers))
+	}
+	if xfers[0].Depth != 1 || xfers[0].Value.Big().String() != "1000000000000000000" || xfers[0].To != f.From {
+		t.Errorf("bad transfer: %+v", xfers[0])
+	}
+}
+
+func TestStateDiff(t *testing.T) {
+	t.Parallel()
+	const diff = `{
+  "pre": {"0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f": {"balance": "0x10", "nonce": 1}},
+  "post": {"0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f": {"balance": "0x8", "nonce": 2,
+    "storage": {"0x0000000000000000000000000000000000000000000000000000000000000001": "0x00000000000000000000000000000000000000000000000000000000000000ff"}}}
+}`
+	c := NewClientTransport(tportFunc(func(req *RPCRequest, res *RPCResponse) error {
+		if !strings.Contains(string(req.Params[1]), `"diffMode":true`) {
+			t.Errorf("unexpected tracer options %s", req.Params[1])
+		}
+		res.Result = json.RawMessage(diff)
+		return nil
+	}))
+	var h Hash
+	d, err := c.TraceStateDiff(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := ParseAddress("0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f")
+	pre, post := d.Pre[*addr], d.Post[*addr]
+	if pre.Balance.Int64() != 16 || post.Balance.Int64() != 8 || post.Nonce != 2 {
+		t.Errorf("bad diff: %+v %+v", pre, post)
+	}
+	var slot Hash
+	slot[31] = 1
+	if v := post.Storage[slot]; v[31] != 0xff {
+		t.Errorf("bad storage value %s", v.String())
+	}
+}
+
+func TestCallTree(t *testing.T) {
+	t.Parallel()
+	const traces = `[
+  {"type":"call","action":{"callType":"call","from":"0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f","to":"0x419d0d8bdd9af5e606ae2232ed285aff190e711b","value":"0x0","gas":"0x15f90","input":"0x"},
+   "result":{"gasUsed":"0x86d0","output":"0x"},"subtraces":2,"traceAddress":[],"blockNumber":100,"transactionPosition":0},
+  {"type":"create","action":{"from":"0x419d0d8bdd9af5e606ae2232ed285aff190e711b","value":"0x0","gas":"0x1000","init":"0x6060"},
+   "result":{"gasUsed":"0x100","address":"0x50b26685bc788e164d940f0a73770f4b9196b052","code":"0x60"},"subtraces":1,"traceAddress":[0],"blockNumber":100},
+  {"type":"suicide","action":{"address":"0x50b26685bc788e164d940f0a73770f4b9196b052","refundAddress":"0x18250eaf72bbaa0237a662b9b85ebd8fa0cf128f","balance":"0x5"},
+   "result":null,"subtraces":0,"traceAddress":[0,0],"blockNumber":100},
+  {"type":"call","action":{"callType":"delegatecall","from":"0x419d0d8bdd9af5e606ae2232ed285aff190e711b","to":"0x50b26685bc788e164d940f0a73770f4b9196b052","gas":"0x100","input":"0x"},
+   "error":"Reverted","subtraces":0,"traceAddress":[1],"blockNumber":100}
+]`
+	var pt []ParityTrace
+	if err := json.Unmarshal([]byte(traces), &pt); err != nil {
+		t.Fatal(err)
+	}
+	root, err := CallTree(pt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	root.Walk(func(depth int, f *CallFrame) bool {
+		types = append(types, strings.Repeat(">", depth)+f.Type)
+		return true
+	})
+	want := "CALL, >CREATE, >>SELFDESTRUCT, >DELEGATECALL"
+	if got := strings.Join(types, ", "); got != want {
+		t.Errorf("got tree %q; wanted %q", got, want)
+	}
+	create := root.Calls[0]
+	if create.To == nil || create.To.String() != "0x50b26685bc788e164d940f0a73770f4b9196b052" {
+		t.Errorf("bad created address %v", create.To)
+	}
+	if xfers := root.Transfers(); len(xfers) != 1 || xfers[0].Value.Int64() != 5 {
+		t.Errorf("bad transfers %+v", xfers)
+	}
+
+	pt[3].TraceAddress = []int{3}
+	if _, err := CallTree(pt); err == nil {
+		t.Error("expected an error for out-of-order traces")
+	}
+}